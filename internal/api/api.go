@@ -0,0 +1,347 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot"
+	"github.com/mikeflynn/honeybearhoneypot/internal/stats"
+	"github.com/mikeflynn/honeybearhoneypot/internal/web"
+)
+
+// Prefix is where Register mounts the API.
+const Prefix = "/api/v1"
+
+var startedAt = time.Now()
+
+// Status is the live state of the pot.
+type Status struct {
+	ActiveUsers      int                     `json:"active_users"`
+	UsersThisSession int                     `json:"users_this_session"`
+	UsersAllTime     int                     `json:"users_all_time"`
+	MaxUsers         int                     `json:"max_users"`
+	Tunnel           string                  `json:"tunnel"` // disabled, down when any tunnel is, or up
+	Tunnels          []honeypot.TunnelStatus `json:"tunnels"`
+	UptimeSeconds    int                     `json:"uptime_seconds"`
+}
+
+// Register mounts the API on the admin web server. Every request must carry
+// a token as "Authorization: Bearer <token>". token reads the pot's state;
+// controlToken also allows the routes that change it, like kick and ban, which
+// stay off without one. Without either token the API stays off.
+func Register(token, controlToken string) {
+	if token == "" && controlToken == "" {
+		return
+	}
+
+	var control func(http.Handler) http.Handler
+	if controlToken != "" {
+		control = tokenAuth(controlToken)
+	}
+	Mount(Prefix, tokenAuth(token, controlToken), control)
+
+	// Let browser dashboards on other origins send the Authorization header.
+	web.Handle("OPTIONS "+Prefix+"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cors(w)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	log.Info("API enabled", "path", Prefix, "control", controlToken != "")
+}
+
+// Mount adds the API routes to the admin web server under prefix. Routes that
+// only read are wrapped in auth, and routes that change the pot's state in
+// control; with a nil control they answer 403.
+func Mount(prefix string, auth, control func(http.Handler) http.Handler) {
+	routes := map[string]http.HandlerFunc{
+		"GET /status":              handleStatus,
+		"GET /logins":              handleLogins,
+		"GET /events":              handleEvents,
+		"GET /sessions":            handleSessions,
+		"GET /sessions/active":     handleActiveSessions,
+		"GET /sessions/{id}":       handleSession,
+		"GET /sessions/{id}/watch": handleWatch,
+		"GET /bans":                handleBans,
+		"GET /credentials":         handleCredentials,
+		"GET /commands/top":        handleTopCommands,
+		"GET /commands/rare":       handleRareCommands,
+		"GET /users/top":           handleTopUsers,
+		"GET /ctf/leaderboard":     handleLeaderboard,
+	}
+	controlRoutes := map[string]http.HandlerFunc{
+		"POST /sessions/{id}/wall": handleWall,
+		"POST /sessions/{id}/say":  handleSay,
+		"POST /sessions/{id}/type": handleType,
+		"POST /sessions/{id}/kick": handleKick,
+		"POST /sessions/{id}/ban":  handleBanSession,
+		"POST /bans":               handleAddBan,
+		"DELETE /bans/{id}":        handleDeleteBan,
+	}
+
+	for route, h := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		web.Handle(method+" "+prefix+path, auth(h))
+	}
+	if control == nil {
+		control = func(http.Handler) http.Handler {
+			return auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, http.StatusForbidden, "control routes are off; set api_control_token")
+			}))
+		}
+	}
+	for route, h := range controlRoutes {
+		method, path, _ := strings.Cut(route, " ")
+		web.Handle(method+" "+prefix+path, control(h))
+	}
+}
+
+// tokenAuth lets through requests carrying any of the non-empty tokens.
+func tokenAuth(tokens ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cors(w)
+
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || !validToken(given, tokens) {
+				writeError(w, http.StatusUnauthorized, "invalid or missing token")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func validToken(given string, tokens []string) bool {
+	valid := false
+	for _, token := range tokens {
+		if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+func cors(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+}
+
+// CurrentStatus returns the live state of the pot.
+func CurrentStatus() Status {
+	tunnel := "disabled"
+	switch honeypot.StatTunnelActive() {
+	case 0:
+		tunnel = "down"
+	case 1:
+		tunnel = "up"
+	}
+
+	return Status{
+		ActiveUsers:      honeypot.StatActiveUsers(),
+		UsersThisSession: honeypot.StatUsersThisSession(),
+		UsersAllTime:     honeypot.StatUsersAllTime(),
+		MaxUsers:         honeypot.StatMaxUsers(),
+		Tunnel:           tunnel,
+		Tunnels:          honeypot.StatTunnels(),
+		UptimeSeconds:    int(time.Since(startedAt).Seconds()),
+	}
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, CurrentStatus())
+}
+
+func handleLogins(w http.ResponseWriter, r *http.Request) {
+	windows, err := stats.LoginCounts()
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	allTime, err := stats.LoginsAllTime()
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]any{"windows": windows, "all_time": allTime})
+}
+
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	f, p, ok := parseQuery(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := stats.Events(f, p)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	f, p, ok := parseQuery(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := stats.Sessions(f, p)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+func handleActiveSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, honeypot.StatActiveSessions())
+}
+
+func handleSession(w http.ResponseWriter, r *http.Request) {
+	session, err := stats.Session(r.PathValue("id"))
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if session == nil {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	writeJSON(w, session)
+}
+
+func handleCredentials(w http.ResponseWriter, r *http.Request) {
+	f, p, ok := parseQuery(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := stats.Credentials(f, p)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+func handleTopCommands(w http.ResponseWriter, r *http.Request) {
+	writeCounts(w, r, stats.TopCommands)
+}
+
+func handleRareCommands(w http.ResponseWriter, r *http.Request) {
+	writeCounts(w, r, stats.RareCommands)
+}
+
+func handleTopUsers(w http.ResponseWriter, r *http.Request) {
+	writeCounts(w, r, stats.TopUsers)
+}
+
+func handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	_, p, ok := parseQuery(w, r)
+	if !ok {
+		return
+	}
+
+	board, err := stats.Leaderboard(p.Limit)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, board)
+}
+
+func writeCounts[T any](w http.ResponseWriter, r *http.Request, query func(limit int) (T, error)) {
+	_, p, ok := parseQuery(w, r)
+	if !ok {
+		return
+	}
+
+	counts, err := query(p.Limit)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, counts)
+}
+
+// parseQuery reads the filter and paging parameters shared by the list
+// endpoints. On a bad parameter it writes the error and returns false.
+func parseQuery(w http.ResponseWriter, r *http.Request) (stats.Filter, stats.Page, bool) {
+	q := r.URL.Query()
+	f := stats.Filter{
+		Source:  q.Get("source"),
+		App:     q.Get("app"),
+		User:    q.Get("user"),
+		IP:      q.Get("ip"),
+		Session: q.Get("session"),
+	}
+	p := stats.Page{}
+
+	if t := q.Get("type"); t != "" {
+		f.Types = strings.Split(t, ",")
+	}
+
+	var err error
+	if f.Since, err = stats.ParseTime(q.Get("since")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+		return f, p, false
+	}
+	if f.Until, err = stats.ParseTime(q.Get("until")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid until: "+err.Error())
+		return f, p, false
+	}
+
+	for name, dst := range map[string]*int{"limit": &p.Limit, "offset": &p.Offset} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid "+name)
+			return f, p, false
+		}
+		*dst = n
+	}
+
+	return f, p, true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug("API response failed", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+func serverError(w http.ResponseWriter, err error) {
+	log.Error("API query failed", "error", err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot"
+)
+
+// banRequest is the body of the ban endpoints. Duration is a Go duration or a
+// number of days (7d); empty bans forever.
+type banRequest struct {
+	Kind     string `json:"kind"`
+	Value    string `json:"value"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"`
+}
+
+func handleBans(w http.ResponseWriter, r *http.Request) {
+	bans, err := entity.BansActive()
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, bans)
+}
+
+func handleAddBan(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeBan(w, r, false)
+	if !ok {
+		return
+	}
+
+	d, err := entity.ParseBanDuration(req.Duration)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	b := entity.NewBan(req.Kind, req.Value, req.Reason, d)
+	if err := b.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := honeypot.Ban(b); err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSONStatus(w, http.StatusCreated, b)
+}
+
+func handleDeleteBan(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid ban id")
+		return
+	}
+
+	found, err := honeypot.Unban(id)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "ban not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleKick(w http.ResponseWriter, r *http.Request) {
+	if err := honeypot.Kick(r.PathValue("id")); err != nil {
+		sessionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleBanSession bans the session's address and disconnects it. The body is
+// optional and only the reason and duration are used.
+func handleBanSession(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeBan(w, r, true)
+	if !ok {
+		return
+	}
+
+	d, err := entity.ParseBanDuration(req.Duration)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	b, err := honeypot.BanSession(r.PathValue("id"), d, req.Reason)
+	if err != nil {
+		sessionError(w, err)
+		return
+	}
+
+	writeJSONStatus(w, http.StatusCreated, b)
+}
+
+// decodeBan reads a banRequest from the body, writing an error if it can't.
+// An empty body is an empty request when it's optional, whether or not the
+// client sent a length.
+func decodeBan(w http.ResponseWriter, r *http.Request, optional bool) (banRequest, bool) {
+	req := banRequest{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req)
+	if err != nil && !(optional && errors.Is(err, io.EOF)) {
+		writeError(w, http.StatusBadRequest, "invalid body")
+		return req, false
+	}
+
+	return req, true
+}
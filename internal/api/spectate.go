@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot"
+)
+
+// operatorRequest is the body of the session control endpoints.
+type operatorRequest struct {
+	Message string `json:"message"`
+	Command string `json:"command"`
+}
+
+// handleWatch streams a session's raw terminal output until the session ends
+// or the client goes away. The session's terminal size is sent in headers so
+// the watcher can match it.
+func handleWatch(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	watcher, err := honeypot.Watch(r.PathValue("id"))
+	if err != nil {
+		sessionError(w, err)
+		return
+	}
+	defer watcher.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Terminal-Width", strconv.Itoa(watcher.Width))
+	w.Header().Set("X-Terminal-Height", strconv.Itoa(watcher.Height))
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case data, ok := <-watcher.C:
+			if !ok {
+				return
+			}
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func handleWall(w http.ResponseWriter, r *http.Request) {
+	control(w, r, func(id string, req operatorRequest) error {
+		return honeypot.Wall(id, req.Message)
+	})
+}
+
+func handleSay(w http.ResponseWriter, r *http.Request) {
+	control(w, r, func(id string, req operatorRequest) error {
+		return honeypot.Say(id, req.Message)
+	})
+}
+
+func handleType(w http.ResponseWriter, r *http.Request) {
+	control(w, r, func(id string, req operatorRequest) error {
+		return honeypot.TypeCommand(id, req.Command)
+	})
+}
+
+func control(w http.ResponseWriter, r *http.Request, fn func(id string, req operatorRequest) error) {
+	req := operatorRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+	if req.Message == "" && req.Command == "" {
+		writeError(w, http.StatusBadRequest, "message or command required")
+		return
+	}
+
+	if err := fn(r.PathValue("id"), req); err != nil {
+		sessionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func sessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, honeypot.ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, "session not active")
+		return
+	}
+	if errors.Is(err, honeypot.ErrLoopbackBan) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	serverError(w, err)
+}
@@ -1,16 +1,17 @@
-package gui
+package bear
 
 import (
 	"math/rand"
 	"slices"
-	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/mikeflynn/honeybearhoneypot/internal/gui/assets"
 )
 
+// All is every bear the pot can show.
+//
 // Other Bear Ideas: Winking, More Looking, Concerned Looking, Blushing?, ...
-var bears = Bears{
+var All = Bears{
 	{Name: "Happy", File: "bear_happy.jpg", Category: "standard", SubCategory: "idle"},
 	{Name: "Look Left", File: "bear_look_left.jpg", Category: "standard", SubCategory: "idle"},
 	{Name: "Look Right", File: "bear_look_right.jpg", Category: "standard", SubCategory: "idle"},
@@ -90,11 +91,3 @@ func (b Bears) GetBearByCategory(category string, subCategory ...string) *Bear {
 
 	return nil
 }
-
-func getDurationSeconds(sec int) *time.Duration {
-	if sec <= 0 {
-		return nil
-	}
-	d := time.Duration(sec) * time.Second
-	return &d
-}
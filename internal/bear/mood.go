@@ -0,0 +1,134 @@
+package bear
+
+import (
+	rand "math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot"
+)
+
+const (
+	frameWait  = 2 * time.Second
+	glitchWait = 600 * time.Millisecond
+	talkPause  = 30 * time.Second
+)
+
+// Mood picks which bear to show next. Pot events excite the bear and quiet
+// periods calm it down; the more excited it is, the more often it emotes.
+type Mood struct {
+	mu            sync.Mutex
+	current       *Bear
+	override      string
+	emotionFactor int
+	skipFrames    int
+	talkAfter     time.Time
+}
+
+// NewMood starts a mood with the boot bear showing.
+func NewMood() *Mood {
+	return &Mood{
+		current:       All.GetBearByCategory("boot", ""),
+		emotionFactor: 1,
+	}
+}
+
+// Current returns the bear showing now.
+func (m *Mood) Current() *Bear {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current
+}
+
+// Excite is called for every pot event.
+func (m *Mood) Excite() {
+	m.mu.Lock()
+	m.emotionFactor++
+	log.Debug("Emotion Status:", "factor", m.emotionFactor)
+	m.mu.Unlock()
+}
+
+// Calm is called after a minute without events.
+func (m *Mood) Calm() {
+	m.mu.Lock()
+	m.emotionFactor--
+	log.Debug("Emotion Status:", "factor", m.emotionFactor)
+	m.mu.Unlock()
+}
+
+// React makes the bear look surprised on the next frame, e.g. when its nose
+// is tapped.
+func (m *Mood) React() {
+	m.mu.Lock()
+	m.override = All.GetBearByCategory("standard", "react").Name
+	m.mu.Unlock()
+}
+
+// Next picks the bear for the next frame and how long to show it. Switching
+// between categories goes through a brief glitch bear first.
+func (m *Mood) Next() (*Bear, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wait := frameWait
+
+	var newBear *Bear
+	if m.override != "" {
+		newBear = All.GetBear(m.override)
+	} else {
+		if m.skipFrames > 0 {
+			m.skipFrames--
+		} else {
+			if m.shouldShowEmotion() {
+				newBear = All.GetBearByCategory("emote", "")
+			} else {
+				subcat := []string{"idle"}
+				if time.Now().After(m.talkAfter) {
+					subcat = append(subcat, "talk")
+				}
+
+				newBear = All.GetBearByCategory("standard", subcat...)
+
+				// Don't talk again for a while
+				if newBear.SubCategory == "talk" {
+					m.talkAfter = time.Now().Add(talkPause)
+				}
+			}
+
+			m.skipFrames = newBear.SkipFrames // Get the skip frames for the new bear
+		}
+	}
+
+	if newBear == nil {
+		log.Debug("No bear found. Using current bear.")
+		return m.current, wait
+	}
+
+	if m.override == "" && m.current.Category != newBear.Category {
+		m.override = newBear.Name // Set the new bear to load after the glitch
+		log.Debug("Loading glitch bear")
+		return All.GetBearByCategory("glitch", ""), glitchWait
+	}
+
+	m.current = newBear // Set the current bear to the new bear
+	m.override = ""     // Reset the override bear
+
+	return newBear, wait
+}
+
+func (m *Mood) shouldShowEmotion() bool {
+	max := (honeypot.StatActiveUsers() * 3) + (honeypot.StatMaxUsers() * 2)
+	r := rand.IntN(max)
+	log.Debug("Bear update:", "max", max, "r", r, "emotionFactor", m.emotionFactor)
+
+	resp := r <= m.emotionFactor
+	if resp {
+		m.emotionFactor -= 10
+		if m.emotionFactor < 0 {
+			m.emotionFactor = 1
+		}
+	}
+
+	return resp
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+)
+
+func bansCmd(args []string) error {
+	fs := flag.NewFlagSet("bans", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: bans <subcommand>")
+		fmt.Fprintln(os.Stderr, "  list                                          List the bans in effect")
+		fmt.Fprintln(os.Stderr, "  add [-for D] [-reason R] ip|cidr|user|client <value>")
+		fmt.Fprintln(os.Stderr, "                                                Add a ban, for a duration like 12h or 7d or forever")
+		fmt.Fprintln(os.Stderr, "  remove <id>                                   Lift a ban")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		return bansListCmd()
+	case "add":
+		return bansAddCmd(fs.Args()[1:])
+	case "remove":
+		return bansRemoveCmd(fs.Args()[1:])
+	}
+
+	return fmt.Errorf("unknown subcommand %q", fs.Arg(0))
+}
+
+func bansListCmd() error {
+	bans, err := entity.BansActive()
+	if err != nil {
+		return err
+	}
+
+	if len(bans) == 0 {
+		fmt.Println("No bans.")
+		return nil
+	}
+
+	for _, b := range bans {
+		fmt.Printf("%-5d %-7s %-24s %-20s %s\n", b.ID, b.Kind, b.Value, banExpiry(b), b.Reason)
+	}
+
+	return nil
+}
+
+func bansAddCmd(args []string) error {
+	fs := flag.NewFlagSet("bans add", flag.ContinueOnError)
+	duration := fs.String("for", "forever", "How long the ban lasts, e.g. 12h or 7d")
+	reason := fs.String("reason", "", "Why, for the ban list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		return errors.New("usage: bans add [-for D] [-reason R] ip|cidr|user|client <value>")
+	}
+
+	d, err := entity.ParseBanDuration(*duration)
+	if err != nil {
+		return err
+	}
+
+	b := entity.NewBan(fs.Arg(0), fs.Arg(1), *reason, d)
+	if err := b.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Banned %s %s (#%d) until %s.\n", b.Kind, b.Value, b.ID, banExpiry(*b))
+	return nil
+}
+
+func bansRemoveCmd(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: bans remove <id>")
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid ban id %q", args[0])
+	}
+
+	found, err := entity.BanDelete(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no ban #%d", id)
+	}
+
+	fmt.Printf("Ban #%d removed.\n", id)
+	return nil
+}
+
+func banExpiry(b entity.Ban) string {
+	if b.ExpiresAt == nil {
+		return "forever"
+	}
+
+	return b.ExpiresAt.Local().Format(time.DateTime)
+}
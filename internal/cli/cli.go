@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command is a subcommand that runs instead of starting the honey pot, either
+// against the app database or against a running pot's API.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+	hidden  bool // Kept for old scripts but left out of the usage
+}
+
+func commands() []command {
+	return []command{
+		{name: "bans", summary: "List, add and remove bans", run: bansCmd},
+		{name: "config", summary: "Check the config or show the settings in effect", run: configCmd},
+		{name: "ctf", summary: "Manage CTF players and check the configured tasks", run: ctfCmd},
+		{name: "db", summary: "Back up or compact the database", run: dbCmd},
+		{name: "events", summary: "Show or follow the latest events", run: eventsCmd},
+		{name: "export", summary: "Export events, sessions, credentials or CTF results", run: exportCmd},
+		{name: "options", summary: "Show and change the pot's settings", run: optionsCmd},
+		{name: "prune", summary: "Delete events according to the retention policy", run: pruneCmd},
+		{name: "sessions", summary: "Browse past sessions, or watch, talk to, kick and ban live ones", run: sessionsCmd},
+		{name: "stats", summary: "Show login, command and CTF statistics", run: statsCmd},
+		{name: "vacuum", summary: "Compact the database file", run: vacuumCmd, hidden: true},
+	}
+}
+
+// Run executes the subcommand named by args[0] and returns the process exit
+// code.
+func Run(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	for _, c := range commands() {
+		if c.name != args[0] {
+			continue
+		}
+
+		if err := c.run(args[1:]); err != nil {
+			if err == flag.ErrHelp {
+				return 0
+			}
+
+			fmt.Fprintf(os.Stderr, "%s: %s\n", c.name, err)
+			return 1
+		}
+
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	usage()
+	return 2
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands() {
+		if c.hidden {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+}
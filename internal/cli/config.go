@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+)
+
+func configCmd(args []string) error {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: config <subcommand>")
+		fmt.Fprintln(os.Stderr, "  check [file]         Validate a config file, or the -config file and flags")
+		fmt.Fprintln(os.Stderr, "  dump [-secrets]      Print the effective config and where each setting came from")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rest := fs.Args()
+	if len(rest) > 0 {
+		rest = rest[1:]
+	}
+
+	switch fs.Arg(0) {
+	case "check":
+		return configCheckCmd(rest)
+	case "dump":
+		return configDumpCmd(rest)
+	case "":
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	return fmt.Errorf("unknown subcommand %q", fs.Arg(0))
+}
+
+func configCheckCmd(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: config check [file]")
+	}
+
+	var cfg *config.Config
+	var err error
+	if len(args) == 1 {
+		cfg, err = config.Check(args[0])
+	} else {
+		cfg, err = config.Reload()
+	}
+
+	var problems config.Problems
+	if errors.As(err, &problems) {
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		return fmt.Errorf("%d problem(s) found", len(problems))
+	}
+	if err != nil {
+		return err
+	}
+
+	// Ports in use by something else only matter on this machine, so they're
+	// warnings rather than problems. A pot that's already running will hold
+	// its own ports.
+	listed := []struct {
+		setting string
+		ports   []string
+	}{{"ssh_ports", cfg.SSHPorts}, {"telnet_ports", cfg.TelnetPorts}, {"http_ports", cfg.HTTPPorts}}
+	for _, l := range listed {
+		for _, port := range l.ports {
+			ln, err := net.Listen("tcp", ":"+port)
+			if err != nil {
+				fmt.Printf("warning: $.%s: can't listen on port %s: %s\n", l.setting, port, err)
+				continue
+			}
+			ln.Close()
+		}
+	}
+
+	fmt.Println("OK")
+	return nil
+}
+
+func configDumpCmd(args []string) error {
+	fs := flag.NewFlagSet("config dump", flag.ContinueOnError)
+	secrets := fs.Bool("secrets", false, "Show the API token, PIN and webhook secrets instead of masking them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, sources, err := config.Effective()
+	if err != nil {
+		return err
+	}
+
+	if !*secrets {
+		cfg = masked(cfg)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Config  *config.Config `json:"config"`
+		Sources config.Sources `json:"sources"`
+	}{cfg, sources})
+}
+
+// masked returns a copy of cfg with its secrets replaced.
+func masked(cfg *config.Config) *config.Config {
+	const mask = "********"
+
+	c := *cfg
+	if c.APIToken != "" {
+		c.APIToken = mask
+	}
+	if c.APIControlToken != "" {
+		c.APIControlToken = mask
+	}
+	if c.PinReset != "" {
+		c.PinReset = mask
+	}
+	if c.Sinks != nil {
+		sinks := *c.Sinks
+		sinks.Webhooks = append([]config.WebhookSink(nil), sinks.Webhooks...)
+		for i := range sinks.Webhooks {
+			if sinks.Webhooks[i].HMACSecret != "" {
+				sinks.Webhooks[i].HMACSecret = mask
+			}
+		}
+		c.Sinks = &sinks
+	}
+
+	return &c
+}
@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+)
+
+func ctfCmd(args []string) error {
+	fs := flag.NewFlagSet("ctf", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: ctf <subcommand>")
+		fmt.Fprintln(os.Stderr, "  users list                             List the players, highest points first")
+		fmt.Fprintln(os.Stderr, "  users reset-password <user> [password] Set a player's password, or generate one")
+		fmt.Fprintln(os.Stderr, "  users reset-progress <user>            Clear a player's points and completed tasks")
+		fmt.Fprintln(os.Stderr, "  users delete <user>                    Remove a player")
+		fmt.Fprintln(os.Stderr, "  tasks validate                         Check the tasks in the config file")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch strings.TrimSpace(fs.Arg(0) + " " + fs.Arg(1)) {
+	case "users", "users list":
+		return ctfUsersListCmd()
+	case "users reset-password":
+		return ctfResetPasswordCmd(fs.Args()[2:])
+	case "users reset-progress":
+		return ctfUserCmd("reset-progress", fs.Args()[2:], (*entity.CTFUser).ResetProgress, "Progress reset for %s.\n")
+	case "users delete":
+		return ctfUserCmd("delete", fs.Args()[2:], (*entity.CTFUser).Delete, "Deleted %s.\n")
+	case "tasks validate":
+		return ctfTasksValidateCmd()
+	case "":
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	return fmt.Errorf("unknown subcommand %q", strings.Join(fs.Args(), " "))
+}
+
+func ctfUsersListCmd() error {
+	users, err := entity.CTFUsers()
+	if err != nil {
+		return err
+	}
+
+	if len(users) == 0 {
+		fmt.Println("No players.")
+		return nil
+	}
+
+	for _, u := range users {
+		fmt.Printf("%-24s %5d pts  joined %s\n", u.Username, u.Points, u.CreatedAt.Local().Format(time.DateOnly))
+	}
+
+	return nil
+}
+
+// loadCTFUser finds an existing player by name.
+func loadCTFUser(username string) (*entity.CTFUser, error) {
+	u := &entity.CTFUser{Username: username}
+	if err := u.Load(); err != nil {
+		return nil, fmt.Errorf("no player %q", username)
+	}
+
+	return u, nil
+}
+
+func ctfResetPasswordCmd(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: ctf users reset-password <user> [password]")
+	}
+
+	u, err := loadCTFUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	password := ""
+	if len(args) == 2 {
+		password = args[1]
+	} else {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		password = hex.EncodeToString(b)
+	}
+
+	if err := u.SetPassword(password); err != nil {
+		return err
+	}
+
+	if len(args) == 2 {
+		fmt.Printf("Password changed for %s.\n", u.Username)
+	} else {
+		fmt.Printf("Password for %s is now %s\n", u.Username, password)
+	}
+
+	return nil
+}
+
+// ctfUserCmd runs an action on one existing player.
+func ctfUserCmd(name string, args []string, action func(*entity.CTFUser) error, done string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ctf users %s <user>", name)
+	}
+
+	u, err := loadCTFUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := action(u); err != nil {
+		return err
+	}
+
+	fmt.Printf(done, u.Username)
+	return nil
+}
+
+// ctfTasksValidateCmd checks the configured tasks for mistakes that would
+// make them unplayable, and warns about ones that are merely odd.
+func ctfTasksValidateCmd() error {
+	var tasks []config.Task
+	if cfg := config.Current(); cfg != nil {
+		tasks = cfg.Tasks
+	}
+
+	if len(tasks) == 0 {
+		fmt.Println("No tasks configured.")
+		return nil
+	}
+
+	completions, err := entity.CTFTaskCompletions()
+	if err != nil {
+		return err
+	}
+
+	problems := 0
+	report := func(fatal bool, task string, msg string, args ...any) {
+		level := "warning"
+		if fatal {
+			level = "error"
+			problems++
+		}
+		fmt.Printf("%-7s %s: %s\n", level, task, fmt.Sprintf(msg, args...))
+	}
+
+	names := map[string]bool{}
+	flags := map[string]string{}
+	for i, t := range tasks {
+		label := fmt.Sprintf("task %d", i+1)
+		if t.Name != "" {
+			label = fmt.Sprintf("%q", t.Name)
+		}
+
+		switch {
+		case strings.TrimSpace(t.Name) == "":
+			report(true, label, "name is required")
+		case names[t.Name]:
+			report(true, label, "name is used by another task, so completing one completes both")
+		}
+		names[t.Name] = true
+
+		if strings.TrimSpace(t.Flag) == "" {
+			report(true, label, "flag is required")
+		} else if t.Flag != strings.TrimSpace(t.Flag) {
+			report(true, label, "flag has leading or trailing spaces, which answers never do")
+		} else if other, ok := flags[t.Flag]; ok {
+			report(false, label, "same flag as %q", other)
+		}
+		flags[t.Flag] = t.Name
+
+		if t.Points <= 0 {
+			report(true, label, "points must be more than 0")
+		}
+		if strings.TrimSpace(t.Description) == "" {
+			report(false, label, "no description")
+		}
+	}
+
+	for task, n := range completions {
+		if !names[task] {
+			report(false, fmt.Sprintf("%q", task), "completed by %d players but no longer configured", n)
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problems in %d tasks", problems, len(tasks))
+	}
+
+	fmt.Printf("%d tasks OK.\n", len(tasks))
+	return nil
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/db"
+	"github.com/mikeflynn/honeybearhoneypot/internal/retention"
+)
+
+func pruneCmd(args []string) error {
+	policy := config.Retention{}
+	if cfg := config.Current(); cfg != nil && cfg.Retention != nil {
+		policy = *cfg.Retention
+	}
+
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	fs.IntVar(&policy.MaxAgeDays, "max-age-days", policy.MaxAgeDays, "Delete events older than this many days")
+	fs.IntVar(&policy.MaxRows, "max-rows", policy.MaxRows, "Keep at most this many events")
+	fs.BoolVar(&policy.Rollup, "rollup", policy.Rollup, "Aggregate events into daily totals before deleting them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !retention.Enabled(&policy) {
+		return fmt.Errorf("no retention limits set; use -max-age-days, -max-rows or the config file")
+	}
+
+	deleted, err := retention.Prune(&policy)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted %d events.\n", deleted)
+	return nil
+}
+
+func dbCmd(args []string) error {
+	fs := flag.NewFlagSet("db", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: db <subcommand>")
+		fmt.Fprintln(os.Stderr, "  backup [file]    Copy the database, by default to database-<time>.db here")
+		fmt.Fprintln(os.Stderr, "  vacuum           Compact the database file after large deletes")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "backup":
+		return dbBackupCmd(fs.Args()[1:])
+	case "vacuum":
+		return vacuumCmd(fs.Args()[1:])
+	case "":
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	return fmt.Errorf("unknown subcommand %q", fs.Arg(0))
+}
+
+func dbBackupCmd(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: db backup [file]")
+	}
+
+	path := "database-" + time.Now().Format("20060102-150405") + ".db"
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	if err := db.Backup(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("Database backed up to %s.\n", path)
+	return nil
+}
+
+func vacuumCmd(args []string) error {
+	fs := flag.NewFlagSet("vacuum", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := db.Vacuum(); err != nil {
+		return err
+	}
+
+	fmt.Println("Database vacuumed.")
+	return nil
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/stats"
+)
+
+// followInterval is how often events tail -f checks for new events.
+const followInterval = time.Second
+
+func eventsCmd(args []string) error {
+	fs := flag.NewFlagSet("events", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: events tail [-n N] [-f] [-type a,b] [-user U] [-ip IP] [-json]")
+		fmt.Fprintln(os.Stderr, "  tail    Show the latest events, and with -f keep showing new ones")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "tail":
+		return eventsTailCmd(fs.Args()[1:])
+	case "":
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	return fmt.Errorf("unknown subcommand %q", fs.Arg(0))
+}
+
+func eventsTailCmd(args []string) error {
+	fs := flag.NewFlagSet("events tail", flag.ContinueOnError)
+	n := fs.Int("n", 20, "How many of the latest events to show")
+	follow := fs.Bool("f", false, "Keep showing new events as they're recorded")
+	types := fs.String("type", "", "Comma separated event types to include")
+	user := fs.String("user", "", "Only events from this user")
+	ip := fs.String("ip", "", "Only events from this remote IP")
+	asJSON := fs.Bool("json", false, "Print one JSON object per event")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 0 {
+		return errors.New("usage: events tail [-n N] [-f] [-type a,b] [-user U] [-ip IP] [-json]")
+	}
+
+	filter := stats.Filter{User: *user, IP: *ip}
+	if *types != "" {
+		filter.Types = strings.Split(*types, ",")
+	}
+
+	show := printEvent
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		show = func(e *entity.Event) { enc.Encode(e) }
+	}
+
+	res, err := stats.Events(filter, stats.Page{Limit: *n})
+	if err != nil {
+		return err
+	}
+
+	last := 0
+	for _, e := range slices.Backward(res.Items) {
+		show(e)
+		last = e.ID
+	}
+
+	if !*follow {
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// Keep reading until caught up, in case a burst came in since the
+		// last check.
+		for {
+			events, err := stats.EventsAfter(filter, last, stats.MaxLimit)
+			if err != nil {
+				return err
+			}
+
+			for _, e := range events {
+				show(e)
+				last = e.ID
+			}
+
+			if len(events) < stats.MaxLimit {
+				break
+			}
+		}
+	}
+}
+
+func printEvent(e *entity.Event) {
+	fmt.Printf("%s  %-8s %-6s %-16s %-22s %s\n",
+		e.Timestamp.Local().Format(time.DateTime), e.Type, e.Source, e.User, e.Host, e.Action)
+}
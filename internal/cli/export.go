@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/export"
+	"github.com/mikeflynn/honeybearhoneypot/internal/stats"
+)
+
+func exportCmd(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	data := fs.String("data", export.DataEvents, "What to export: "+strings.Join(export.Datasets, ", "))
+	format := fs.String("format", export.FormatJSONL, "Output format: jsonl or csv")
+	out := fs.String("o", "", "File to write to (default stdout)")
+	since := fs.String("since", "", "Only rows at or after this time (RFC3339, YYYY-MM-DD, or an age like 7d or 12h)")
+	until := fs.String("until", "", "Only rows before this time (same formats as -since)")
+	types := fs.String("type", "", "Comma separated event types to include (events only)")
+	ip := fs.String("ip", "", "Only rows from this remote IP")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := export.Filter{IP: *ip}
+	if *types != "" {
+		filter.Types = strings.Split(*types, ",")
+	}
+
+	var err error
+	if filter.Since, err = stats.ParseTime(*since); err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+	if filter.Until, err = stats.ParseTime(*until); err != nil {
+		return fmt.Errorf("invalid -until: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	buf := bufio.NewWriter(w)
+	count, err := export.Write(buf, *data, *format, filter)
+	if flushErr := buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d %s rows to %s\n", count, *data, *out)
+	}
+
+	return nil
+}
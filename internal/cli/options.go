@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+)
+
+// knownOption is a setting the pot reads from the options table.
+type knownOption struct {
+	name        string
+	description string
+}
+
+var knownOptions = []knownOption{
+	{name: entity.KeyAdminPIN, description: "PIN for the admin menu and dashboard (default " + entity.DefaultAdminPIN + ")"},
+	{name: entity.KeyPotMaxUsers, description: "Concurrent users allowed on the pot (default 10)"},
+	{name: entity.KeyPotMaxPerIP, description: "Concurrent SSH and telnet connections from one address (default 3, 0 for no limit)"},
+	{name: entity.KeyPotIPRate, description: "New connections from one address per minute (default 30, 0 for no limit)"},
+}
+
+func findOption(name string) (knownOption, error) {
+	for _, o := range knownOptions {
+		if o.name == name {
+			return o, nil
+		}
+	}
+
+	return knownOption{}, fmt.Errorf("unknown option %q; see options list", name)
+}
+
+func optionsCmd(args []string) error {
+	fs := flag.NewFlagSet("options", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: options <subcommand>")
+		fmt.Fprintln(os.Stderr, "  list                  Show every option and its value")
+		fmt.Fprintln(os.Stderr, "  get <name>            Print an option's value")
+		fmt.Fprintln(os.Stderr, "  set <name> <value>    Change an option; a running pot picks it up right away")
+		fmt.Fprintln(os.Stderr, "  unset <name>          Put an option back to its default")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rest := fs.Args()
+	if len(rest) > 0 {
+		rest = rest[1:]
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		return optionsListCmd()
+	case "get":
+		if len(rest) != 1 {
+			return errors.New("usage: options get <name>")
+		}
+		if _, err := findOption(rest[0]); err != nil {
+			return err
+		}
+		fmt.Println(entity.OptionGet(rest[0]))
+		return nil
+	case "set":
+		return optionsSetCmd(rest)
+	case "unset":
+		if len(rest) != 1 {
+			return errors.New("usage: options unset <name>")
+		}
+		if _, err := findOption(rest[0]); err != nil {
+			return err
+		}
+		return entity.OptionDelete(rest[0])
+	}
+
+	return fmt.Errorf("unknown subcommand %q", fs.Arg(0))
+}
+
+func optionsListCmd() error {
+	set, err := entity.Options()
+	if err != nil {
+		return err
+	}
+
+	values := map[string]string{}
+	for _, o := range set {
+		values[o.Name] = o.Value
+	}
+
+	for _, o := range knownOptions {
+		value, ok := values[o.name]
+		if !ok {
+			value = "(default)"
+		}
+		fmt.Printf("%-24s %-10s %s\n", o.name, value, o.description)
+		delete(values, o.name)
+	}
+
+	// Anything left over was set by an older version or by hand.
+	for _, o := range set {
+		if _, ok := values[o.Name]; ok {
+			fmt.Printf("%-24s %-10s %s\n", o.Name, o.Value, "(unused)")
+		}
+	}
+
+	return nil
+}
+
+func optionsSetCmd(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: options set <name> <value>")
+	}
+
+	o, err := findOption(args[0])
+	if err != nil {
+		return err
+	}
+
+	opt := &entity.Option{Name: o.name, Value: args[1]}
+	if err := opt.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s set to %s.\n", o.name, args[1])
+	return nil
+}
@@ -0,0 +1,403 @@
+package cli
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/api"
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/stats"
+)
+
+// potClient talks to a running pot's API, for the commands that act on live
+// sessions.
+type potClient struct {
+	base  string
+	token string
+}
+
+func sessionsCmd(args []string) error {
+	subcommands := map[string]func(*potClient, []string) error{
+		"active": sessionsActiveCmd,
+		"watch":  sessionsWatchCmd,
+		"wall":   sessionsWallCmd,
+		"say":    sessionsSayCmd,
+		"type":   sessionsTypeCmd,
+		"kick":   sessionsKickCmd,
+		"ban":    sessionsBanCmd,
+	}
+
+	cfg := config.Config{}
+	if active := config.Current(); active != nil {
+		cfg = *active
+	}
+
+	fs := flag.NewFlagSet("sessions", flag.ContinueOnError)
+	addr := fs.String("addr", cfg.WebAddr, "Admin web server address of the running pot")
+	// The control token reads too, so prefer it to reach every subcommand.
+	token := fs.String("token", cmp.Or(cfg.APIControlToken, cfg.APIToken), "API token (wall, say, type, kick and ban need api_control_token)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sessions [-addr ADDR] [-token TOKEN] <subcommand>")
+		fmt.Fprintln(os.Stderr, "  list [-n N] [-since T] [-user U] [-ip IP]")
+		fmt.Fprintln(os.Stderr, "                         List recorded sessions, from the database")
+		fmt.Fprintln(os.Stderr, "  show <id>              Show a recorded session and its events")
+		fmt.Fprintln(os.Stderr, "  active                 List the sessions connected right now")
+		fmt.Fprintln(os.Stderr, "  watch <id>             Watch a session's terminal")
+		fmt.Fprintln(os.Stderr, "  wall <id> <message>    Show a wall broadcast from root in a session")
+		fmt.Fprintln(os.Stderr, "  say <id> <message>     Show a message in a session's output")
+		fmt.Fprintln(os.Stderr, "  type <id> <command>    Run a command in a session as if it was typed there")
+		fmt.Fprintln(os.Stderr, "  kick <id>              Disconnect a session")
+		fmt.Fprintln(os.Stderr, "  ban [-for D] [-reason R] <id>")
+		fmt.Fprintln(os.Stderr, "                         Ban a session's IP address and disconnect it")
+		fmt.Fprintln(os.Stderr, "Session IDs can be shortened to any unique prefix.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	// These read the database, so they work without a running pot.
+	switch fs.Arg(0) {
+	case "list":
+		return sessionsListCmd(fs.Args()[1:])
+	case "show":
+		return sessionsShowCmd(fs.Args()[1:])
+	}
+
+	run, ok := subcommands[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown subcommand %q", fs.Arg(0))
+	}
+
+	if *addr == "" || *token == "" {
+		return errors.New("the pot's web_addr and api_token or api_control_token are required, from the config file or -addr and -token")
+	}
+
+	return run(newPotClient(*addr, *token), fs.Args()[1:])
+}
+
+func newPotClient(addr string, token string) *potClient {
+	// A listen address like ":9100" means the local machine.
+	if host, port, err := net.SplitHostPort(addr); err == nil && (host == "" || host == "0.0.0.0" || host == "::") {
+		addr = net.JoinHostPort("127.0.0.1", port)
+	}
+
+	return &potClient{base: "http://" + addr + api.Prefix, token: token}
+}
+
+func (c *potClient) do(ctx context.Context, method string, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		apiErr := map[string]string{}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr["error"] != "" {
+			return nil, errors.New(apiErr["error"])
+		}
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (c *potClient) active() ([]entity.Session, error) {
+	resp, err := c.do(context.Background(), http.MethodGet, "/sessions/active", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	sessions := []entity.Session{}
+	return sessions, json.NewDecoder(resp.Body).Decode(&sessions)
+}
+
+// resolve expands a session ID prefix to the full ID of an active session.
+func (c *potClient) resolve(prefix string) (string, error) {
+	sessions, err := c.active()
+	if err != nil {
+		return "", err
+	}
+
+	found := ""
+	for _, s := range sessions {
+		if strings.HasPrefix(s.ID, prefix) {
+			if found != "" {
+				return "", fmt.Errorf("session ID %q is ambiguous", prefix)
+			}
+			found = s.ID
+		}
+	}
+
+	if found == "" {
+		return "", fmt.Errorf("no active session matches %q", prefix)
+	}
+
+	return found, nil
+}
+
+func sessionsActiveCmd(c *potClient, args []string) error {
+	sessions, err := c.active()
+	if err != nil {
+		return err
+	}
+
+	if len(sessions) == 0 {
+		fmt.Println("No active sessions.")
+		return nil
+	}
+
+	for _, s := range sessions {
+		fmt.Printf("%-12s %-16s %-24s %-10s %s\n", s.ID[:min(12, len(s.ID))], s.User, s.Host, s.Duration().Round(time.Second), s.ClientVersion)
+	}
+
+	return nil
+}
+
+func sessionsListCmd(args []string) error {
+	fs := flag.NewFlagSet("sessions list", flag.ContinueOnError)
+	n := fs.Int("n", 20, "How many sessions to list, newest first")
+	since := fs.String("since", "", "Only sessions started at or after this time (RFC3339, YYYY-MM-DD, or an age like 7d or 12h)")
+	user := fs.String("user", "", "Only sessions for this username")
+	ip := fs.String("ip", "", "Only sessions from this remote IP")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := stats.Filter{User: *user, IP: *ip}
+	var err error
+	if filter.Since, err = stats.ParseTime(*since); err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+
+	res, err := stats.Sessions(filter, stats.Page{Limit: *n})
+	if err != nil {
+		return err
+	}
+
+	if len(res.Items) == 0 {
+		fmt.Println("No sessions.")
+		return nil
+	}
+
+	for _, s := range res.Items {
+		fmt.Printf("%-12s %-19s %-16s %-24s %-10s %4d cmds  %s\n",
+			s.ID[:min(12, len(s.ID))], s.StartedAt.Local().Format(time.DateTime), s.User, s.Host,
+			s.Duration().Round(time.Second), s.Commands, s.ClientVersion)
+	}
+	if res.Total > len(res.Items) {
+		fmt.Printf("%d of %d sessions shown.\n", len(res.Items), res.Total)
+	}
+
+	return nil
+}
+
+func sessionsShowCmd(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: sessions show <id>")
+	}
+
+	s, err := stats.SessionByPrefix(args[0])
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return fmt.Errorf("no session matches %q", args[0])
+	}
+
+	ended := "still connected"
+	if s.EndedAt != nil {
+		ended = s.EndedAt.Local().Format(time.DateTime)
+	}
+
+	fmt.Printf("Session   %s\n", s.ID)
+	fmt.Printf("User      %s\n", s.User)
+	fmt.Printf("Host      %s\n", s.Host)
+	fmt.Printf("App       %s\n", s.App)
+	fmt.Printf("Client    %s\n", s.ClientVersion)
+	fmt.Printf("HASSH     %s\n", s.HASSH)
+	fmt.Printf("Port      %d\n", s.LocalPort)
+	fmt.Printf("Terminal  %s\n", s.Term)
+	fmt.Printf("Started   %s\n", s.StartedAt.Local().Format(time.DateTime))
+	fmt.Printf("Ended     %s\n", ended)
+	fmt.Printf("Duration  %s\n", s.Duration().Round(time.Second))
+	fmt.Printf("Commands  %d\n\n", s.Commands)
+
+	res, err := stats.Events(stats.Filter{Session: s.ID}, stats.Page{Limit: stats.MaxLimit})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range slices.Backward(res.Items) {
+		printEvent(e)
+	}
+	if res.Total > len(res.Items) {
+		fmt.Printf("Latest %d of %d events shown.\n", len(res.Items), res.Total)
+	}
+
+	return nil
+}
+
+func sessionsWatchCmd(c *potClient, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: sessions watch <id>")
+	}
+
+	id, err := c.resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	resp, err := c.do(ctx, http.MethodGet, "/sessions/"+id+"/watch", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	fmt.Fprintf(os.Stderr, "Watching %s (%sx%s). Ctrl-C to stop.\n",
+		id[:12], resp.Header.Get("X-Terminal-Width"), resp.Header.Get("X-Terminal-Height"))
+	time.Sleep(time.Second)
+	fmt.Print("\x1b[2J\x1b[H")
+
+	_, err = io.Copy(os.Stdout, resp.Body)
+
+	// The session's program hides the cursor, so bring it back.
+	fmt.Print("\x1b[?25h\r\n")
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, "Session ended.")
+	return err
+}
+
+func sessionsWallCmd(c *potClient, args []string) error {
+	return sessionsControl(c, "wall", args, "message")
+}
+
+func sessionsSayCmd(c *potClient, args []string) error {
+	return sessionsControl(c, "say", args, "message")
+}
+
+func sessionsTypeCmd(c *potClient, args []string) error {
+	return sessionsControl(c, "type", args, "command")
+}
+
+func sessionsControl(c *potClient, action string, args []string, field string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: sessions %s <id> <%s>", action, field)
+	}
+
+	id, err := c.resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(context.Background(), http.MethodPost, "/sessions/"+id+"/"+action, map[string]string{
+		field: strings.Join(args[1:], " "),
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func sessionsKickCmd(c *potClient, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: sessions kick <id>")
+	}
+
+	id, err := c.resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(context.Background(), http.MethodPost, "/sessions/"+id+"/kick", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	fmt.Println("Session kicked.")
+	return nil
+}
+
+func sessionsBanCmd(c *potClient, args []string) error {
+	fs := flag.NewFlagSet("sessions ban", flag.ContinueOnError)
+	duration := fs.String("for", "forever", "How long the ban lasts, e.g. 12h or 7d")
+	reason := fs.String("reason", "", "Why, for the ban list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: sessions ban [-for D] [-reason R] <id>")
+	}
+
+	id, err := c.resolve(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(context.Background(), http.MethodPost, "/sessions/"+id+"/ban", map[string]string{
+		"duration": *duration,
+		"reason":   *reason,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	ban := entity.Ban{}
+	if err := json.NewDecoder(resp.Body).Decode(&ban); err != nil {
+		return err
+	}
+
+	fmt.Printf("Banned %s (#%d) until %s.\n", ban.Value, ban.ID, banExpiry(ban))
+	return nil
+}
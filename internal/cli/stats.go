@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/stats"
+)
+
+// statsReport is everything the stats command shows, as printed with -json.
+type statsReport struct {
+	LoginsAllTime int                      `json:"logins_all_time"`
+	Logins        []stats.LoginCount       `json:"logins"`
+	TopCommands   []*entity.EventCount     `json:"top_commands"`
+	RareCommands  []*entity.EventCount     `json:"rare_commands"`
+	TopUsers      []*entity.EventCount     `json:"top_users"`
+	Leaderboard   []stats.LeaderboardEntry `json:"leaderboard"`
+}
+
+func statsCmd(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	limit := fs.Int("n", 10, "How many commands, users and players to list")
+	asJSON := fs.Bool("json", false, "Print the stats as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	r := statsReport{}
+	var err error
+	if r.LoginsAllTime, err = stats.LoginsAllTime(); err != nil {
+		return err
+	}
+	if r.Logins, err = stats.LoginCounts(); err != nil {
+		return err
+	}
+	if r.TopCommands, err = stats.TopCommands(*limit); err != nil {
+		return err
+	}
+	if r.RareCommands, err = stats.RareCommands(*limit); err != nil {
+		return err
+	}
+	if r.TopUsers, err = stats.TopUsers(*limit); err != nil {
+		return err
+	}
+	if r.Leaderboard, err = stats.Leaderboard(*limit); err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	fmt.Printf("Logins (all time)  %d\n", r.LoginsAllTime)
+	for _, c := range r.Logins {
+		fmt.Printf("Logins (%s)        %d\n", c.Window, c.Count)
+	}
+
+	printCounts("Top commands", r.TopCommands)
+	printCounts("Rare commands", r.RareCommands)
+	printCounts("Top users", r.TopUsers)
+
+	fmt.Println("\nCTF leaderboard")
+	if len(r.Leaderboard) == 0 {
+		fmt.Println("  No one has scored yet.")
+	}
+	for _, e := range r.Leaderboard {
+		fmt.Printf("  %3d. %-24s %5d pts  %d tasks\n", e.Rank, e.Username, e.Points, e.Tasks)
+	}
+
+	return nil
+}
+
+func printCounts(title string, counts []*entity.EventCount) {
+	fmt.Println("\n" + title)
+	if len(counts) == 0 {
+		fmt.Println("  None yet.")
+	}
+	for _, c := range counts {
+		fmt.Printf("  %6d  %s\n", c.Count, c.Value)
+	}
+}
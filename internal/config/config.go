@@ -2,9 +2,15 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"net"
 	"os"
+	"reflect"
+	"slices"
 	"strings"
+	"sync/atomic"
 
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/filesystem"
 )
@@ -16,6 +22,153 @@ type Task struct {
 	Points      int    `json:"points"`
 }
 
+// RetentionRule overrides the global retention limits for one event type.
+type RetentionRule struct {
+	Type       string `json:"type"`
+	MaxAgeDays int    `json:"max_age_days,omitempty"`
+	MaxRows    int    `json:"max_rows,omitempty"`
+}
+
+// Retention controls how long events are kept in the database.
+type Retention struct {
+	MaxAgeDays      int             `json:"max_age_days,omitempty"`     // Delete events older than this many days.
+	MaxRows         int             `json:"max_rows,omitempty"`         // Keep at most this many events.
+	Rules           []RetentionRule `json:"rules,omitempty"`            // Per event type limits.
+	Rollup          bool            `json:"rollup,omitempty"`           // Aggregate events into daily totals before deleting them.
+	IntervalMinutes int             `json:"interval_minutes,omitempty"` // How often the pruning job runs.
+}
+
+// SyslogSink forwards events to a syslog collector using RFC 5424.
+type SyslogSink struct {
+	Network       string   `json:"network,omitempty"`         // udp (default), tcp or tls
+	Address       string   `json:"address"`                   // host:port of the collector
+	Format        string   `json:"format,omitempty"`          // json (default), cef or leef
+	Facility      string   `json:"facility,omitempty"`        // Syslog facility name (default local0)
+	AppName       string   `json:"app_name,omitempty"`        // APP-NAME field (default honeybear)
+	Hostname      string   `json:"hostname,omitempty"`        // HOSTNAME field (default os.Hostname)
+	Types         []string `json:"types,omitempty"`           // Only forward these event types
+	TLSCAFile     string   `json:"tls_ca_file,omitempty"`     // CA bundle for verifying a TLS collector
+	TLSSkipVerify bool     `json:"tls_skip_verify,omitempty"` // Don't verify the collector's certificate
+}
+
+// WebhookSink POSTs events to an HTTP endpoint.
+type WebhookSink struct {
+	URL            string            `json:"url"`
+	Method         string            `json:"method,omitempty"`          // HTTP method (default POST)
+	Types          []string          `json:"types,omitempty"`           // Only send these event types
+	Template       string            `json:"template,omitempty"`        // Go template for the request body
+	TemplateFile   string            `json:"template_file,omitempty"`   // File holding the body template
+	ContentType    string            `json:"content_type,omitempty"`    // Content-Type header (default application/json)
+	Headers        map[string]string `json:"headers,omitempty"`         // Extra request headers
+	HMACSecret     string            `json:"hmac_secret,omitempty"`     // Sign bodies with HMAC-SHA256 using this secret
+	HMACHeader     string            `json:"hmac_header,omitempty"`     // Signature header (default X-HoneyBear-Signature)
+	BatchSeconds   int               `json:"batch_seconds,omitempty"`   // Collect events for this long before sending (0 sends each event)
+	BatchSize      int               `json:"batch_size,omitempty"`      // Most events per request (default 100)
+	MaxRetries     int               `json:"max_retries,omitempty"`     // Attempts before spooling to disk (default 5)
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"` // Request timeout (default 10)
+	SpoolDir       string            `json:"spool_dir,omitempty"`       // Where undeliverable requests wait (default in the app directory)
+}
+
+// Tunnel is a reverse tunnel through a remote SSH server. Settings it leaves
+// out fall back to the top level tunnel_* settings.
+type Tunnel struct {
+	Name             string   `json:"name,omitempty"`              // Shown in the tunnel status (default the server's host)
+	Server           string   `json:"server"`                      // user@host or user@host:port
+	Key              string   `json:"key,omitempty"`               // Private key (default tunnel_key)
+	RemoteBind       string   `json:"remote_bind,omitempty"`       // Address to listen on at the server (default tunnel_remote_bind)
+	RemotePort       string   `json:"remote_port,omitempty"`       // Port to listen on at the server (default tunnel_remote_port)
+	Target           string   `json:"target,omitempty"`            // ssh (the first port, default), ssh:PORT, web or admin
+	KnownHosts       string   `json:"known_hosts,omitempty"`       // known_hosts file (default tunnel_known_hosts)
+	StrictHostKey    bool     `json:"strict_host_key,omitempty"`   // Refuse servers whose key can't be checked
+	HostKeys         []string `json:"host_keys,omitempty"`         // Pinned SHA256 fingerprints (default tunnel_host_keys)
+	KeepaliveSeconds int      `json:"keepalive_seconds,omitempty"` // Seconds between keepalives, -1 for none (default tunnel_keepalive_seconds)
+	KeepaliveMax     int      `json:"keepalive_max,omitempty"`     // Missed keepalives before reconnecting (default tunnel_keepalive_max)
+	ProxyProtocol    string   `json:"proxy_protocol,omitempty"`    // Send the attacker's address in a PROXY header, v1 or v2 (default tunnel_proxy_protocol)
+}
+
+// AuthPolicy decides which logins a persona accepts. Bans and the user limit
+// apply either way.
+type AuthPolicy struct {
+	Accept      string   `json:"accept,omitempty"`      // any (default), listed or none
+	Credentials []string `json:"credentials,omitempty"` // user:password pairs accepted by listed, where * matches anything
+	FailFirst   int      `json:"fail_first,omitempty"`  // Reject this many attempts on each connection before accepting
+}
+
+// Ways an AuthPolicy accepts logins.
+const (
+	AuthAcceptAny    = "any"
+	AuthAcceptListed = "listed"
+	AuthAcceptNone   = "none"
+)
+
+// Machine is what uname reports for a persona.
+type Machine struct {
+	KernelName    string `json:"kernel_name,omitempty"`    // uname -s
+	KernelRelease string `json:"kernel_release,omitempty"` // uname -r
+	KernelVersion string `json:"kernel_version,omitempty"` // uname -v
+	Arch          string `json:"arch,omitempty"`           // uname -m
+	OS            string `json:"os,omitempty"`             // uname -o
+}
+
+// HTTPApp is a fake web app served by the HTTP honey pot.
+type HTTPApp struct {
+	Paths        []string `json:"paths"`                   // Request paths it's served at. A trailing * matches anything after it.
+	Template     string   `json:"template,omitempty"`      // Built-in template: router, phpmyadmin, wordpress, env or git-config
+	TemplateFile string   `json:"template_file,omitempty"` // Path to a template of its own, instead of a built-in one
+	ContentType  string   `json:"content_type,omitempty"`  // Content-Type header (default from the template's extension)
+	Status       int      `json:"status,omitempty"`        // Response status (default 200)
+}
+
+// HTTPPageData is what an HTTP app's template can use.
+type HTTPPageData struct {
+	Hostname   string // The persona's hostname
+	Server     string // The Server header sent
+	Host       string // Host the client asked for
+	Path       string // Path the client asked for
+	Port       string // Port the client connected to
+	RemoteAddr string // Client's address
+	User       string // Username just posted to a login form
+	Failed     bool   // A login was just posted, and turned down
+}
+
+// Persona is how the pot presents itself on the ports mapped to it, so
+// different ports can look like different machines. Settings it leaves out
+// are the same as on ports without a persona.
+type Persona struct {
+	Name              string            `json:"name"`
+	Ports             []string          `json:"ports"`                         // ssh_ports, telnet_ports and http_ports that use this persona
+	ServerVersion     string            `json:"server_version,omitempty"`      // SSH version after "SSH-2.0-". Ex: OpenSSH_8.9p1 Ubuntu-3ubuntu0.10
+	KexAlgorithms     []string          `json:"kex_algorithms,omitempty"`      // Key exchanges to offer, in order (default the SSH library's)
+	Ciphers           []string          `json:"ciphers,omitempty"`             // Ciphers to offer, in order
+	MACs              []string          `json:"macs,omitempty"`                // MACs to offer, in order
+	HostKeyAlgorithms []string          `json:"host_key_algorithms,omitempty"` // Host key algorithms to offer, which also picks the host keys (default every key)
+	Banner            string            `json:"banner,omitempty"`              // Template for the banner shown before login (default the built-in banner)
+	NoBanner          bool              `json:"no_banner,omitempty"`           // Show no banner before login
+	Hostname          string            `json:"hostname,omitempty"`            // Shown by hostname and uname -n
+	OSRelease         string            `json:"os_release,omitempty"`          // Contents of /etc/os-release, which lsb_release reads too
+	Machine           *Machine          `json:"machine,omitempty"`             // What uname reports
+	Filesystem        []filesystem.Node `json:"filesystem,omitempty"`          // Added after the top level filesystem nodes
+	Commands          []string          `json:"commands,omitempty"`            // Built-in commands to install (default all)
+	Auth              *AuthPolicy       `json:"auth,omitempty"`                // Which logins to accept (default any)
+	Tasks             []Task            `json:"tasks,omitempty"`               // CTF tasks (default tasks)
+	HTTPServer        string            `json:"http_server,omitempty"`         // Server header on HTTP ports (default http_server)
+	HTTPApps          []HTTPApp         `json:"http_apps,omitempty"`           // Fake web apps on HTTP ports (default http_apps)
+}
+
+// BannerData is what a persona's banner template can use.
+type BannerData struct {
+	User       string // Username the client is logging in as
+	Hostname   string // The persona's hostname
+	Port       string // Port the client connected to
+	RemoteAddr string // Client's address
+}
+
+// Sinks configures where events are sent besides the local database.
+type Sinks struct {
+	Syslog   []SyslogSink  `json:"syslog,omitempty"`
+	Webhooks []WebhookSink `json:"webhooks,omitempty"`
+}
+
 type Config struct {
 	SSHPorts   []string          `json:"ssh_ports,omitempty"`
 	Tunnel     string            `json:"tunnel,omitempty"`
@@ -28,89 +181,306 @@ type Config struct {
 	Filesystem []filesystem.Node `json:"filesystem,omitempty"`
 	Tasks      []Task            `json:"tasks,omitempty"`
 	PinReset   string            `json:"pin,omitempty"`
+	Retention  *Retention        `json:"retention,omitempty"`
+	Sinks      *Sinks            `json:"sinks,omitempty"`
+	WebAddr    string            `json:"web_addr,omitempty"`
+	APIToken   string            `json:"api_token,omitempty"`
+	Dashboard  bool              `json:"dashboard,omitempty"`
+
+	APIControlToken string `json:"api_control_token,omitempty"` // Token for the API routes that change the pot, like kick and ban (default off)
+
+	AdminSSHAddr        string `json:"admin_ssh_addr,omitempty"`        // Address for the operator console
+	AdminAuthorizedKeys string `json:"admin_authorized_keys,omitempty"` // Operator public keys (default .ssh/admin_authorized_keys in the app directory)
+	TunnelAdminPort     string `json:"tunnel_admin_port,omitempty"`     // Remote port the tunnel forwards to the operator console
+
+	TunnelRemoteBind    string   `json:"tunnel_remote_bind,omitempty"`       // Address the tunnel listens on at the remote server
+	TunnelRemotePort    string   `json:"tunnel_remote_port,omitempty"`       // Port the tunnel listens on at the remote server
+	TunnelKnownHosts    string   `json:"tunnel_known_hosts,omitempty"`       // known_hosts file to check the remote server's key against
+	TunnelStrictHostKey bool     `json:"tunnel_strict_host_key,omitempty"`   // Refuse servers whose key isn't in known_hosts or pinned
+	TunnelHostKeys      []string `json:"tunnel_host_keys,omitempty"`         // Pinned SHA256 fingerprints of the remote server's key
+	TunnelKeepalive     int      `json:"tunnel_keepalive_seconds,omitempty"` // Seconds between keepalives, -1 for none
+	TunnelKeepaliveMax  int      `json:"tunnel_keepalive_max,omitempty"`     // Missed keepalives before the tunnel reconnects
+	Tunnels             []Tunnel `json:"tunnels,omitempty"`                  // More tunnels, each with its own server and target
+	TunnelProxyProtocol string   `json:"tunnel_proxy_protocol,omitempty"`    // Send the attacker's address to the pot in a PROXY header, v1 or v2
+
+	ProxyProtocolPorts   []string `json:"proxy_protocol_ports,omitempty"`   // Ports whose connections start with a PROXY header
+	ProxyProtocolTrusted []string `json:"proxy_protocol_trusted,omitempty"` // Addresses or CIDRs allowed to send PROXY headers (default loopback)
+
+	Personas []Persona `json:"personas,omitempty"` // How the pot presents itself on particular ports
+
+	TelnetPorts []string `json:"telnet_ports,omitempty"` // Ports for telnet connections, which get the same shell as SSH (default none)
+
+	HTTPPorts  []string  `json:"http_ports,omitempty"`  // Ports for the HTTP honey pot (default none)
+	HTTPServer string    `json:"http_server,omitempty"` // Server header the HTTP honey pot sends
+	HTTPApps   []HTTPApp `json:"http_apps,omitempty"`   // Fake web apps the HTTP honey pot serves
+
+	ForwardSinkhole bool `json:"forward_sinkhole,omitempty"` // Pretend to allow port, agent and X11 forwarding, without relaying anything
+
+	WatchConfig bool `json:"watch_config,omitempty"` // Reload when the config file changes, as well as on SIGHUP
 }
 
 var (
-	configPath    = flag.String("config", "", "Path to optional JSON config file")
-	noGuiFlag     = flag.Bool("no-gui", false, "Run the honey pot without the GUI")
-	fullScreen    = flag.Bool("fs", false, "Start the gui in full screen mode")
-	sshPort       = flag.String("ssh-port", "", "The port to listen on for honey pot SSH connections. Comma separated list for multiple ports.")
-	widthFlag     = flag.Int("width", 0, "The width of the GUI window")
-	heightFlag    = flag.Int("height", 0, "The height of the GUI window")
-	logLevelFlag  = flag.String("log-level", "", "Log level (debug, info, warn, error, fatal)")
-	pinResetFlag  = flag.String("pin-reset", "", "Reset the admin PIN to a specific value")
-	tunnelHost    = flag.String("tunnel", "", "The user and host to connect to via SSH. Ex: user@server.com:22")
-	tunnelKeyFlag = flag.String("tunnel-key", "", "The SSH key to use to connect to the specified remote host.")
+	configPath     = flag.String("config", "", "Path to an optional JSON, YAML or TOML config file")
+	noGuiFlag      = flag.Bool("no-gui", false, "Run the honey pot without the GUI")
+	fullScreen     = flag.Bool("fs", false, "Start the gui in full screen mode")
+	sshPort        = flag.String("ssh-port", "", "The port to listen on for honey pot SSH connections. Comma separated list for multiple ports.")
+	telnetPort     = flag.String("telnet-port", "", "The port to listen on for honey pot telnet connections. Comma separated list for multiple ports.")
+	httpPort       = flag.String("http-port", "", "The port to listen on for honey pot HTTP requests. Comma separated list for multiple ports.")
+	widthFlag      = flag.Int("width", 0, "The width of the GUI window")
+	heightFlag     = flag.Int("height", 0, "The height of the GUI window")
+	logLevelFlag   = flag.String("log-level", "", "Log level (debug, info, warn, error, fatal)")
+	pinResetFlag   = flag.String("pin-reset", "", "Reset the admin PIN to a specific value")
+	tunnelHost     = flag.String("tunnel", "", "The user and host to connect to via SSH. Ex: user@server.com:22")
+	tunnelKeyFlag  = flag.String("tunnel-key", "", "The SSH key to use to connect to the specified remote host.")
+	tunnelBindFlag = flag.String("tunnel-remote-bind", "", "Address the tunnel listens on at the remote host. Ex: 0.0.0.0")
+	tunnelPortFlag = flag.String("tunnel-remote-port", "", "Port the tunnel listens on at the remote host")
+	knownHostsFlag = flag.String("tunnel-known-hosts", "", "known_hosts file to check the remote host's key against")
+	strictHostFlag = flag.Bool("tunnel-strict-host-key", false, "Refuse to connect unless the remote host's key is in known_hosts or pinned")
+	webAddrFlag    = flag.String("web-addr", "", "Address for the admin web server, which serves Prometheus metrics at /metrics. Ex: :9100")
+	dashboardFlag  = flag.Bool("dashboard", false, "Serve the PIN protected browser dashboard from the admin web server")
+	adminSSHFlag   = flag.String("admin-ssh-addr", "", "Address for the operator SSH console, which only accepts keys in admin_authorized_keys. Ex: 127.0.0.1:2222")
+	watchFlag      = flag.Bool("watch-config", false, "Reload the config file when it changes, as well as on SIGHUP")
 )
 
-// Active holds the configuration loaded via Parse so it can be referenced by
-// other packages at runtime.
-var Active *Config
+// active holds the configuration loaded via Parse, and swapped by Activate
+// on reload, so it can be referenced by other packages at runtime.
+var active atomic.Pointer[Config]
+
+// Current returns the configuration in effect, or nil before Parse.
+func Current() *Config {
+	return active.Load()
+}
+
+// Activate makes cfg the current configuration and returns the one it
+// replaced.
+func Activate(cfg *Config) *Config {
+	return active.Swap(cfg)
+}
+
+// Path returns the config file given with -config, if any.
+func Path() string {
+	return *configPath
+}
 
 // Default contains the base configuration values used when no CLI flags or config file options are provided.
 var Default = Config{
-	SSHPorts: []string{"1337"},
-	LogLevel: "info",
+	SSHPorts:           []string{"1337"},
+	LogLevel:           "info",
+	TunnelRemoteBind:   "127.0.0.1",
+	TunnelRemotePort:   "8022",
+	TunnelKeepalive:    30,
+	TunnelKeepaliveMax: 3,
+	HTTPServer:         "Apache/2.4.41 (Ubuntu)",
+	HTTPApps: []HTTPApp{
+		{Paths: []string{"/", "/login.htm", "/cgi-bin/luci"}, Template: "router"},
+		{Paths: []string{"/phpmyadmin/*", "/phpMyAdmin/*", "/pma/*"}, Template: "phpmyadmin"},
+		{Paths: []string{"/wp-login.php", "/wp-admin/*"}, Template: "wordpress"},
+		{Paths: []string{"/.env"}, Template: "env"},
+		{Paths: []string{"/.git/config"}, Template: "git-config"},
+	},
 }
 
+// Load reads a JSON, YAML or TOML config file, chosen by its extension
+// (.json, .yaml or .yml, .toml; anything else is read as JSON). Unknown
+// settings and values of the wrong type are reported as Problems with their
+// JSON paths, whatever the format.
 func Load(path string) (*Config, error) {
+	c, _, err := loadFile(path)
+	return c, err
+}
+
+// loadFile reads a config file, also returning the top level settings it
+// sets. The config is returned along with Problems for unknown settings, so
+// the caller can go on to report everything wrong at once.
+func loadFile(path string) (*Config, map[string]bool, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if data, err = toJSON(path, data); err != nil {
+		return nil, nil, err
 	}
+
+	raw := map[string]any{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, decodeProblem(data, err)
+	}
+
 	var c Config
 	if err := json.Unmarshal(data, &c); err != nil {
-		return nil, err
+		return nil, nil, decodeProblem(data, err)
 	}
-	return &c, nil
+
+	set := map[string]bool{}
+	for key := range raw {
+		if f, ok := fieldByName(reflect.TypeOf(c), key); ok {
+			set[jsonName(f)] = true
+		}
+	}
+
+	problems := unknownFields(raw, reflect.TypeOf(c), "$")
+	if len(problems) > 0 {
+		return &c, set, problems
+	}
+
+	return &c, set, nil
 }
 
-// Parse reads CLI flags and an optional JSON configuration file, returning the
-// merged settings along with the value of the pin reset flag.
+// Sources says where each setting's value came from: "default", "file", the
+// environment variable or the flag that set it.
+type Sources map[string]string
+
+// Parse reads CLI flags, HBHP_* environment variables and an optional config
+// file, returning the merged settings along with the value of the pin reset
+// flag. Flags win over the environment, which wins over the file.
 func Parse() (*Config, string, error) {
 	flag.Parse()
 
+	cfg, err := Reload()
+	if err != nil {
+		return nil, "", err
+	}
+
+	Activate(cfg)
+	return cfg, cfg.PinReset, nil
+}
+
+// Reload reads the config file again and applies the environment and CLI
+// flags over it, the same way Parse does, and validates the result. It doesn't change the
+// current configuration; see Activate.
+func Reload() (*Config, error) {
+	cfg, _, err := Effective()
+	return cfg, err
+}
+
+// Effective builds the configuration from the defaults, the config file, the
+// environment and the CLI flags, and says where each setting came from.
+func Effective() (*Config, Sources, error) {
+	return build(*configPath, true)
+}
+
+// Check reads a config file on its own, without the environment or CLI
+// flags, and validates it.
+func Check(path string) (*Config, error) {
+	cfg, _, err := build(path, false)
+	return cfg, err
+}
+
+func build(path string, withOverrides bool) (*Config, Sources, error) {
 	cfg := Default
+	sources := Sources{}
+	for _, f := range reflect.VisibleFields(reflect.TypeOf(cfg)) {
+		sources[jsonName(f)] = "default"
+	}
 
-	if *configPath != "" {
-		loaded, err := Load(*configPath)
-		if err != nil {
-			return nil, "", err
+	var problems Problems
+	if path != "" {
+		loaded, set, err := loadFile(path)
+		if !errors.As(err, &problems) && err != nil {
+			return nil, nil, err
+		}
+		if loaded == nil {
+			return nil, nil, problems
 		}
 		merge(&cfg, loaded)
+		for name := range set {
+			sources[name] = "file"
+		}
+	}
+
+	if withOverrides {
+		problems = append(problems, applyEnv(&cfg, sources)...)
+		applyFlags(&cfg, sources)
 	}
 
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, nil, problems
+	}
+
+	return &cfg, sources, nil
+}
+
+// applyFlags sets what was given on the command line over the config file.
+func applyFlags(cfg *Config, sources Sources) {
 	if *sshPort != "" {
 		cfg.SSHPorts = strings.Split(*sshPort, ",")
+		sources["ssh_ports"] = "flag -ssh-port"
+	}
+	if *telnetPort != "" {
+		cfg.TelnetPorts = strings.Split(*telnetPort, ",")
+		sources["telnet_ports"] = "flag -telnet-port"
+	}
+	if *httpPort != "" {
+		cfg.HTTPPorts = strings.Split(*httpPort, ",")
+		sources["http_ports"] = "flag -http-port"
 	}
 	if *tunnelHost != "" {
 		cfg.Tunnel = *tunnelHost
+		sources["tunnel"] = "flag -tunnel"
 	}
 	if *tunnelKeyFlag != "" {
 		cfg.TunnelKey = *tunnelKeyFlag
+		sources["tunnel_key"] = "flag -tunnel-key"
+	}
+	if *tunnelBindFlag != "" {
+		cfg.TunnelRemoteBind = *tunnelBindFlag
+		sources["tunnel_remote_bind"] = "flag -tunnel-remote-bind"
+	}
+	if *tunnelPortFlag != "" {
+		cfg.TunnelRemotePort = *tunnelPortFlag
+		sources["tunnel_remote_port"] = "flag -tunnel-remote-port"
+	}
+	if *knownHostsFlag != "" {
+		cfg.TunnelKnownHosts = *knownHostsFlag
+		sources["tunnel_known_hosts"] = "flag -tunnel-known-hosts"
+	}
+	if *strictHostFlag {
+		cfg.TunnelStrictHostKey = true
+		sources["tunnel_strict_host_key"] = "flag -tunnel-strict-host-key"
 	}
 	if *noGuiFlag {
 		cfg.NoGUI = true
+		sources["no_gui"] = "flag -no-gui"
 	}
 	if *fullScreen {
 		cfg.FullScreen = true
+		sources["full_screen"] = "flag -fs"
 	}
 	if *widthFlag != 0 {
 		cfg.Width = *widthFlag
+		sources["width"] = "flag -width"
 	}
 	if *heightFlag != 0 {
 		cfg.Height = *heightFlag
+		sources["height"] = "flag -height"
 	}
 	if *logLevelFlag != "" {
 		cfg.LogLevel = *logLevelFlag
+		sources["log_level"] = "flag -log-level"
+	}
+
+	if *webAddrFlag != "" {
+		cfg.WebAddr = *webAddrFlag
+		sources["web_addr"] = "flag -web-addr"
+	}
+	if *dashboardFlag {
+		cfg.Dashboard = true
+		sources["dashboard"] = "flag -dashboard"
+	}
+	if *adminSSHFlag != "" {
+		cfg.AdminSSHAddr = *adminSSHFlag
+		sources["admin_ssh_addr"] = "flag -admin-ssh-addr"
+	}
+	if *watchFlag {
+		cfg.WatchConfig = true
+		sources["watch_config"] = "flag -watch-config"
 	}
 
 	if *pinResetFlag != "" {
 		cfg.PinReset = *pinResetFlag
+		sources["pin"] = "flag -pin-reset"
 	}
-
-	Active = &cfg
-	return Active, cfg.PinReset, nil
 }
 
 func merge(dst *Config, src *Config) {
@@ -144,4 +514,185 @@ func merge(dst *Config, src *Config) {
 	if src.Tasks != nil {
 		dst.Tasks = src.Tasks
 	}
+	if src.PinReset != "" {
+		dst.PinReset = src.PinReset
+	}
+	if src.Retention != nil {
+		dst.Retention = src.Retention
+	}
+	if src.Sinks != nil {
+		dst.Sinks = src.Sinks
+	}
+	if src.WebAddr != "" {
+		dst.WebAddr = src.WebAddr
+	}
+	if src.APIToken != "" {
+		dst.APIToken = src.APIToken
+	}
+	if src.APIControlToken != "" {
+		dst.APIControlToken = src.APIControlToken
+	}
+	if src.Dashboard {
+		dst.Dashboard = true
+	}
+	if src.AdminSSHAddr != "" {
+		dst.AdminSSHAddr = src.AdminSSHAddr
+	}
+	if src.AdminAuthorizedKeys != "" {
+		dst.AdminAuthorizedKeys = src.AdminAuthorizedKeys
+	}
+	if src.TunnelAdminPort != "" {
+		dst.TunnelAdminPort = src.TunnelAdminPort
+	}
+	if src.TunnelRemoteBind != "" {
+		dst.TunnelRemoteBind = src.TunnelRemoteBind
+	}
+	if src.TunnelRemotePort != "" {
+		dst.TunnelRemotePort = src.TunnelRemotePort
+	}
+	if src.TunnelKnownHosts != "" {
+		dst.TunnelKnownHosts = src.TunnelKnownHosts
+	}
+	if src.TunnelStrictHostKey {
+		dst.TunnelStrictHostKey = true
+	}
+	if src.TunnelHostKeys != nil {
+		dst.TunnelHostKeys = src.TunnelHostKeys
+	}
+	if src.TunnelKeepalive != 0 {
+		dst.TunnelKeepalive = src.TunnelKeepalive
+	}
+	if src.TunnelKeepaliveMax != 0 {
+		dst.TunnelKeepaliveMax = src.TunnelKeepaliveMax
+	}
+	if src.Tunnels != nil {
+		dst.Tunnels = src.Tunnels
+	}
+	if src.TunnelProxyProtocol != "" {
+		dst.TunnelProxyProtocol = src.TunnelProxyProtocol
+	}
+	if src.ProxyProtocolPorts != nil {
+		dst.ProxyProtocolPorts = src.ProxyProtocolPorts
+	}
+	if src.ProxyProtocolTrusted != nil {
+		dst.ProxyProtocolTrusted = src.ProxyProtocolTrusted
+	}
+	if src.Personas != nil {
+		dst.Personas = src.Personas
+	}
+	if src.TelnetPorts != nil {
+		dst.TelnetPorts = src.TelnetPorts
+	}
+	if src.HTTPPorts != nil {
+		dst.HTTPPorts = src.HTTPPorts
+	}
+	if src.HTTPServer != "" {
+		dst.HTTPServer = src.HTTPServer
+	}
+	if src.HTTPApps != nil {
+		dst.HTTPApps = src.HTTPApps
+	}
+	if src.ForwardSinkhole {
+		dst.ForwardSinkhole = true
+	}
+	if src.WatchConfig {
+		dst.WatchConfig = true
+	}
+}
+
+// PersonaFor returns the persona for connections on port, or nil if it
+// doesn't have one.
+func (c *Config) PersonaFor(port string) *Persona {
+	for i := range c.Personas {
+		if slices.Contains(c.Personas[i].Ports, port) {
+			return &c.Personas[i]
+		}
+	}
+
+	return nil
+}
+
+// AllTunnels returns every configured tunnel with its defaults filled in:
+// the one set with tunnel and tunnel_key first, if any, then tunnels.
+func (c *Config) AllTunnels() []Tunnel {
+	var all []Tunnel
+	if c.Tunnel != "" {
+		all = append(all, Tunnel{Server: c.Tunnel, Target: TunnelTargetSSH})
+	}
+	all = append(all, c.Tunnels...)
+
+	for i := range all {
+		t := &all[i]
+		if t.Name == "" {
+			t.Name = serverHost(t.Server)
+		}
+		if t.Key == "" {
+			t.Key = c.TunnelKey
+		}
+		if t.RemoteBind == "" {
+			t.RemoteBind = c.TunnelRemoteBind
+		}
+		if t.RemotePort == "" {
+			t.RemotePort = c.TunnelRemotePort
+		}
+		if t.Target == "" {
+			t.Target = TunnelTargetSSH
+		}
+		if t.KnownHosts == "" {
+			t.KnownHosts = c.TunnelKnownHosts
+		}
+		if c.TunnelStrictHostKey {
+			t.StrictHostKey = true
+		}
+		if t.HostKeys == nil {
+			t.HostKeys = c.TunnelHostKeys
+		}
+		if t.KeepaliveSeconds == 0 {
+			t.KeepaliveSeconds = c.TunnelKeepalive
+		}
+		if t.KeepaliveMax == 0 {
+			t.KeepaliveMax = c.TunnelKeepaliveMax
+		}
+		if t.ProxyProtocol == "" {
+			t.ProxyProtocol = c.TunnelProxyProtocol
+		}
+	}
+
+	return all
+}
+
+// Tunnel targets, the local service a tunnel forwards to. A specific pot port
+// is TunnelTargetSSH followed by a colon and the port, like ssh:2222.
+const (
+	TunnelTargetSSH   = "ssh"   // The pot's first port
+	TunnelTargetWeb   = "web"   // The admin web server
+	TunnelTargetAdmin = "admin" // The operator console
+)
+
+// serverHost is the host part of user@host:port.
+func serverHost(server string) string {
+	_, hostPort, _ := strings.Cut(server, "@")
+	if host, _, err := net.SplitHostPort(hostPort); err == nil {
+		return host
+	}
+
+	return hostPort
+}
+
+// ParseTrusted parses an address or CIDR from proxy_protocol_trusted.
+func ParseTrusted(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, n, err := net.ParseCIDR(s)
+	return n, err
 }
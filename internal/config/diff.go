@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// secretSettings are never shown in a Change, only whether they're set.
+var secretSettings = map[string]bool{
+	"api_token":         true,
+	"api_control_token": true,
+	"pin":               true,
+}
+
+// Change is one setting that differs between two configurations.
+type Change struct {
+	Setting string `json:"setting"` // The setting's name in the config file
+	Old     string `json:"old"`
+	New     string `json:"new"`
+}
+
+func (c Change) String() string {
+	if c.Old == c.New {
+		return c.Setting + " changed"
+	}
+
+	return fmt.Sprintf("%s: %s -> %s", c.Setting, c.Old, c.New)
+}
+
+// Diff returns the settings that differ from a to b, in the order they're
+// declared in Config.
+func Diff(a *Config, b *Config) []Change {
+	changes := []Change{}
+	va, vb := reflect.ValueOf(*a), reflect.ValueOf(*b)
+	t := va.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		if reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		changes = append(changes, Change{
+			Setting: name,
+			Old:     describe(va.Field(i), secretSettings[name]),
+			New:     describe(vb.Field(i), secretSettings[name]),
+		})
+	}
+
+	return changes
+}
+
+// describe summarizes a setting's value for logs: scalars and port lists as
+// they are, other lists by length and nested sections by whether they're set.
+func describe(v reflect.Value, secret bool) string {
+	if secret {
+		if v.IsZero() {
+			return "unset"
+		}
+		return "set"
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		if strs, ok := v.Interface().([]string); ok {
+			return "[" + strings.Join(strs, ",") + "]"
+		}
+		if v.Len() == 1 {
+			return "1 item"
+		}
+		return fmt.Sprintf("%d items", v.Len())
+	case reflect.Pointer:
+		if v.IsNil() {
+			return "unset"
+		}
+		return "set"
+	case reflect.String:
+		if v.String() == "" {
+			return `""`
+		}
+	}
+
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// EnvPrefix starts the environment variables that override the config file.
+// Each setting's variable is its name in upper case, like HBHP_SSH_PORTS.
+const EnvPrefix = "HBHP_"
+
+// EnvName is the environment variable for a setting.
+func EnvName(setting string) string {
+	return EnvPrefix + strings.ToUpper(setting)
+}
+
+// applyEnv sets what's given in HBHP_* variables over the config file. Lists
+// of strings are comma separated, and the nested settings like filesystem and
+// sinks take the same JSON the config file would. Empty variables are
+// ignored, like unset flags, and unknown HBHP_* variables only get a warning,
+// since other tools may share the prefix.
+func applyEnv(cfg *Config, sources Sources) Problems {
+	var problems Problems
+
+	v := reflect.ValueOf(cfg).Elem()
+	known := map[string]bool{}
+	for _, f := range reflect.VisibleFields(v.Type()) {
+		name := jsonName(f)
+		key := EnvName(name)
+		known[key] = true
+
+		val := os.Getenv(key)
+		if val == "" {
+			continue
+		}
+
+		field := v.FieldByIndex(f.Index)
+		var err error
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(val)
+		case reflect.Bool:
+			if b, perr := strconv.ParseBool(val); perr != nil {
+				err = fmt.Errorf("%q isn't true or false", val)
+			} else {
+				field.SetBool(b)
+			}
+		case reflect.Int:
+			if n, perr := strconv.Atoi(val); perr != nil {
+				err = fmt.Errorf("%q isn't a whole number", val)
+			} else {
+				field.SetInt(int64(n))
+			}
+		default:
+			if field.Type() == reflect.TypeOf([]string(nil)) && !strings.HasPrefix(strings.TrimSpace(val), "[") {
+				field.Set(reflect.ValueOf(strings.Split(val, ",")))
+				break
+			}
+
+			ptr := reflect.New(field.Type())
+			if jerr := json.Unmarshal([]byte(val), ptr.Interface()); jerr != nil {
+				err = fmt.Errorf("invalid JSON: %w", jerr)
+			} else {
+				problems = append(problems, unknownEnvFields(key, val, field.Type())...)
+				field.Set(ptr.Elem())
+			}
+		}
+
+		if err != nil {
+			problems = append(problems, Problem{Path: key, Message: err.Error()})
+			continue
+		}
+		sources[name] = "env " + key
+	}
+
+	var unknown []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(key, EnvPrefix) && !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		log.Warn("Ignoring unknown environment variable", "name", key)
+	}
+
+	return problems
+}
+
+// unknownEnvFields checks a JSON value from an environment variable for
+// unknown settings, the way the config file is checked.
+func unknownEnvFields(key string, val string, t reflect.Type) Problems {
+	var raw any
+	if err := json.Unmarshal([]byte(val), &raw); err != nil {
+		return nil
+	}
+
+	return unknownFields(raw, t, key)
+}
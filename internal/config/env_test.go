@@ -0,0 +1,160 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		check    func(t *testing.T, cfg *Config)
+		source   string // A setting the environment should be the source of
+		problems []string
+	}{
+		{
+			name:   "string",
+			env:    map[string]string{"HBHP_LOG_LEVEL": "debug"},
+			source: "log_level",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.LogLevel != "debug" {
+					t.Errorf("LogLevel = %q, want debug", cfg.LogLevel)
+				}
+			},
+		},
+		{
+			name:   "switch",
+			env:    map[string]string{"HBHP_WATCH_CONFIG": "true"},
+			source: "watch_config",
+			check: func(t *testing.T, cfg *Config) {
+				if !cfg.WatchConfig {
+					t.Error("WatchConfig = false, want true")
+				}
+			},
+		},
+		{
+			name:   "number",
+			env:    map[string]string{"HBHP_WIDTH": "1024"},
+			source: "width",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Width != 1024 {
+					t.Errorf("Width = %d, want 1024", cfg.Width)
+				}
+			},
+		},
+		{
+			name:   "comma separated list",
+			env:    map[string]string{"HBHP_SSH_PORTS": "2222,2223"},
+			source: "ssh_ports",
+			check: func(t *testing.T, cfg *Config) {
+				if !slices.Equal(cfg.SSHPorts, []string{"2222", "2223"}) {
+					t.Errorf("SSHPorts = %q, want [2222 2223]", cfg.SSHPorts)
+				}
+			},
+		},
+		{
+			name:   "JSON list",
+			env:    map[string]string{"HBHP_SSH_PORTS": ` ["2222", "22,23"]`},
+			source: "ssh_ports",
+			check: func(t *testing.T, cfg *Config) {
+				if !slices.Equal(cfg.SSHPorts, []string{"2222", "22,23"}) {
+					t.Errorf("SSHPorts = %q, want [2222 22,23]", cfg.SSHPorts)
+				}
+			},
+		},
+		{
+			name:   "nested JSON",
+			env:    map[string]string{"HBHP_SINKS": `{"syslog": [{"address": "127.0.0.1:514"}]}`},
+			source: "sinks",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Sinks == nil || len(cfg.Sinks.Syslog) != 1 || cfg.Sinks.Syslog[0].Address != "127.0.0.1:514" {
+					t.Errorf("Sinks = %+v, want one syslog sink at 127.0.0.1:514", cfg.Sinks)
+				}
+			},
+		},
+		{
+			name:     "unknown setting inside JSON",
+			env:      map[string]string{"HBHP_SINKS": `{"syslog": [{"adress": "127.0.0.1:514"}]}`},
+			problems: []string{"HBHP_SINKS.syslog[0].adress: unknown setting"},
+		},
+		{
+			name: "empty is ignored",
+			env:  map[string]string{"HBHP_LOG_LEVEL": ""},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.LogLevel != Default.LogLevel {
+					t.Errorf("LogLevel = %q, want the default %q", cfg.LogLevel, Default.LogLevel)
+				}
+			},
+		},
+		{
+			name:     "bad switch",
+			env:      map[string]string{"HBHP_WATCH_CONFIG": "maybe"},
+			problems: []string{`HBHP_WATCH_CONFIG: "maybe" isn't true or false`},
+		},
+		{
+			name:     "bad number",
+			env:      map[string]string{"HBHP_WIDTH": "wide"},
+			problems: []string{`HBHP_WIDTH: "wide" isn't a whole number`},
+		},
+		{
+			name:     "bad JSON",
+			env:      map[string]string{"HBHP_SINKS": `{"syslog": [`},
+			problems: []string{"HBHP_SINKS: invalid JSON: unexpected end of JSON input"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg := Default
+			sources := Sources{}
+			problems := applyEnv(&cfg, sources)
+
+			var got []string
+			for _, p := range problems {
+				got = append(got, p.Path+": "+p.Message)
+			}
+			if !slices.Equal(got, tt.problems) {
+				t.Errorf("problems = %q, want %q", got, tt.problems)
+			}
+
+			if tt.source != "" && !strings.HasPrefix(sources[tt.source], "env HBHP_") {
+				t.Errorf("sources[%q] = %q, want the environment", tt.source, sources[tt.source])
+			}
+			if tt.check != nil {
+				tt.check(t, &cfg)
+			}
+		})
+	}
+}
+
+func TestApplyEnvUnknownVariable(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	t.Setenv("HBHP_NOT_A_SETTING", "1")
+	t.Setenv("HBHP_LOG_LEVEL", "debug")
+
+	cfg := Default
+	if problems := applyEnv(&cfg, Sources{}); len(problems) > 0 {
+		t.Errorf("problems = %v, want none for an unknown variable", problems)
+	}
+	if cfg.LogLevel != "debug" {
+		t.Errorf("LogLevel = %q, want the known variables applied anyway", cfg.LogLevel)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "Ignoring unknown environment variable") || !strings.Contains(out, "HBHP_NOT_A_SETTING") {
+		t.Errorf("log = %q, want a warning naming HBHP_NOT_A_SETTING", out)
+	}
+}
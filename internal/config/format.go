@@ -0,0 +1,45 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// toJSON converts a YAML or TOML config file, chosen by its extension, to
+// JSON. Everything after that, from unknown settings to validation, works the
+// same whatever the file was written in. JSON files are returned as they are.
+func toJSON(path string, data []byte) ([]byte, error) {
+	var doc any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, Problems{{Path: "$", Message: "invalid YAML: " + strings.TrimPrefix(err.Error(), "yaml: ")}}
+		}
+	case ".toml":
+		table := map[string]any{}
+		if _, err := toml.Decode(string(data), &table); err != nil {
+			return nil, Problems{{Path: "$", Message: "invalid TOML: " + strings.TrimPrefix(err.Error(), "toml: ")}}
+		}
+		doc = table
+	default:
+		return data, nil
+	}
+
+	if doc == nil {
+		// An empty file sets nothing, the same as {}.
+		return []byte("{}"), nil
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		// YAML allows keys that aren't strings, which JSON doesn't.
+		return nil, Problems{{Path: "$", Message: fmt.Sprintf("can't be used as a config: %s", err)}}
+	}
+
+	return out, nil
+}
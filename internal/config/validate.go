@@ -0,0 +1,693 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/embedded"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/filesystem"
+)
+
+// Problem is one thing wrong with a configuration, at a JSON path like
+// $.sinks.syslog[0].address.
+type Problem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (p Problem) Error() string {
+	return p.Path + ": " + p.Message
+}
+
+// Problems is everything wrong with a configuration, one per line.
+type Problems []Problem
+
+func (p Problems) Error() string {
+	lines := make([]string, len(p))
+	for i, problem := range p {
+		lines[i] = problem.Error()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+var logLevels = []string{"", "debug", "info", "warn", "error", "fatal"}
+
+// SSH algorithms the pot can offer, which are the ones golang.org/x/crypto/ssh
+// implements for servers. Each persona has an RSA, an ECDSA (P-256) and an
+// Ed25519 host key.
+var (
+	sshKexAlgorithms = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512", "diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+	}
+	sshCiphers = []string{
+		"aes128-ctr", "aes192-ctr", "aes256-ctr", "aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com", "aes128-cbc", "3des-cbc", "arcfour256", "arcfour128", "arcfour",
+	}
+	sshMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com", "hmac-sha2-256", "hmac-sha2-512", "hmac-sha1", "hmac-sha1-96",
+	}
+	// Each of these signs with one of the host keys the pot makes (RSA, ECDSA
+	// P-256 and Ed25519), so any list of them picks at least one key.
+	sshHostKeyAlgorithms = []string{
+		"rsa-sha2-512", "rsa-sha2-256", "ssh-rsa", "ecdsa-sha2-nistp256", "ssh-ed25519",
+	}
+)
+
+// validPersonaName matches names that are safe to use as a directory name,
+// since each persona keeps its host keys in one.
+var validPersonaName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Validate checks the settings that would leave the pot broken or not doing
+// what was asked, and returns Problems when there are any.
+func (c *Config) Validate() error {
+	if problems := c.validate(); len(problems) > 0 {
+		return problems
+	}
+
+	return nil
+}
+
+func (c *Config) validate() Problems {
+	var problems Problems
+	add := func(path string, format string, args ...any) {
+		problems = append(problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(c.SSHPorts) == 0 {
+		add("$.ssh_ports", "at least one port is required")
+	}
+	for i, port := range c.SSHPorts {
+		path := fmt.Sprintf("$.ssh_ports[%d]", i)
+		if !validPort(port) {
+			add(path, "invalid port %q; ports are 1 to 65535", port)
+		} else if slices.Index(c.SSHPorts, port) < i {
+			add(path, "port %s is listed twice", port)
+		}
+	}
+	for i, port := range c.TelnetPorts {
+		path := fmt.Sprintf("$.telnet_ports[%d]", i)
+		if !validPort(port) {
+			add(path, "invalid port %q; ports are 1 to 65535", port)
+		} else if slices.Index(c.TelnetPorts, port) < i {
+			add(path, "port %s is listed twice", port)
+		} else if slices.Contains(c.SSHPorts, port) {
+			add(path, "port %s is also one of ssh_ports", port)
+		}
+	}
+	for i, port := range c.HTTPPorts {
+		path := fmt.Sprintf("$.http_ports[%d]", i)
+		if !validPort(port) {
+			add(path, "invalid port %q; ports are 1 to 65535", port)
+		} else if slices.Index(c.HTTPPorts, port) < i {
+			add(path, "port %s is listed twice", port)
+		} else if slices.Contains(c.SSHPorts, port) {
+			add(path, "port %s is also one of ssh_ports", port)
+		} else if slices.Contains(c.TelnetPorts, port) {
+			add(path, "port %s is also one of telnet_ports", port)
+		}
+	}
+	if strings.ContainsAny(c.HTTPServer, "\r\n") {
+		add("$.http_server", "can't contain line breaks")
+	}
+	validateHTTPApps("$.http_apps", c.HTTPApps, add)
+
+	if strings.Trim(c.PinReset, "0123456789") != "" {
+		add("$.pin", "the PIN must be digits")
+	}
+
+	if !slices.Contains(logLevels, c.LogLevel) {
+		add("$.log_level", "unknown level %q; use one of debug, info, warn, error or fatal", c.LogLevel)
+	}
+
+	if c.Tunnel != "" {
+		if msg := checkServer(c.Tunnel); msg != "" {
+			add("$.tunnel", "%s", msg)
+		}
+
+		if c.TunnelKey == "" {
+			add("$.tunnel_key", "required when tunnel is set")
+		}
+	}
+	if c.TunnelKey != "" {
+		if _, err := os.Stat(c.TunnelKey); err != nil {
+			add("$.tunnel_key", "can't read key file: %s", err)
+		}
+	}
+	if !validPort(c.TunnelRemotePort) {
+		add("$.tunnel_remote_port", "invalid port %q", c.TunnelRemotePort)
+	}
+	if c.TunnelRemoteBind == "" {
+		add("$.tunnel_remote_bind", "required; use 127.0.0.1 to only listen locally or 0.0.0.0 for every address")
+	}
+	if c.TunnelKnownHosts != "" {
+		if _, err := os.Stat(c.TunnelKnownHosts); err != nil {
+			add("$.tunnel_known_hosts", "can't read known_hosts file: %s", err)
+		}
+	}
+	for i, fp := range c.TunnelHostKeys {
+		if !strings.HasPrefix(fp, "SHA256:") {
+			add(fmt.Sprintf("$.tunnel_host_keys[%d]", i), "expected a SHA256 fingerprint like ssh-keygen -l shows, SHA256:...")
+		}
+	}
+	if c.Tunnel != "" && c.TunnelStrictHostKey && c.TunnelKnownHosts == "" && len(c.TunnelHostKeys) == 0 {
+		add("$.tunnel_strict_host_key", "needs tunnel_known_hosts or tunnel_host_keys to check the server's key against")
+	}
+	if c.TunnelKeepalive < -1 {
+		add("$.tunnel_keepalive_seconds", "must be -1 for no keepalives, or more than 0")
+	}
+	if c.TunnelKeepaliveMax < 0 {
+		add("$.tunnel_keepalive_max", "can't be negative")
+	}
+	for i, port := range c.ProxyProtocolPorts {
+		if !c.potPort(port) {
+			add(fmt.Sprintf("$.proxy_protocol_ports[%d]", i), "port %s isn't one of ssh_ports, telnet_ports or http_ports", port)
+		}
+	}
+	for i, trusted := range c.ProxyProtocolTrusted {
+		if _, err := ParseTrusted(trusted); err != nil {
+			add(fmt.Sprintf("$.proxy_protocol_trusted[%d]", i), "expected an IP address or CIDR, got %q", trusted)
+		}
+	}
+	if c.Tunnel != "" {
+		if msg := c.checkTunnelProxy(c.AllTunnels()[0]); msg != "" {
+			add("$.tunnel_proxy_protocol", "%s", msg)
+		}
+	}
+
+	c.validateTunnels(add)
+
+	if c.TunnelAdminPort != "" && !validPort(c.TunnelAdminPort) {
+		add("$.tunnel_admin_port", "invalid port %q", c.TunnelAdminPort)
+	}
+
+	for _, a := range []struct{ path, addr string }{
+		{"$.web_addr", c.WebAddr},
+		{"$.admin_ssh_addr", c.AdminSSHAddr},
+	} {
+		if a.addr == "" {
+			continue
+		}
+		if _, port, err := net.SplitHostPort(a.addr); err != nil || !validPort(port) {
+			add(a.path, "expected host:port or :port, got %q", a.addr)
+		}
+	}
+
+	nodeErrs := filesystem.CheckNodes(c.Filesystem)
+	for i := range c.Filesystem {
+		if err, ok := nodeErrs[i]; ok {
+			add(fmt.Sprintf("$.filesystem[%d]", i), "%s", err)
+		}
+	}
+
+	validateTasks("$.tasks", c.Tasks, add)
+
+	c.validatePersonas(add)
+
+	if r := c.Retention; r != nil {
+		if r.MaxAgeDays < 0 {
+			add("$.retention.max_age_days", "can't be negative")
+		}
+		if r.MaxRows < 0 {
+			add("$.retention.max_rows", "can't be negative")
+		}
+		if r.IntervalMinutes < 0 {
+			add("$.retention.interval_minutes", "can't be negative")
+		}
+		for i, rule := range r.Rules {
+			path := fmt.Sprintf("$.retention.rules[%d]", i)
+			if rule.Type == "" {
+				add(path+".type", "required")
+			}
+			if rule.MaxAgeDays < 0 || rule.MaxRows < 0 {
+				add(path, "limits can't be negative")
+			}
+		}
+	}
+
+	if s := c.Sinks; s != nil {
+		for i, sl := range s.Syslog {
+			path := fmt.Sprintf("$.sinks.syslog[%d]", i)
+			if _, port, err := net.SplitHostPort(sl.Address); err != nil || !validPort(port) {
+				add(path+".address", "expected host:port, got %q", sl.Address)
+			}
+			if !slices.Contains([]string{"", "udp", "tcp", "tls"}, sl.Network) {
+				add(path+".network", "unknown network %q; use udp, tcp or tls", sl.Network)
+			}
+			if !slices.Contains([]string{"", "json", "cef", "leef"}, sl.Format) {
+				add(path+".format", "unknown format %q; use json, cef or leef", sl.Format)
+			}
+		}
+		for i, w := range s.Webhooks {
+			path := fmt.Sprintf("$.sinks.webhooks[%d]", i)
+			if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add(path+".url", "expected an http or https URL, got %q", w.URL)
+			}
+			if w.Template != "" && w.TemplateFile != "" {
+				add(path, "set template or template_file, not both")
+			}
+		}
+	}
+
+	return problems
+}
+
+// validateTasks checks a list of CTF tasks found at path.
+func validateTasks(path string, tasks []Task, add func(path string, format string, args ...any)) {
+	names := map[string]int{}
+	for i, t := range tasks {
+		taskPath := fmt.Sprintf("%s[%d]", path, i)
+		if strings.TrimSpace(t.Name) == "" {
+			add(taskPath+".name", "required")
+		} else if prev, ok := names[t.Name]; ok {
+			add(taskPath+".name", "%q is also the name of %s[%d]", t.Name, path, prev)
+		} else {
+			names[t.Name] = i
+		}
+		if strings.TrimSpace(t.Flag) == "" {
+			add(taskPath+".flag", "required")
+		}
+		if t.Points <= 0 {
+			add(taskPath+".points", "must be more than 0")
+		}
+	}
+}
+
+// validatePersonas checks the personas and that each port has at most one.
+func (c *Config) validatePersonas(add func(path string, format string, args ...any)) {
+	names := map[string]int{}
+	ports := map[string]string{}
+	commands := filesystem.Commands()
+	for i, p := range c.Personas {
+		path := fmt.Sprintf("$.personas[%d]", i)
+
+		if strings.TrimSpace(p.Name) == "" {
+			add(path+".name", "required")
+		} else if !validPersonaName.MatchString(p.Name) {
+			add(path+".name", "%q can only have letters, numbers, dots, dashes and underscores", p.Name)
+		} else if p.Name == "default" {
+			add(path+".name", "default is the name for ports without a persona")
+		} else if prev, ok := names[p.Name]; ok {
+			add(path+".name", "%q is also the name of $.personas[%d]", p.Name, prev)
+		} else {
+			names[p.Name] = i
+		}
+
+		if len(p.Ports) == 0 {
+			add(path+".ports", "at least one port is required")
+		}
+		for j, port := range p.Ports {
+			portPath := fmt.Sprintf("%s.ports[%d]", path, j)
+			if !c.potPort(port) {
+				add(portPath, "port %s isn't one of ssh_ports, telnet_ports or http_ports", port)
+			} else if prev, ok := ports[port]; ok {
+				add(portPath, "port %s already has a persona, at %s", port, prev)
+			} else {
+				ports[port] = portPath
+			}
+		}
+
+		if msg := checkServerVersion(p.ServerVersion); msg != "" {
+			add(path+".server_version", "%s", msg)
+		}
+		for _, a := range []struct {
+			name       string
+			algorithms []string
+			supported  []string
+		}{
+			{"kex_algorithms", p.KexAlgorithms, sshKexAlgorithms},
+			{"ciphers", p.Ciphers, sshCiphers},
+			{"macs", p.MACs, sshMACs},
+			{"host_key_algorithms", p.HostKeyAlgorithms, sshHostKeyAlgorithms},
+		} {
+			if a.algorithms != nil && len(a.algorithms) == 0 {
+				add(path+"."+a.name, "can't be empty; leave it out for the default")
+			}
+			for j, algorithm := range a.algorithms {
+				if !slices.Contains(a.supported, algorithm) {
+					add(fmt.Sprintf("%s.%s[%d]", path, a.name, j), "unsupported algorithm %q; use one of %s", algorithm, strings.Join(a.supported, ", "))
+				}
+			}
+		}
+
+		if p.Banner != "" {
+			if p.NoBanner {
+				add(path+".banner", "can't be set along with no_banner")
+			}
+			t, err := template.New("banner").Parse(p.Banner)
+			if err == nil {
+				err = t.Execute(io.Discard, BannerData{})
+			}
+			if err != nil {
+				add(path+".banner", "invalid template: %s", err)
+			}
+		}
+
+		if strings.ContainsAny(p.Hostname, " \t\r\n/") {
+			add(path+".hostname", "can't contain spaces or slashes")
+		}
+
+		nodeErrs := filesystem.CheckOverlay(c.Filesystem, p.Filesystem)
+		for j := range p.Filesystem {
+			if err, ok := nodeErrs[j]; ok {
+				add(fmt.Sprintf("%s.filesystem[%d]", path, j), "%s", err)
+			}
+		}
+
+		for j, name := range p.Commands {
+			if !slices.Contains(commands, name) {
+				add(fmt.Sprintf("%s.commands[%d]", path, j), "unknown command %q; the built-in commands are %s", name, strings.Join(commands, ", "))
+			}
+		}
+
+		if a := p.Auth; a != nil {
+			if !slices.Contains([]string{"", AuthAcceptAny, AuthAcceptListed, AuthAcceptNone}, a.Accept) {
+				add(path+".auth.accept", "unknown value %q; use any, listed or none", a.Accept)
+			}
+			if a.Accept == AuthAcceptListed && len(a.Credentials) == 0 {
+				add(path+".auth.credentials", "required when accept is listed")
+			}
+			for j, cred := range a.Credentials {
+				if !strings.Contains(cred, ":") {
+					add(fmt.Sprintf("%s.auth.credentials[%d]", path, j), "expected user:password, got %q", cred)
+				}
+			}
+			if a.FailFirst < 0 {
+				add(path+".auth.fail_first", "can't be negative")
+			}
+		}
+
+		validateTasks(path+".tasks", p.Tasks, add)
+
+		if strings.ContainsAny(p.HTTPServer, "\r\n") {
+			add(path+".http_server", "can't contain line breaks")
+		}
+		validateHTTPApps(path+".http_apps", p.HTTPApps, add)
+	}
+}
+
+// potPort reports whether the pot listens on port, for any protocol.
+func (c *Config) potPort(port string) bool {
+	return slices.Contains(c.SSHPorts, port) || slices.Contains(c.TelnetPorts, port) || slices.Contains(c.HTTPPorts, port)
+}
+
+// validateHTTPApps checks a list of HTTP apps found at path.
+func validateHTTPApps(path string, apps []HTTPApp, add func(path string, format string, args ...any)) {
+	served := map[string]string{}
+	for i, a := range apps {
+		appPath := fmt.Sprintf("%s[%d]", path, i)
+
+		if len(a.Paths) == 0 {
+			add(appPath+".paths", "at least one path is required")
+		}
+		for j, p := range a.Paths {
+			pathPath := fmt.Sprintf("%s.paths[%d]", appPath, j)
+			if !strings.HasPrefix(p, "/") {
+				add(pathPath, "%q doesn't start with /", p)
+			} else if strings.Contains(strings.TrimSuffix(p, "*"), "*") {
+				add(pathPath, "%q can only have a * at the end", p)
+			} else if prev, ok := served[p]; ok {
+				add(pathPath, "%s is also served by %s", p, prev)
+			} else {
+				served[p] = pathPath
+			}
+		}
+
+		var source []byte
+		switch {
+		case a.Template != "" && a.TemplateFile != "":
+			add(appPath+".template", "can't be set along with template_file")
+		case a.Template != "":
+			file := embedded.HTTPTemplate(a.Template)
+			if file == "" {
+				add(appPath+".template", "unknown template %q; the built-in templates are %s", a.Template, strings.Join(embedded.HTTPTemplates(), ", "))
+				break
+			}
+			source, _ = embedded.Files.ReadFile(file)
+		case a.TemplateFile != "":
+			b, err := os.ReadFile(a.TemplateFile)
+			if err != nil {
+				add(appPath+".template_file", "can't read template: %s", err)
+				break
+			}
+			source = b
+		default:
+			add(appPath+".template", "required, or template_file")
+		}
+		if source != nil {
+			t, err := template.New("page").Parse(string(source))
+			if err == nil {
+				err = t.Execute(io.Discard, HTTPPageData{})
+			}
+			if err != nil {
+				add(appPath+".template_file", "invalid template: %s", err)
+			}
+		}
+
+		if a.Status != 0 && (a.Status < 100 || a.Status > 599) {
+			add(appPath+".status", "invalid status %d", a.Status)
+		}
+	}
+}
+
+// checkServerVersion returns what's wrong with an SSH version, if anything.
+// RFC 4253 allows printable ASCII, with comments after the first space.
+func checkServerVersion(version string) string {
+	if len(version) > 240 {
+		return "too long"
+	}
+	for _, r := range version {
+		if r < ' ' || r > '~' {
+			return "only printable ASCII is allowed"
+		}
+	}
+	if strings.HasPrefix(version, " ") || strings.HasPrefix(version, "SSH-") {
+		return `give the part after "SSH-2.0-", like OpenSSH_8.9p1 Ubuntu-3ubuntu0.10`
+	}
+
+	return ""
+}
+
+// validateTunnels checks the tunnels list, with the top level tunnel_*
+// settings as defaults.
+func (c *Config) validateTunnels(add func(path string, format string, args ...any)) {
+	first := 0 // Index of tunnels[0] in AllTunnels
+	if c.Tunnel != "" {
+		first = 1
+	}
+	all := c.AllTunnels()
+
+	names := map[string]string{}
+	if c.Tunnel != "" {
+		names[all[0].Name] = "$.tunnel"
+	}
+
+	for i, raw := range c.Tunnels {
+		path := fmt.Sprintf("$.tunnels[%d]", i)
+		t := all[first+i]
+
+		if raw.Server == "" {
+			add(path+".server", "required")
+		} else if msg := checkServer(raw.Server); msg != "" {
+			add(path+".server", "%s", msg)
+		}
+
+		if prev, ok := names[t.Name]; ok {
+			add(path+".name", "%q is also the name of %s; give each tunnel to the same host a name", t.Name, prev)
+		} else {
+			names[t.Name] = path
+		}
+
+		if t.Key == "" {
+			add(path+".key", "required, or set tunnel_key for every tunnel")
+		} else if raw.Key != "" {
+			if _, err := os.Stat(raw.Key); err != nil {
+				add(path+".key", "can't read key file: %s", err)
+			}
+		}
+		if raw.RemotePort != "" && !validPort(raw.RemotePort) {
+			add(path+".remote_port", "invalid port %q", raw.RemotePort)
+		}
+		if raw.KnownHosts != "" {
+			if _, err := os.Stat(raw.KnownHosts); err != nil {
+				add(path+".known_hosts", "can't read known_hosts file: %s", err)
+			}
+		}
+		for j, fp := range raw.HostKeys {
+			if !strings.HasPrefix(fp, "SHA256:") {
+				add(fmt.Sprintf("%s.host_keys[%d]", path, j), "expected a SHA256 fingerprint like ssh-keygen -l shows, SHA256:...")
+			}
+		}
+		if t.StrictHostKey && t.KnownHosts == "" && len(t.HostKeys) == 0 {
+			add(path+".strict_host_key", "needs known_hosts or host_keys to check the server's key against")
+		}
+		if raw.KeepaliveSeconds < -1 {
+			add(path+".keepalive_seconds", "must be -1 for no keepalives, or more than 0")
+		}
+		if raw.KeepaliveMax < 0 {
+			add(path+".keepalive_max", "can't be negative")
+		}
+
+		if msg := c.checkTunnelProxy(t); msg != "" {
+			add(path+".proxy_protocol", "%s", msg)
+		}
+
+		switch target, port, _ := strings.Cut(t.Target, ":"); {
+		case t.Target == TunnelTargetWeb && c.WebAddr == "":
+			add(path+".target", "web needs web_addr to be set")
+		case t.Target == TunnelTargetAdmin && c.AdminSSHAddr == "":
+			add(path+".target", "admin needs admin_ssh_addr to be set")
+		case target == TunnelTargetSSH && port != "" && !slices.Contains(c.SSHPorts, port):
+			add(path+".target", "port %s isn't one of ssh_ports", port)
+		case target != TunnelTargetSSH && t.Target != TunnelTargetWeb && t.Target != TunnelTargetAdmin:
+			add(path+".target", "unknown target %q; use ssh, ssh:PORT, web or admin", t.Target)
+		}
+	}
+}
+
+// checkTunnelProxy returns what's wrong with a tunnel's PROXY header
+// setting, or "" if it's fine. The port it forwards to has to expect one.
+func (c *Config) checkTunnelProxy(t Tunnel) string {
+	if t.ProxyProtocol == "" {
+		return ""
+	}
+	if t.ProxyProtocol != "v1" && t.ProxyProtocol != "v2" {
+		return fmt.Sprintf("unknown version %q; use v1 or v2", t.ProxyProtocol)
+	}
+
+	target, port, _ := strings.Cut(t.Target, ":")
+	if target != TunnelTargetSSH {
+		return "only tunnels to the pot's ports can send PROXY headers"
+	}
+	if port == "" && len(c.SSHPorts) > 0 {
+		port = c.SSHPorts[0]
+	}
+	if !slices.Contains(c.ProxyProtocolPorts, port) {
+		return fmt.Sprintf("port %s has to be in proxy_protocol_ports to read the header", port)
+	}
+
+	return ""
+}
+
+// checkServer returns what's wrong with a user@host[:port] tunnel server, or
+// "" if it's fine.
+func checkServer(server string) string {
+	user, hostPort, ok := strings.Cut(server, "@")
+	if !ok || user == "" || hostPort == "" {
+		return fmt.Sprintf("expected user@host or user@host:port, got %q", server)
+	}
+	if _, port, err := net.SplitHostPort(hostPort); err == nil && !validPort(port) {
+		return fmt.Sprintf("invalid port %q", port)
+	}
+
+	return ""
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 1 && n <= 65535
+}
+
+// decodeProblem turns a JSON decoding error into a Problem with the path or
+// position of the bad value.
+func decodeProblem(data []byte, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		path := "$"
+		for _, name := range strings.Split(typeErr.Field, ".") {
+			if _, err := strconv.Atoi(name); err == nil {
+				path += "[" + name + "]"
+			} else if name != "" {
+				path += "." + name
+			}
+		}
+		return Problems{{Path: path, Message: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, col := 1, 1
+		for _, b := range data[:min(int(syntaxErr.Offset), len(data))] {
+			if b == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+		}
+		return Problems{{Path: "$", Message: fmt.Sprintf("invalid JSON at line %d, column %d: %s", line, col, err)}}
+	}
+
+	return err
+}
+
+// unknownFields finds the keys in raw that don't match a setting of type t,
+// the same way encoding/json matches them, ignoring case.
+func unknownFields(raw any, t reflect.Type, path string) Problems {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var problems Problems
+	switch v := raw.(type) {
+	case map[string]any:
+		if t.Kind() != reflect.Struct {
+			return nil
+		}
+		for key, val := range v {
+			f, ok := fieldByName(t, key)
+			if !ok {
+				problems = append(problems, Problem{Path: path + "." + key, Message: "unknown setting"})
+				continue
+			}
+			problems = append(problems, unknownFields(val, f.Type, path+"."+key)...)
+		}
+	case []any:
+		if t.Kind() != reflect.Slice {
+			return nil
+		}
+		for i, val := range v {
+			problems = append(problems, unknownFields(val, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	slices.SortFunc(problems, func(a, b Problem) int { return strings.Compare(a.Path, b.Path) })
+	return problems
+}
+
+// fieldByName finds the struct field a JSON key decodes into.
+func fieldByName(t reflect.Type, key string) (reflect.StructField, bool) {
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Tag.Get("json") == "-" {
+			continue
+		}
+		if strings.EqualFold(jsonName(f), key) {
+			return f, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// jsonName is the name of a field in the config file.
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+
+	return name
+}
@@ -0,0 +1,66 @@
+// Package console is the operator's SSH admin console: a second SSH server,
+// separate from the pot, that only accepts the operator's keys and shows a
+// TUI for managing the pot remotely.
+package console
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/activeterm"
+	"github.com/charmbracelet/wish/bubbletea"
+	"github.com/charmbracelet/wish/logging"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Start serves the console on addr until the process exits. Only keys listed
+// in the authorized keys file may log in, and the file is read on every
+// login so keys can be added or revoked without a restart.
+func Start(addr string, authorizedKeys string, appConfigDir string) {
+	if authorizedKeys == "" {
+		authorizedKeys = filepath.Join(appConfigDir, ".ssh", "admin_authorized_keys")
+	}
+
+	if _, err := os.Stat(authorizedKeys); err != nil {
+		log.Error("The operator console needs an authorized_keys file", "path", authorizedKeys, "error", err)
+		return
+	}
+
+	s, err := wish.NewServer(
+		wish.WithAddress(addr),
+		// A separate host key, so the console can't be tied to the pot by it.
+		wish.WithHostKeyPath(filepath.Join(appConfigDir, ".ssh", "admin_ed25519")),
+		wish.WithAuthorizedKeys(authorizedKeys),
+		wish.WithMiddleware(
+			bubbletea.Middleware(teaHandler),
+			activeterm.Middleware(),
+			logging.Middleware(),
+		),
+	)
+	if err != nil {
+		log.Error("Could not create operator console", "error", err)
+		return
+	}
+
+	log.Info("Starting operator console", "addr", addr, "authorized_keys", authorizedKeys)
+	if err := s.ListenAndServe(); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
+		log.Error("Operator console stopped", "error", err)
+	}
+}
+
+func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+	operator := s.User()
+	if key := s.PublicKey(); key != nil {
+		log.Info("Operator console login", "user", operator, "key", gossh.FingerprintSHA256(key), "ip", s.RemoteAddr())
+	}
+
+	pty, _, _ := s.Pty()
+	m := newModel(operator, bubbletea.MakeRenderer(s), pty.Window.Width, pty.Window.Height)
+
+	return m, []tea.ProgramOption{tea.WithAltScreen()}
+}
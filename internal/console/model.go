@@ -0,0 +1,572 @@
+package console
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot"
+	"github.com/mikeflynn/honeybearhoneypot/internal/stats"
+)
+
+const (
+	refreshInterval = 2 * time.Second
+	topLimit        = 10
+	chromeHeight    = 8 // Lines used by the header, tabs, status and help
+)
+
+type tab int
+
+const (
+	tabStats tab = iota
+	tabSessions
+	tabBans
+	tabOptions
+	tabCTF
+)
+
+var tabNames = []string{"Stats", "Sessions", "Bans", "Options", "CTF"}
+
+var tabHelp = []string{
+	"",
+	"k kick • b ban IP for a day • B ban IP forever",
+	"a add • d lift",
+	"enter edit",
+	"p set password • r reset progress • d delete",
+}
+
+// option is a setting that can be edited from the console.
+type option struct {
+	key    string
+	label  string
+	secret bool
+}
+
+var options = []option{
+	{key: entity.KeyPotMaxUsers, label: "Max users"},
+	{key: entity.KeyPotMaxPerIP, label: "Max connections per IP"},
+	{key: entity.KeyPotIPRate, label: "Connections per IP per minute"},
+	{key: entity.KeyAdminPIN, label: "Admin PIN", secret: true},
+}
+
+// prompt is what the text input is collecting.
+type prompt int
+
+const (
+	promptNone prompt = iota
+	promptOption
+	promptBan
+	promptPassword
+)
+
+// confirmation is a destructive action waiting for a y.
+type confirmation struct {
+	question string
+	run      func() string
+}
+
+// snapshot is the data shown on screen, reloaded every refreshInterval.
+type snapshot struct {
+	activeUsers  int
+	maxUsers     int
+	usersThisRun int
+	usersAllTime int
+	tunnels      []honeypot.TunnelStatus
+	logins       []stats.LoginCount
+	topCommands  []*entity.EventCount
+	topUsers     []*entity.EventCount
+	sessions     []entity.Session
+	bans         []entity.Ban
+	options      []string
+	ctfUsers     []entity.CTFUser
+	err          error
+}
+
+type tickMsg struct{}
+
+type styles struct {
+	title    lipgloss.Style
+	tab      lipgloss.Style
+	tabOn    lipgloss.Style
+	selected lipgloss.Style
+	heading  lipgloss.Style
+	dim      lipgloss.Style
+	status   lipgloss.Style
+}
+
+type model struct {
+	operator string
+	styles   styles
+	width    int
+	height   int
+
+	tab     tab
+	cursor  int
+	status  string
+	input   textinput.Model
+	prompt  prompt
+	confirm *confirmation
+
+	// What the open prompt changes, picked when it opened, since snapshots
+	// can reorder the rows under the cursor while it's being typed in.
+	option option
+	user   entity.CTFUser
+
+	data snapshot
+}
+
+func newModel(operator string, renderer *lipgloss.Renderer, width int, height int) model {
+	input := textinput.New()
+	input.CharLimit = 200
+	input.Width = 50
+
+	return model{
+		operator: operator,
+		width:    width,
+		height:   height,
+		input:    input,
+		styles: styles{
+			title:    renderer.NewStyle().Bold(true).Foreground(lipgloss.Color("214")),
+			tab:      renderer.NewStyle().Padding(0, 1).Foreground(lipgloss.Color("246")),
+			tabOn:    renderer.NewStyle().Padding(0, 1).Bold(true).Foreground(lipgloss.Color("0")).Background(lipgloss.Color("214")),
+			selected: renderer.NewStyle().Bold(true).Foreground(lipgloss.Color("214")),
+			heading:  renderer.NewStyle().Bold(true).Underline(true),
+			dim:      renderer.NewStyle().Foreground(lipgloss.Color("246")),
+			status:   renderer.NewStyle().Foreground(lipgloss.Color("10")),
+		},
+	}
+}
+
+func (m model) Init() tea.Cmd {
+	return tea.Batch(m.load(), tick())
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(refreshInterval, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+// load reads the pot's state along with whatever the current tab shows.
+func (m model) load() tea.Cmd {
+	t := m.tab
+
+	return func() tea.Msg {
+		s := snapshot{
+			activeUsers:  honeypot.StatActiveUsers(),
+			maxUsers:     honeypot.StatMaxUsers(),
+			usersThisRun: honeypot.StatUsersThisSession(),
+			usersAllTime: honeypot.StatUsersAllTime(),
+			tunnels:      honeypot.StatTunnels(),
+		}
+
+		switch t {
+		case tabStats:
+			s.logins, s.err = stats.LoginCounts()
+			if s.err == nil {
+				s.topCommands, s.err = stats.TopCommands(topLimit)
+			}
+			if s.err == nil {
+				s.topUsers, s.err = stats.TopUsers(topLimit)
+			}
+		case tabSessions:
+			s.sessions = honeypot.StatActiveSessions()
+		case tabBans:
+			s.bans, s.err = entity.BansActive()
+		case tabOptions:
+			for _, o := range options {
+				s.options = append(s.options, entity.OptionGet(o.key))
+			}
+		case tabCTF:
+			s.ctfUsers, s.err = entity.CTFUsers()
+		}
+
+		return s
+	}
+}
+
+func (m model) rows() int {
+	switch m.tab {
+	case tabSessions:
+		return len(m.data.sessions)
+	case tabBans:
+		return len(m.data.bans)
+	case tabOptions:
+		return len(options)
+	case tabCTF:
+		return len(m.data.ctfUsers)
+	}
+
+	return 0
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+	case tickMsg:
+		return m, tea.Batch(m.load(), tick())
+	case snapshot:
+		m.data = msg
+		m.cursor = max(0, min(m.cursor, m.rows()-1))
+		return m, nil
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if m.confirm != nil {
+			return m.updateConfirm(msg)
+		}
+		if m.prompt != promptNone {
+			return m.updatePrompt(msg)
+		}
+		return m.updateKeys(msg)
+	}
+
+	return m, nil
+}
+
+func (m model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "y" {
+		m.status = m.confirm.run()
+	} else {
+		m.status = "Cancelled."
+	}
+	m.confirm = nil
+
+	return m, m.load()
+}
+
+func (m model) updatePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.prompt = promptNone
+		m.input.Blur()
+		m.status = "Cancelled."
+		return m, nil
+	case "enter":
+		m.status = m.submit(strings.TrimSpace(m.input.Value()))
+		m.prompt = promptNone
+		m.input.Blur()
+		return m, m.load()
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m *model) ask(p prompt, placeholder string, value string) tea.Cmd {
+	m.prompt = p
+	m.input.Placeholder = placeholder
+	m.input.SetValue(value)
+	m.input.CursorEnd()
+	return m.input.Focus()
+}
+
+func (m model) updateKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "tab", "right":
+		m.tab = (m.tab + 1) % tab(len(tabNames))
+		m.cursor = 0
+		return m, m.load()
+	case "shift+tab", "left":
+		m.tab = (m.tab + tab(len(tabNames)) - 1) % tab(len(tabNames))
+		m.cursor = 0
+		return m, m.load()
+	case "1", "2", "3", "4", "5":
+		m.tab = tab(msg.String()[0] - '1')
+		m.cursor = 0
+		return m, m.load()
+	case "up":
+		m.cursor = max(0, m.cursor-1)
+		return m, nil
+	case "down":
+		m.cursor = max(0, min(m.cursor+1, m.rows()-1))
+		return m, nil
+	}
+
+	if m.cursor >= m.rows() && !(m.tab == tabBans && msg.String() == "a") {
+		return m, nil
+	}
+
+	switch m.tab {
+	case tabSessions:
+		s := m.data.sessions[m.cursor]
+		switch msg.String() {
+		case "k":
+			m.status = result(honeypot.Kick(s.ID), "Kicked "+s.User+"@"+s.Host+".")
+			return m, m.load()
+		case "b":
+			_, err := honeypot.BanSession(s.ID, 24*time.Hour, "Banned from the operator console")
+			m.status = result(err, "Banned "+s.Host+" for a day.")
+			return m, m.load()
+		case "B":
+			m.confirm = &confirmation{
+				question: fmt.Sprintf("Ban %s forever?", s.Host),
+				run: func() string {
+					_, err := honeypot.BanSession(s.ID, 0, "Banned from the operator console")
+					return result(err, "Banned "+s.Host+".")
+				},
+			}
+		}
+	case tabBans:
+		switch msg.String() {
+		case "a":
+			return m, m.ask(promptBan, "ip|cidr|user|client VALUE [12h|7d|forever] [reason]", "")
+		case "d":
+			b := m.data.bans[m.cursor]
+			m.confirm = &confirmation{
+				question: fmt.Sprintf("Lift the ban on %s %s?", b.Kind, b.Value),
+				run: func() string {
+					_, err := honeypot.Unban(b.ID)
+					return result(err, "Ban lifted.")
+				},
+			}
+		}
+	case tabOptions:
+		if msg.String() == "enter" {
+			o := options[m.cursor]
+			value := ""
+			if m.cursor < len(m.data.options) && !o.secret {
+				value = m.data.options[m.cursor]
+			}
+			m.option = o
+			return m, m.ask(promptOption, o.label, value)
+		}
+	case tabCTF:
+		u := m.data.ctfUsers[m.cursor]
+		switch msg.String() {
+		case "p":
+			m.user = u
+			return m, m.ask(promptPassword, "New password for "+u.Username, "")
+		case "r":
+			m.confirm = &confirmation{
+				question: fmt.Sprintf("Reset %s's points and completed tasks?", u.Username),
+				run: func() string {
+					return result(u.ResetProgress(), "Progress reset.")
+				},
+			}
+		case "d":
+			m.confirm = &confirmation{
+				question: fmt.Sprintf("Delete %s?", u.Username),
+				run: func() string {
+					return result(u.Delete(), "Deleted "+u.Username+".")
+				},
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// submit acts on what was typed into the prompt and returns the status line.
+func (m model) submit(value string) string {
+	switch m.prompt {
+	case promptOption:
+		o := m.option
+		if value == "" {
+			return "Not changed."
+		}
+		if err := entity.OptionSet(o.key, value); err != nil {
+			return err.Error()
+		}
+		log.Info("Option changed from the operator console", "name", o.key, "operator", m.operator)
+		return o.label + " saved."
+	case promptBan:
+		fields := strings.Fields(value)
+		if len(fields) < 2 {
+			return "A ban needs a kind and a value."
+		}
+
+		duration := ""
+		if len(fields) > 2 {
+			duration = fields[2]
+		}
+		d, err := entity.ParseBanDuration(duration)
+		if err != nil {
+			return err.Error()
+		}
+
+		reason := "Banned from the operator console"
+		if len(fields) > 3 {
+			reason = strings.Join(fields[3:], " ")
+		}
+
+		return result(honeypot.Ban(entity.NewBan(fields[0], fields[1], reason, d)), "Banned "+fields[1]+".")
+	case promptPassword:
+		if value == "" {
+			return "Not changed."
+		}
+		u := m.user
+		return result(u.SetPassword(value), "Password changed for "+u.Username+".")
+	}
+
+	return ""
+}
+
+func result(err error, success string) string {
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+
+	return success
+}
+
+func (m model) View() string {
+	st := m.styles
+	b := strings.Builder{}
+
+	b.WriteString(st.title.Render("Honey Bear Honey Pot") + st.dim.Render(" operator console, "+m.operator) + "\n\n")
+
+	tabs := []string{}
+	for i, name := range tabNames {
+		style := st.tab
+		if tab(i) == m.tab {
+			style = st.tabOn
+		}
+		tabs = append(tabs, style.Render(fmt.Sprintf("%d %s", i+1, name)))
+	}
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, tabs...) + "\n\n")
+
+	if m.data.err != nil {
+		b.WriteString("Error: " + m.data.err.Error() + "\n")
+	} else {
+		b.WriteString(m.body())
+	}
+	b.WriteString("\n")
+
+	switch {
+	case m.confirm != nil:
+		b.WriteString(st.status.Render(m.confirm.question+" (y/n)") + "\n")
+	case m.prompt != promptNone:
+		b.WriteString(m.input.View() + "\n")
+	default:
+		b.WriteString(st.status.Render(m.status) + "\n")
+	}
+
+	help := "←/→ tab • ↑/↓ select • q quit"
+	if h := tabHelp[m.tab]; h != "" {
+		help = h + " • " + help
+	}
+	b.WriteString(st.dim.Render(help))
+
+	return b.String()
+}
+
+func (m model) body() string {
+	d := m.data
+
+	switch m.tab {
+	case tabStats:
+		lines := []string{
+			fmt.Sprintf("Active users   %d / %d", d.activeUsers, d.maxUsers),
+			fmt.Sprintf("This run       %d", d.usersThisRun),
+			fmt.Sprintf("All time       %d", d.usersAllTime),
+		}
+		if len(d.tunnels) == 0 {
+			lines = append(lines, "Tunnel         not configured")
+		}
+		for _, t := range d.tunnels {
+			state := "down"
+			if t.Up {
+				state = "up"
+			}
+			lines = append(lines, fmt.Sprintf("Tunnel         %s %s (%s -> %s)", t.Name, state, t.Remote, t.Target))
+		}
+		for _, c := range d.logins {
+			lines = append(lines, fmt.Sprintf("Logins (%s)    %d", c.Window, c.Count))
+		}
+
+		return strings.Join(lines, "\n") + "\n\n" + lipgloss.JoinHorizontal(lipgloss.Top,
+			m.counts("Top commands", d.topCommands),
+			"    ",
+			m.counts("Top users", d.topUsers),
+		) + "\n"
+	case tabSessions:
+		rows := []string{}
+		for _, s := range d.sessions {
+			rows = append(rows, fmt.Sprintf("%-12s %-16s %-22s %-8s %s",
+				s.ID[:min(12, len(s.ID))], s.User, s.Host, s.Duration().Round(time.Second), s.ClientVersion))
+		}
+		return m.list(rows, "No one is connected.")
+	case tabBans:
+		rows := []string{}
+		for _, b := range d.bans {
+			expires := "forever"
+			if b.ExpiresAt != nil {
+				expires = "until " + b.ExpiresAt.Local().Format(time.DateTime)
+			}
+			rows = append(rows, fmt.Sprintf("#%-4d %-7s %-24s %-26s %s", b.ID, b.Kind, b.Value, expires, b.Reason))
+		}
+		return m.list(rows, "No bans.")
+	case tabOptions:
+		rows := []string{}
+		for i, o := range options {
+			value := "default"
+			if i < len(d.options) && d.options[i] != "" {
+				value = d.options[i]
+				if o.secret {
+					value = strings.Repeat("*", len(value))
+				}
+			}
+			rows = append(rows, fmt.Sprintf("%-32s %s", o.label, value))
+		}
+		return m.list(rows, "")
+	case tabCTF:
+		rows := []string{}
+		for _, u := range d.ctfUsers {
+			rows = append(rows, fmt.Sprintf("%-24s %6d pts   joined %s", u.Username, u.Points, u.CreatedAt.Local().Format(time.DateOnly)))
+		}
+		return m.list(rows, "No players yet.")
+	}
+
+	return ""
+}
+
+func (m model) counts(title string, counts []*entity.EventCount) string {
+	lines := []string{m.styles.heading.Render(title)}
+	for _, c := range counts {
+		lines = append(lines, fmt.Sprintf("%-24s %5d", truncate(c.Value, 24), c.Count))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// list renders rows with the cursor, scrolled to keep it on screen.
+func (m model) list(rows []string, empty string) string {
+	if len(rows) == 0 {
+		return m.styles.dim.Render(empty) + "\n"
+	}
+
+	visible := max(1, m.height-chromeHeight)
+	start := max(0, m.cursor-visible+1)
+	end := min(len(rows), start+visible)
+
+	b := strings.Builder{}
+	for i := start; i < end; i++ {
+		row := truncate(rows[i], max(10, m.width-2))
+		if i == m.cursor {
+			b.WriteString(m.styles.selected.Render("> "+row) + "\n")
+		} else {
+			b.WriteString("  " + row + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+
+	return string(r[:n-1]) + "…"
+}
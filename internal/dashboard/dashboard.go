@@ -0,0 +1,203 @@
+package dashboard
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"html/template"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/api"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/gui/assets"
+	"github.com/mikeflynn/honeybearhoneypot/internal/web"
+)
+
+const (
+	cookieName     = "hbhp_dashboard"
+	loginTTL       = 24 * time.Hour
+	maxFailures    = 5
+	lockoutPeriod  = 5 * time.Minute
+	failureBackoff = time.Second
+)
+
+//go:embed static
+var static embed.FS
+
+var loginPage = template.Must(template.ParseFS(static, "static/login.html"))
+
+var (
+	loginsMu  sync.Mutex
+	logins    = map[string]time.Time{} // Cookie token to expiry
+	failures  = map[string]*failure{}  // Remote IP to failed PIN attempts
+	lastSweep time.Time
+)
+
+type failure struct {
+	count int
+	last  time.Time // When the last attempt failed
+	until time.Time
+}
+
+// Register mounts the dashboard on the admin web server. It is guarded by the
+// same PIN as the GUI's admin menu.
+func Register() {
+	if entity.AdminPIN() == entity.DefaultAdminPIN {
+		log.Warn("The dashboard is using the default admin PIN. Change it in the GUI or with -pin-reset.")
+	}
+
+	bears := http.StripPrefix("/dashboard/bears/", http.FileServerFS(assets.Images))
+
+	web.Handle("GET /{$}", requireLogin(serveIndex))
+	web.Handle("GET /login", http.HandlerFunc(serveLogin))
+	web.Handle("POST /login", http.HandlerFunc(handleLogin))
+	web.Handle("POST /logout", http.HandlerFunc(handleLogout))
+	web.Handle("GET /dashboard/stream", requireLogin(serveStream))
+	web.Handle("GET /dashboard/bears/", requireLogin(bears.ServeHTTP))
+	loggedIn := func(next http.Handler) http.Handler {
+		return requireLogin(next.ServeHTTP)
+	}
+	api.Mount("/dashboard/api", loggedIn, loggedIn)
+
+	startHub()
+
+	log.Info("Dashboard enabled")
+}
+
+func serveIndex(w http.ResponseWriter, r *http.Request) {
+	http.ServeFileFS(w, r, static, "static/index.html")
+}
+
+func serveLogin(w http.ResponseWriter, r *http.Request) {
+	loginPage.Execute(w, map[string]any{"Failed": r.URL.Query().Has("failed")})
+}
+
+// handleLogin checks the PIN. Repeated failures from an address lock it out
+// for a while, since a four digit PIN doesn't take long to guess otherwise.
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	ip := remoteIP(r)
+
+	loginsMu.Lock()
+	f := failures[ip]
+	locked := f != nil && time.Now().Before(f.until)
+	loginsMu.Unlock()
+
+	pin := entity.AdminPIN()
+	if locked || subtle.ConstantTimeCompare([]byte(r.PostFormValue("pin")), []byte(pin)) != 1 {
+		now := time.Now()
+		loginsMu.Lock()
+		sweepFailures(now)
+		if f == nil {
+			f = &failure{}
+			failures[ip] = f
+		}
+		f.count++
+		f.last = now
+		if f.count >= maxFailures {
+			f.count = 0
+			f.until = now.Add(lockoutPeriod)
+		}
+		loginsMu.Unlock()
+
+		log.Warn("Dashboard login failed", "ip", ip)
+		time.Sleep(failureBackoff)
+		http.Redirect(w, r, "/login?failed", http.StatusSeeOther)
+		return
+	}
+
+	token := make([]byte, 32)
+	rand.Read(token)
+	value := hex.EncodeToString(token)
+
+	loginsMu.Lock()
+	delete(failures, ip)
+	logins[value] = time.Now().Add(loginTTL)
+	loginsMu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(loginTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	log.Info("Dashboard login", "ip", ip)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// sweepFailures forgets addresses that haven't failed or been locked out for
+// a lockout period, so guesses from many addresses don't pile up. loginsMu
+// must be held.
+func sweepFailures(now time.Time) {
+	if now.Sub(lastSweep) < lockoutPeriod {
+		return
+	}
+
+	for ip, f := range failures {
+		if now.Sub(f.last) > lockoutPeriod && now.After(f.until) {
+			delete(failures, ip)
+		}
+	}
+	lastSweep = now
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(cookieName); err == nil {
+		loginsMu.Lock()
+		delete(logins, c.Value)
+		loginsMu.Unlock()
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: cookieName, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// requireLogin sends visitors without a valid login cookie to the PIN page.
+func requireLogin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !loggedIn(r) {
+			if r.URL.Path == "/" {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+			} else {
+				http.Error(w, "login required", http.StatusUnauthorized)
+			}
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func loggedIn(r *http.Request) bool {
+	c, err := r.Cookie(cookieName)
+	if err != nil {
+		return false
+	}
+
+	loginsMu.Lock()
+	defer loginsMu.Unlock()
+
+	expires, ok := logins[c.Value]
+	if ok && time.Now().After(expires) {
+		delete(logins, c.Value)
+		return false
+	}
+
+	return ok
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,163 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/api"
+	"github.com/mikeflynn/honeybearhoneypot/internal/bear"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot"
+)
+
+const (
+	clientBuffer      = 64
+	heartbeatInterval = 30 * time.Second
+)
+
+// message is one Server-Sent Event.
+type message struct {
+	name string
+	data []byte
+}
+
+type bearFrame struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+type liveStatus struct {
+	api.Status
+	Sessions []entity.Session `json:"sessions"`
+}
+
+var (
+	clientsMu sync.Mutex
+	clients   = map[chan message]struct{}{}
+	mood      = bear.NewMood()
+	lastBear  message
+)
+
+// startHub runs the bear's mood off the event bus, the same way the GUI does,
+// and fans events, bear frames and status out to every connected browser.
+func startHub() {
+	events := entity.EventSubscribe("dashboard")
+
+	go func() {
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+
+				mood.Excite()
+				broadcast("event", e)
+			case <-time.After(60 * time.Second):
+				mood.Calm()
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			b, wait := mood.Next()
+			if b != nil {
+				broadcast("bear", bearFrame{Name: b.Name, Image: "/dashboard/bears/" + b.File})
+			}
+			if hasClients() {
+				broadcast("status", currentStatus())
+			}
+
+			time.Sleep(wait)
+		}
+	}()
+}
+
+func currentStatus() liveStatus {
+	return liveStatus{Status: api.CurrentStatus(), Sessions: honeypot.StatActiveSessions()}
+}
+
+func hasClients() bool {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	return len(clients) > 0
+}
+
+// broadcast sends to every client. Clients that have fallen behind miss the
+// message rather than holding up the others.
+func broadcast(name string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	m := message{name: name, data: data}
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	if name == "bear" {
+		lastBear = m
+	}
+
+	for c := range clients {
+		select {
+		case c <- m:
+		default:
+		}
+	}
+}
+
+func serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	c := make(chan message, clientBuffer)
+
+	clientsMu.Lock()
+	clients[c] = struct{}{}
+	if lastBear.name != "" {
+		c <- lastBear
+	}
+	clientsMu.Unlock()
+
+	defer func() {
+		clientsMu.Lock()
+		delete(clients, c)
+		clientsMu.Unlock()
+	}()
+
+	if data, err := json.Marshal(currentStatus()); err == nil {
+		select {
+		case c <- message{name: "status", data: data}:
+		default:
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case m := <-c:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", m.name, m.data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"path/filepath"
 
@@ -47,6 +48,64 @@ func MakeWrite(query string, values ...any) error {
 	return nil
 }
 
+// Transaction runs fn inside a database transaction, committing if it returns
+// nil and rolling back otherwise.
+func Transaction(fn func(tx *sql.Tx) error) error {
+	tx, err := client.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Vacuum rebuilds the database file, returning the space freed by deletes to
+// the filesystem.
+func Vacuum() error {
+	return MakeWrite("VACUUM;")
+}
+
+// Backup writes a consistent copy of the database to path, which must not
+// already exist. It is safe to run while the pot is writing.
+func Backup(path string) error {
+	return MakeWrite("VACUUM INTO ?;", path)
+}
+
+// EnsureColumn adds a column to an existing table if it isn't already there.
+// Used to migrate databases created by older versions of the app.
+func EnsureColumn(table, column, definition string) error {
+	rows, err := client.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	rows.Close()
+
+	return MakeWrite(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition))
+}
+
 func Close() {
 	if client == nil {
 		return
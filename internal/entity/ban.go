@@ -0,0 +1,249 @@
+package entity
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/db"
+)
+
+const BanInit = `
+CREATE TABLE IF NOT EXISTS bans (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME,
+    UNIQUE(kind, value)
+);
+`
+
+const (
+	BanKindIP     = "ip"     // A single address
+	BanKindCIDR   = "cidr"   // A network, e.g. 203.0.113.0/24
+	BanKindUser   = "user"   // A login username
+	BanKindClient = "client" // Client versions containing the value, e.g. libssh
+)
+
+// How long BansCached trusts its copy. Saving or deleting a ban clears it
+// straight away; the TTL picks up bans other processes, like the bans
+// command, write to the database.
+const bansCacheTTL = 10 * time.Second
+
+var (
+	bansCacheMu     sync.Mutex
+	bansCache       []Ban
+	bansCacheLoaded time.Time
+)
+
+// Ban refuses connections or logins that match it until it expires.
+type Ban struct {
+	ID        int        `json:"id"`
+	Kind      string     `json:"kind"`
+	Value     string     `json:"value"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Never, when nil
+}
+
+// Validate checks the kind and value and normalizes the value. Address bans
+// can't cover loopback, since the reverse tunnel's connections come from there.
+func (b *Ban) Validate() error {
+	b.Value = strings.TrimSpace(b.Value)
+	if b.Value == "" {
+		return fmt.Errorf("ban value required")
+	}
+
+	switch b.Kind {
+	case BanKindIP:
+		ip := net.ParseIP(b.Value)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address %q", b.Value)
+		}
+		if ip.IsLoopback() {
+			return fmt.Errorf("can't ban loopback address %s, which every connection through the reverse tunnel comes from", ip)
+		}
+		b.Value = ip.String()
+	case BanKindCIDR:
+		_, network, err := net.ParseCIDR(b.Value)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q", b.Value)
+		}
+		if network.IP.IsLoopback() || network.Contains(net.IPv4(127, 0, 0, 1)) || network.Contains(net.IPv6loopback) {
+			return fmt.Errorf("can't ban %s, which covers loopback addresses that every connection through the reverse tunnel comes from", network)
+		}
+		b.Value = network.String()
+	case BanKindUser, BanKindClient:
+	default:
+		return fmt.Errorf("unknown ban kind %q", b.Kind)
+	}
+
+	return nil
+}
+
+// MatchesAddr reports whether an IP or CIDR ban covers the address.
+func (b *Ban) MatchesAddr(ip net.IP) bool {
+	switch b.Kind {
+	case BanKindIP:
+		return ip != nil && ip.Equal(net.ParseIP(b.Value))
+	case BanKindCIDR:
+		_, network, err := net.ParseCIDR(b.Value)
+		return err == nil && ip != nil && network.Contains(ip)
+	}
+
+	return false
+}
+
+// MatchesLogin reports whether a username or client version ban covers the
+// login.
+func (b *Ban) MatchesLogin(user string, clientVersion string) bool {
+	switch b.Kind {
+	case BanKindUser:
+		return user == b.Value
+	case BanKindClient:
+		return strings.Contains(strings.ToLower(clientVersion), strings.ToLower(b.Value))
+	}
+
+	return false
+}
+
+// Save adds the ban, or replaces the reason and expiry of an existing ban on
+// the same value.
+func (b *Ban) Save() error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now().UTC()
+	}
+	defer bansCacheClear()
+
+	query := `
+		INSERT INTO bans (kind, value, reason, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(kind, value)
+		DO UPDATE SET reason = excluded.reason, created_at = excluded.created_at, expires_at = excluded.expires_at
+		RETURNING id;
+	`
+	rows, err := db.MakeQuery(query, b.Kind, b.Value, b.Reason, b.CreatedAt, b.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return rows.Scan(&b.ID)
+	}
+
+	return rows.Err()
+}
+
+// BanDelete lifts a ban. It reports false if there was no such ban.
+func BanDelete(id int) (bool, error) {
+	defer bansCacheClear()
+	rows, err := db.MakeQuery("DELETE FROM bans WHERE id = ? RETURNING id;", id)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
+// BansActive returns the bans that haven't expired, newest first.
+func BansActive() ([]Ban, error) {
+	query := `
+		SELECT id, kind, value, reason, created_at, expires_at
+		FROM bans
+		WHERE expires_at IS NULL OR expires_at > ?
+		ORDER BY created_at DESC, id DESC;
+	`
+	rows, err := db.MakeQuery(query, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []Ban{}
+	for rows.Next() {
+		b := Ban{}
+		var expires sql.NullTime
+		if err := rows.Scan(&b.ID, &b.Kind, &b.Value, &b.Reason, &b.CreatedAt, &expires); err != nil {
+			return nil, err
+		}
+		if expires.Valid {
+			b.ExpiresAt = &expires.Time
+		}
+		bans = append(bans, b)
+	}
+
+	return bans, rows.Err()
+}
+
+// BansCached returns the bans that haven't expired, like BansActive, from a
+// copy kept in memory for checking every connection.
+func BansCached() ([]Ban, error) {
+	bansCacheMu.Lock()
+	defer bansCacheMu.Unlock()
+
+	now := time.Now()
+	if bansCache == nil || now.Sub(bansCacheLoaded) > bansCacheTTL {
+		bans, err := BansActive()
+		if err != nil {
+			return nil, err
+		}
+		bansCache, bansCacheLoaded = bans, now
+	}
+
+	active := make([]Ban, 0, len(bansCache))
+	for _, b := range bansCache {
+		if b.ExpiresAt == nil || b.ExpiresAt.After(now) {
+			active = append(active, b)
+		}
+	}
+
+	return active, nil
+}
+
+func bansCacheClear() {
+	bansCacheMu.Lock()
+	bansCache = nil
+	bansCacheMu.Unlock()
+}
+
+// NewBan builds a ban that lasts for d, or forever when d is zero.
+func NewBan(kind string, value string, reason string, d time.Duration) *Ban {
+	b := &Ban{Kind: kind, Value: value, Reason: reason, CreatedAt: time.Now().UTC()}
+	if d > 0 {
+		expires := b.CreatedAt.Add(d)
+		b.ExpiresAt = &expires
+	}
+
+	return b
+}
+
+// ParseBanDuration accepts a Go duration (12h), a number of days (7d), or an
+// empty string or "forever" for a ban that doesn't expire.
+func ParseBanDuration(s string) (time.Duration, error) {
+	if s == "" || s == "forever" {
+		return 0, nil
+	}
+
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+
+	return 0, fmt.Errorf("unrecognized ban duration %q", s)
+}
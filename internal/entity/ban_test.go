@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBanValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    string
+		value   string
+		want    string // The normalized value
+		wantErr string // Part of the error, if one is expected
+	}{
+		{name: "ip", kind: BanKindIP, value: " 203.0.113.7 ", want: "203.0.113.7"},
+		{name: "ipv6", kind: BanKindIP, value: "2001:DB8::7", want: "2001:db8::7"},
+		{name: "cidr", kind: BanKindCIDR, value: "203.0.113.9/24", want: "203.0.113.0/24"},
+		{name: "user", kind: BanKindUser, value: "root", want: "root"},
+		{name: "client", kind: BanKindClient, value: "libssh", want: "libssh"},
+		{name: "empty", kind: BanKindIP, value: "  ", wantErr: "ban value required"},
+		{name: "bad ip", kind: BanKindIP, value: "203.0.113.300", wantErr: "invalid IP address"},
+		{name: "bad cidr", kind: BanKindCIDR, value: "203.0.113.0/33", wantErr: "invalid CIDR"},
+		{name: "unknown kind", kind: "country", value: "xx", wantErr: "unknown ban kind"},
+		{name: "loopback ip", kind: BanKindIP, value: "127.0.0.1", wantErr: "loopback"},
+		{name: "other loopback ip", kind: BanKindIP, value: "127.1.2.3", wantErr: "loopback"},
+		{name: "ipv6 loopback ip", kind: BanKindIP, value: "::1", wantErr: "loopback"},
+		{name: "mapped loopback ip", kind: BanKindIP, value: "::ffff:127.0.0.1", wantErr: "loopback"},
+		{name: "loopback cidr", kind: BanKindCIDR, value: "127.0.0.0/8", wantErr: "loopback"},
+		{name: "cidr inside loopback", kind: BanKindCIDR, value: "127.0.0.128/25", wantErr: "loopback"},
+		{name: "cidr covering loopback", kind: BanKindCIDR, value: "0.0.0.0/0", wantErr: "loopback"},
+		{name: "ipv6 cidr covering loopback", kind: BanKindCIDR, value: "::/0", wantErr: "loopback"},
+		{name: "mapped cidr covering loopback", kind: BanKindCIDR, value: "::ffff:0.0.0.0/96", wantErr: "loopback"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Ban{Kind: tt.kind, Value: tt.value}
+			err := b.Validate()
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if b.Value != tt.want {
+				t.Errorf("Value = %q, want %q", b.Value, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package entity
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/db"
+)
+
+// Credential is a username and password pair offered during authentication,
+// read from an auth event.
+type Credential struct {
+	ID            int       `json:"id"`
+	Timestamp     time.Time `json:"timestamp"`
+	Username      string    `json:"username"`
+	Host          string    `json:"host"`
+	Password      string    `json:"password"`
+	Accepted      bool      `json:"accepted"`
+	ClientVersion string    `json:"client_version"`
+	UserAgent     string    `json:"user_agent,omitempty"` // Only for HTTP logins
+	HASSH         string    `json:"hassh"`
+	App           string    `json:"app"`
+}
+
+// CredentialSelect selects the columns CredentialScan reads from the auth
+// events matching f. Add the ordering and any limit to the end.
+func CredentialSelect(f Filter) (string, []any) {
+	f.Types = []string{EventTypeAuth}
+	where, values := f.Where("timestamp", true)
+
+	return `
+		SELECT
+			id,
+			timestamp,
+			user,
+			host,
+			IFNULL(json_extract(metadata, '$.password'), ''),
+			IFNULL(json_extract(metadata, '$.accepted'), 0),
+			IFNULL(json_extract(metadata, '$.client_version'), ''),
+			IFNULL(json_extract(metadata, '$.user_agent'), ''),
+			IFNULL(json_extract(metadata, '$.hassh'), ''),
+			app
+		FROM events` + where, values
+}
+
+// CredentialQuery runs a query built on CredentialSelect.
+func CredentialQuery(query string, values ...any) ([]Credential, error) {
+	rows, err := db.MakeQuery(query, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	creds := []Credential{}
+	for rows.Next() {
+		c, err := CredentialScan(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
+	}
+
+	return creds, rows.Err()
+}
+
+// CredentialScan reads one credential from a row of a CredentialSelect query.
+func CredentialScan(rows *sql.Rows) (Credential, error) {
+	c := Credential{}
+	err := rows.Scan(&c.ID, &c.Timestamp, &c.Username, &c.Host, &c.Password, &c.Accepted, &c.ClientVersion, &c.UserAgent, &c.HASSH, &c.App)
+
+	return c, err
+}
@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -127,3 +128,83 @@ func Leaderboard(limit int) ([]CTFUser, error) {
 	}
 	return out, nil
 }
+
+// CTFUsers returns every player, highest points first.
+func CTFUsers() ([]CTFUser, error) {
+	rows, err := db.MakeQuery("SELECT id, username, password, points, created_at FROM ctf_users ORDER BY points DESC, username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []CTFUser
+	for rows.Next() {
+		var u CTFUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.Password, &u.Points, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// SetPassword replaces the user's password.
+func (u *CTFUser) SetPassword(password string) error {
+	if u.Username == "" {
+		return fmt.Errorf("username required")
+	}
+	u.Password = password
+	return db.MakeWrite("UPDATE ctf_users SET password=? WHERE username=?", u.Password, u.Username)
+}
+
+// ResetProgress clears the user's completed tasks and points.
+func (u *CTFUser) ResetProgress() error {
+	if u.Username == "" {
+		return fmt.Errorf("username required")
+	}
+	return db.Transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM ctf_user_tasks WHERE username=?", u.Username); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE ctf_users SET points=0 WHERE username=?", u.Username)
+		u.Points = 0
+		return err
+	})
+}
+
+// Delete removes the user and their completed tasks.
+func (u *CTFUser) Delete() error {
+	if u.Username == "" {
+		return fmt.Errorf("username required")
+	}
+	return db.Transaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM ctf_user_tasks WHERE username=?", u.Username); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM ctf_users WHERE username=?", u.Username)
+		return err
+	})
+}
+
+// CTFTaskCompletions returns how many players have completed each task, by
+// task name.
+func CTFTaskCompletions() (map[string]int, error) {
+	rows, err := db.MakeQuery("SELECT task, COUNT(*) FROM ctf_user_tasks GROUP BY task")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]int{}
+	for rows.Next() {
+		var (
+			task string
+			n    int
+		)
+		if err := rows.Scan(&task, &n); err != nil {
+			return nil, err
+		}
+		out[task] = n
+	}
+	return out, rows.Err()
+}
@@ -1,9 +1,12 @@
 package entity
 
 import (
+	"database/sql"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/charmbracelet/log"
 	"github.com/mikeflynn/honeybearhoneypot/internal/db"
 )
 
@@ -12,11 +15,34 @@ const (
 	EventSourceUser   = "user"
 )
 
+const (
+	EventTypeAuth   = "auth"
+	EventTypeLogin  = "login"
+	EventTypeLogout = "logout"
+	EventTypeTyped  = "typed"
+
+	EventTypeOperator = "operator" // An operator watched or took over a session
+	EventTypeInjected = "injected" // A command an operator typed into a session
+	EventTypeConfig   = "config"   // The configuration was reloaded
+	EventTypeTunnel   = "tunnel"   // A reverse tunnel connected, disconnected or failed to connect
+	EventTypeRequest  = "request"  // A client asked to forward a port, its agent or X11, or to set an environment variable
+	EventTypeHTTP     = "http"     // A request to the HTTP honey pot
+)
+
 var (
 	eventSubscriptionsMu sync.RWMutex
 	EventSubscriptions   = map[string]chan *Event{}
+	eventsDropped        atomic.Int64
+	eventWriteQueue      = make(chan *Event, 1000)
+	eventWriterOnce      sync.Once
+	eventWriterDone      = make(chan struct{}) // Closed once the writer has saved everything queued
+	eventQueueMu         sync.RWMutex          // Held for writing while the queue is closed
+	eventQueueClosed     bool
 )
 
+// Layout of the events table's timestamps, the same as CURRENT_TIMESTAMP.
+const eventTimestampLayout = "2006-01-02 15:04:05"
+
 func EventInitialization() string {
 	return `
 		PRAGMA user_version = 1;
@@ -28,13 +54,25 @@ func EventInitialization() string {
 	    source TEXT NOT NULL,
 	    type TEXT NOT NULL,
 	    action TEXT NOT NULL,
-	    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+	    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+	    metadata TEXT NOT NULL DEFAULT '{}'
 		);
 		`
 }
 
+// EventMigrate brings an events table created by an older version up to date.
+func EventMigrate() error {
+	return db.EnsureColumn("events", "metadata", "TEXT NOT NULL DEFAULT '{}'")
+}
+
 func EventSubscribe(name string) chan *Event {
-	c := make(chan *Event, 10)
+	return EventSubscribeSize(name, 10)
+}
+
+// EventSubscribeSize subscribes with a custom buffer size, for subscribers
+// that may fall behind, like network sinks.
+func EventSubscribeSize(name string, size int) chan *Event {
+	c := make(chan *Event, size)
 	eventSubscriptionsMu.Lock()
 	EventSubscriptions[name] = c
 	eventSubscriptionsMu.Unlock()
@@ -51,29 +89,108 @@ func EventUnsubscribe(name string) {
 }
 
 type Event struct {
-	ID        int       `json:"id"`
-	User      string    `json:"user"`
-	Host      string    `json:"host"`
-	App       string    `json:"app"`
-	Source    string    `json:"source"` // EventSource*
-	Type      string    `json:"type"`
-	Action    string    `json:"action"`
-	Timestamp time.Time `json:"timestamp"`
+	ID        int           `json:"id"`
+	User      string        `json:"user"`
+	Host      string        `json:"host"`
+	App       string        `json:"app"`
+	Source    string        `json:"source"` // EventSource*
+	Type      string        `json:"type"`   // EventType*
+	Action    string        `json:"action"`
+	Timestamp time.Time     `json:"timestamp"`
+	Metadata  EventMetadata `json:"metadata,omitempty"`
 }
 
+// Save writes the event, stamped with when it happened. Events without a
+// timestamp get the current time.
 func (e *Event) Save() error {
-	insertStmt := `INSERT INTO events (user, host, app, source, type, action) VALUES (?, ?, ?, ?, ?, ?);`
-	return db.MakeWrite(insertStmt, e.User, e.Host, e.App, e.Source, e.Type, e.Action)
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	insertStmt := `INSERT INTO events (user, host, app, source, type, action, timestamp, metadata) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+	return db.MakeWrite(insertStmt, e.User, e.Host, e.App, e.Source, e.Type, e.Action, e.Timestamp.UTC().Format(eventTimestampLayout), e.Metadata)
+}
+
+// startEventWriter starts the background writer the first time it's needed.
+func startEventWriter() {
+	eventWriterOnce.Do(func() {
+		go func() {
+			defer close(eventWriterDone)
+			for e := range eventWriteQueue {
+				if err := e.Save(); err != nil {
+					log.Error("Error saving event", "type", e.Type, "error", err)
+				}
+			}
+		}()
+	})
+}
+
+// Queue hands the event to the background writer so sessions don't wait on
+// SQLite. If the writer has fallen too far behind, or has been stopped by
+// EventFlush, it is saved immediately.
+func (e *Event) Queue() error {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	startEventWriter()
+
+	eventQueueMu.RLock()
+	defer eventQueueMu.RUnlock()
+
+	if eventQueueClosed {
+		return e.Save()
+	}
+
+	select {
+	case eventWriteQueue <- e:
+		return nil
+	default:
+		return e.Save()
+	}
+}
+
+// EventFlush stops queueing events and waits for the ones already queued to
+// be written. Call before closing the database.
+func EventFlush() {
+	startEventWriter()
+
+	eventQueueMu.Lock()
+	if !eventQueueClosed {
+		eventQueueClosed = true
+		close(eventWriteQueue)
+	}
+	eventQueueMu.Unlock()
+
+	<-eventWriterDone
+}
+
+// EventWriterQueueDepth returns the number of events waiting to be saved.
+func EventWriterQueueDepth() int {
+	return len(eventWriteQueue)
 }
 
+// Publish sends the event to every subscriber. A subscriber whose buffer is
+// full misses the event rather than blocking the session that created it.
 func (e *Event) Publish() {
 	eventSubscriptionsMu.RLock()
 	for _, c := range EventSubscriptions {
-		c <- e
+		select {
+		case c <- e:
+		default:
+			eventsDropped.Add(1)
+		}
 	}
 	eventSubscriptionsMu.RUnlock()
 }
 
+// EventsDropped returns how many events subscribers have missed because their
+// buffers were full.
+func EventsDropped() int64 {
+	return eventsDropped.Load()
+}
+
+// EventQuery runs a query that selects every column of the events table, in
+// table order (e.g. SELECT * FROM events ...).
 func EventQuery(query string, values ...any) ([]*Event, error) {
 	rows, err := db.MakeQuery(query, values...)
 	if err != nil {
@@ -84,8 +201,7 @@ func EventQuery(query string, values ...any) ([]*Event, error) {
 
 	defer rows.Close()
 	for rows.Next() {
-		e := &Event{}
-		err = rows.Scan(&e.ID, &e.User, &e.Host, &e.App, &e.Source, &e.Type, &e.Action, &e.Timestamp)
+		e, err := EventScan(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -95,9 +211,20 @@ func EventQuery(query string, values ...any) ([]*Event, error) {
 	return ret, nil
 }
 
+// EventScan reads one event from a row of a SELECT * FROM events query.
+func EventScan(rows *sql.Rows) (*Event, error) {
+	e := &Event{}
+	err := rows.Scan(&e.ID, &e.User, &e.Host, &e.App, &e.Source, &e.Type, &e.Action, &e.Timestamp, &e.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
 type EventCount struct {
-	Value string
-	Count int
+	Value string `json:"value"`
+	Count int    `json:"count"`
 }
 
 func EventCountQuery(query string, values ...any) ([]*EventCount, error) {
@@ -0,0 +1,181 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EventMetadata holds the structured context for an event. It is stored as a
+// JSON object in the events.metadata column, so it can be queried with the
+// SQLite JSON functions, e.g.:
+//
+//	SELECT * FROM events WHERE json_extract(metadata, '$.remote_port') = 22;
+type EventMetadata map[string]any
+
+// Value implements driver.Valuer so metadata can be passed straight to a query.
+func (m EventMetadata) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner for reading the metadata column.
+func (m *EventMetadata) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("unsupported metadata type %T", src)
+	}
+
+	if len(data) == 0 {
+		*m = nil
+		return nil
+	}
+
+	out := EventMetadata{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return err
+	}
+	if len(out) == 0 {
+		out = nil
+	}
+
+	*m = out
+	return nil
+}
+
+// Merge copies the keys of each of the given metadata maps into m, later
+// values winning.
+func (m EventMetadata) Merge(others ...EventMetadata) EventMetadata {
+	if m == nil {
+		m = EventMetadata{}
+	}
+
+	for _, o := range others {
+		for k, v := range o {
+			m[k] = v
+		}
+	}
+
+	return m
+}
+
+// CredentialMetadata describes an authentication attempt.
+func CredentialMetadata(sessionID string, password string, accepted bool, clientVersion string) EventMetadata {
+	return EventMetadata{
+		"session_id":     sessionID,
+		"password":       password,
+		"accepted":       accepted,
+		"client_version": clientVersion,
+	}
+}
+
+// LoginMetadata describes a new session.
+func LoginMetadata(sessionID string, remotePort int, localPort int, clientVersion string, term string, ptyWidth int, ptyHeight int) EventMetadata {
+	return EventMetadata{
+		"session_id":     sessionID,
+		"remote_port":    remotePort,
+		"local_port":     localPort,
+		"client_version": clientVersion,
+		"term":           term,
+		"pty_width":      ptyWidth,
+		"pty_height":     ptyHeight,
+	}
+}
+
+// KexInitMetadata describes the algorithms an SSH client offered, and its
+// HASSH fingerprint of them.
+func KexInitMetadata(hassh string, hasshAlgorithms string, kexAlgorithms []string, hostKeyAlgorithms []string, ciphers []string, macs []string, compression []string) EventMetadata {
+	return EventMetadata{
+		"hassh":               hassh,
+		"hassh_algorithms":    hasshAlgorithms,
+		"kex_algorithms":      kexAlgorithms,
+		"host_key_algorithms": hostKeyAlgorithms,
+		"ciphers":             ciphers,
+		"macs":                macs,
+		"compression":         compression,
+	}
+}
+
+// RequestMetadata describes a forwarding or environment request made over an
+// SSH connection, and whether the pot went along with it.
+func RequestMetadata(sessionID string, request string, accepted bool) EventMetadata {
+	return EventMetadata{
+		"session_id": sessionID,
+		"request":    request,
+		"accepted":   accepted,
+	}
+}
+
+// HTTPMetadata describes a request to the HTTP honey pot and the status it
+// got back. Bodies over the size kept are cut short.
+func HTTPMetadata(sessionID string, method string, path string, query string, headers map[string]string, body string, truncated bool, status int) EventMetadata {
+	return EventMetadata{
+		"session_id":     sessionID,
+		"method":         method,
+		"path":           path,
+		"query":          query,
+		"headers":        headers,
+		"body":           body,
+		"body_truncated": truncated,
+		"status":         status,
+	}
+}
+
+// LogoutMetadata describes the end of a session.
+func LogoutMetadata(sessionID string, duration time.Duration, exitCode int) EventMetadata {
+	return EventMetadata{
+		"session_id":       sessionID,
+		"duration_seconds": int(duration.Seconds()),
+		"exit_code":        exitCode,
+	}
+}
+
+// CommandMetadata describes a typed command. Any URLs found in the arguments
+// are pulled out so download attempts can be found without parsing actions.
+func CommandMetadata(sessionID string, cwd string, args []string) EventMetadata {
+	md := EventMetadata{
+		"session_id": sessionID,
+		"cwd":        cwd,
+		"args":       args,
+	}
+
+	urls := []string{}
+	for _, a := range args {
+		if u := extractURL(a); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) > 0 {
+		md["urls"] = urls
+	}
+
+	return md
+}
+
+func extractURL(s string) string {
+	for _, scheme := range []string{"http://", "https://", "ftp://", "tftp://"} {
+		if len(s) > len(scheme) && strings.HasPrefix(s, scheme) {
+			return s
+		}
+	}
+
+	return ""
+}
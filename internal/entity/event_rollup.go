@@ -0,0 +1,114 @@
+package entity
+
+import (
+	"database/sql"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/db"
+)
+
+// Events are rolled up into daily aggregates before being pruned so that
+// long-term stats stay correct after the raw rows are gone.
+//
+// event_rollup_counts keeps a per-day count of every event type, and
+// event_rollup_values keeps the per-day counts of the values the stats care
+// about: the user for logins and the action for typed commands.
+const EventRollupInit = `
+CREATE TABLE IF NOT EXISTS event_rollup_counts (
+    day TEXT NOT NULL,
+    app TEXT NOT NULL,
+    source TEXT NOT NULL,
+    type TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, app, source, type)
+);
+CREATE TABLE IF NOT EXISTS event_rollup_values (
+    day TEXT NOT NULL,
+    source TEXT NOT NULL,
+    type TEXT NOT NULL,
+    value TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, source, type, value)
+);
+CREATE VIEW IF NOT EXISTS event_value_counts AS
+    SELECT
+        source,
+        type,
+        CASE WHEN type = 'login' THEN user ELSE action END AS value,
+        COUNT(*) AS count
+    FROM events
+    WHERE type IN ('login', 'typed')
+    GROUP BY source, type, value
+    UNION ALL
+    SELECT source, type, value, SUM(count) AS count
+    FROM event_rollup_values
+    GROUP BY source, type, value;
+`
+
+// EventPrune deletes the events matching the where clause, first folding them
+// into the rollup tables when rollup is set. It returns the number of deleted
+// events.
+func EventPrune(rollup bool, where string, values ...any) (int64, error) {
+	var deleted int64
+
+	err := db.Transaction(func(tx *sql.Tx) error {
+		if rollup {
+			_, err := tx.Exec(`
+				INSERT INTO event_rollup_counts (day, app, source, type, count)
+				SELECT date(timestamp), app, source, type, COUNT(*)
+				FROM events
+				WHERE `+where+`
+				GROUP BY date(timestamp), app, source, type
+				ON CONFLICT(day, app, source, type) DO UPDATE SET count = count + excluded.count;`,
+				values...,
+			)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`
+				INSERT INTO event_rollup_values (day, source, type, value, count)
+				SELECT date(timestamp), source, type, CASE WHEN type = 'login' THEN user ELSE action END, COUNT(*)
+				FROM events
+				WHERE type IN ('login', 'typed') AND (`+where+`)
+				GROUP BY 1, 2, 3, 4
+				ON CONFLICT(day, source, type, value) DO UPDATE SET count = count + excluded.count;`,
+				values...,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		res, err := tx.Exec("DELETE FROM events WHERE "+where, values...)
+		if err != nil {
+			return err
+		}
+
+		deleted, err = res.RowsAffected()
+		return err
+	})
+
+	return deleted, err
+}
+
+// EventRollupCount returns the number of rolled up events of the given type
+// and source. Pass an empty source to count all sources.
+func EventRollupCount(eventType string, source string) (int, error) {
+	rows, err := db.MakeQuery(`
+		SELECT IFNULL(SUM(count), 0)
+		FROM event_rollup_counts
+		WHERE type = ? AND (? = '' OR source = ?)`,
+		eventType, source, source,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	if rows.Next() {
+		err = rows.Scan(&count)
+	}
+
+	return count, err
+}
@@ -0,0 +1,79 @@
+package entity
+
+import (
+	"strings"
+	"time"
+)
+
+// Layout of the timestamps the database compares, the same as
+// CURRENT_TIMESTAMP.
+const filterTimeFormat = "2006-01-02 15:04:05"
+
+// Filter narrows down events, sessions and credentials. Zero values don't
+// filter.
+type Filter struct {
+	Since   time.Time
+	Until   time.Time
+	Types   []string // Event types; only applies to events.
+	Source  string   // Event source (user or system); only applies to events.
+	App     string
+	User    string
+	IP      string // Remote address, without the port.
+	Session string // Session ID.
+}
+
+// Where builds the WHERE clause for the filter against timeCol. Events and
+// sessions share the user, host and app columns; events also have type,
+// source and metadata. Other tables can only be filtered by time.
+func (f Filter) Where(timeCol string, events bool) (string, []any) {
+	clauses := []string{}
+	values := []any{}
+
+	if !f.Since.IsZero() {
+		clauses = append(clauses, timeCol+" >= ?")
+		values = append(values, f.Since.UTC().Format(filterTimeFormat))
+	}
+	if !f.Until.IsZero() {
+		clauses = append(clauses, timeCol+" < ?")
+		values = append(values, f.Until.UTC().Format(filterTimeFormat))
+	}
+	if f.App != "" {
+		clauses = append(clauses, "app = ?")
+		values = append(values, f.App)
+	}
+	if f.User != "" {
+		clauses = append(clauses, "user = ?")
+		values = append(values, f.User)
+	}
+	if f.IP != "" {
+		// Hosts are stored as ip:port, or [ip]:port for IPv6.
+		clauses = append(clauses, "(host = ? OR host LIKE ? OR host LIKE ?)")
+		values = append(values, f.IP, f.IP+":%", "["+f.IP+"]:%")
+	}
+
+	if events {
+		if len(f.Types) > 0 {
+			clauses = append(clauses, "type IN ("+strings.TrimSuffix(strings.Repeat("?,", len(f.Types)), ",")+")")
+			for _, t := range f.Types {
+				values = append(values, t)
+			}
+		}
+		if f.Source != "" {
+			clauses = append(clauses, "source = ?")
+			values = append(values, f.Source)
+		}
+		if f.Session != "" {
+			clauses = append(clauses, "json_extract(metadata, '$.session_id') = ?")
+			values = append(values, f.Session)
+		}
+	} else if f.Session != "" {
+		clauses = append(clauses, "id = ?")
+		values = append(values, f.Session)
+	}
+
+	if len(clauses) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(clauses, " AND "), values
+}
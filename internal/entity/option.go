@@ -1,8 +1,11 @@
 package entity
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -13,6 +16,32 @@ const (
 	KeyAdminPIN    = "gui_pin"
 	KeyPotSSHPort  = "pot_ssh_port"
 	KeyPotMaxUsers = "pot_max_users"
+	KeyPotMaxPerIP = "pot_max_per_ip"         // Concurrent connections from one address
+	KeyPotIPRate   = "pot_ip_rate_per_minute" // New connections from one address per minute
+)
+
+const DefaultAdminPIN = "1234"
+
+// The values the numeric options take; 0 means the default or no limit.
+var optionRanges = map[string][2]int{
+	KeyPotMaxUsers: {0, 10000},
+	KeyPotMaxPerIP: {0, 10000},
+	KeyPotIPRate:   {0, 10000},
+}
+
+// How long OptionCached trusts its copy of an option. Setting or deleting an
+// option clears the copies straight away; the TTL picks up options other
+// processes, like the options command, write to the database.
+const optionCacheTTL = 10 * time.Second
+
+type cachedOption struct {
+	value    string
+	loadedAt time.Time
+}
+
+var (
+	optionCacheMu sync.Mutex
+	optionCache   = map[string]cachedOption{}
 )
 
 func OptionInitialization() string {
@@ -35,6 +64,27 @@ func OptionGet(name string) string {
 	return o.Value
 }
 
+// OptionCached returns an option like OptionGet, from a copy kept in memory
+// for reading on every connection.
+func OptionCached(name string) string {
+	optionCacheMu.Lock()
+	defer optionCacheMu.Unlock()
+
+	if c, ok := optionCache[name]; ok && time.Since(c.loadedAt) <= optionCacheTTL {
+		return c.value
+	}
+
+	val := OptionGet(name)
+	optionCache[name] = cachedOption{value: val, loadedAt: time.Now()}
+	return val
+}
+
+func optionCacheClear() {
+	optionCacheMu.Lock()
+	clear(optionCache)
+	optionCacheMu.Unlock()
+}
+
 func OptionGetInt(name string) int {
 	val := OptionGet(name)
 	if val == "" {
@@ -50,12 +100,73 @@ func OptionGetInt(name string) int {
 	return intval
 }
 
-func OptionSet(name, value string) {
+// AdminPIN returns the PIN that guards the admin screens.
+func AdminPIN() string {
+	pin := OptionGet(KeyAdminPIN)
+	if pin == "" {
+		return DefaultAdminPIN
+	}
+
+	return pin
+}
+
+// OptionValidate checks a value for an option before it's saved: the PIN
+// must be digits and the limits whole numbers in their range.
+func OptionValidate(name, value string) error {
+	if name == KeyAdminPIN {
+		if value == "" || strings.Trim(value, "0123456789") != "" {
+			return errors.New("the PIN must be one or more digits")
+		}
+		return nil
+	}
+
+	r, ok := optionRanges[name]
+	if !ok {
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < r[0] || n > r[1] {
+		return fmt.Errorf("%s must be a whole number from %d to %d", name, r[0], r[1])
+	}
+
+	return nil
+}
+
+func OptionSet(name, value string) error {
 	o := &Option{Name: name, Value: value}
 	err := o.Save()
 	if err != nil {
 		log.Error("OptionSet Error", "name", name, "val", value, "error", err)
 	}
+
+	return err
+}
+
+// OptionDelete removes an option, so it goes back to its default.
+func OptionDelete(name string) error {
+	defer optionCacheClear()
+	return db.MakeWrite("DELETE FROM options WHERE name = ?;", name)
+}
+
+// Options returns every option that has been set, by name.
+func Options() ([]Option, error) {
+	rows, err := db.MakeQuery("SELECT name, value, timestamp FROM options ORDER BY name;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	opts := []Option{}
+	for rows.Next() {
+		o := Option{}
+		if err := rows.Scan(&o.Name, &o.Value, &o.Timestamp); err != nil {
+			return nil, err
+		}
+		opts = append(opts, o)
+	}
+
+	return opts, rows.Err()
 }
 
 type Option struct {
@@ -65,12 +176,17 @@ type Option struct {
 }
 
 func (o *Option) Save() error {
+	if err := OptionValidate(o.Name, o.Value); err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO options (name, value)
 		VALUES (?, ?)
 		ON CONFLICT(name)
 		DO UPDATE SET value = excluded.value, timestamp = CURRENT_TIMESTAMP;
 	`
+	defer optionCacheClear()
 	return db.MakeWrite(query, o.Name, o.Value)
 }
 
@@ -0,0 +1,123 @@
+package entity
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/db"
+)
+
+const SessionInit = `
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user TEXT NOT NULL,
+    host TEXT NOT NULL,
+    app TEXT NOT NULL,
+    client_version TEXT NOT NULL DEFAULT '',
+    local_port INTEGER NOT NULL DEFAULT 0,
+    term TEXT NOT NULL DEFAULT '',
+    commands INTEGER NOT NULL DEFAULT 0,
+    started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    ended_at DATETIME,
+    hassh TEXT NOT NULL DEFAULT '',
+    hassh_algorithms TEXT NOT NULL DEFAULT ''
+);
+`
+
+// Session is a single shell session on the pot, from login to disconnect.
+type Session struct {
+	ID            string     `json:"id"`
+	User          string     `json:"user"`
+	Host          string     `json:"host"`
+	App           string     `json:"app"`
+	ClientVersion string     `json:"client_version"`
+	LocalPort     int        `json:"local_port"`
+	Term          string     `json:"term"`
+	Commands      int        `json:"commands"`
+	StartedAt     time.Time  `json:"started_at"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"`
+
+	HASSH           string `json:"hassh"`            // Fingerprint of the client's SSH algorithms
+	HASSHAlgorithms string `json:"hassh_algorithms"` // The algorithms the HASSH is taken from
+}
+
+// SessionMigrate brings a sessions table created by an older version up to
+// date.
+func SessionMigrate() error {
+	if err := db.EnsureColumn("sessions", "hassh", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	return db.EnsureColumn("sessions", "hassh_algorithms", "TEXT NOT NULL DEFAULT ''")
+}
+
+// Duration returns how long the session lasted, or has lasted so far.
+func (s *Session) Duration() time.Duration {
+	if s.EndedAt == nil {
+		return time.Since(s.StartedAt)
+	}
+
+	return s.EndedAt.Sub(s.StartedAt)
+}
+
+// Start records the beginning of the session.
+func (s *Session) Start() error {
+	if s.StartedAt.IsZero() {
+		s.StartedAt = time.Now().UTC()
+	}
+
+	query := `
+		INSERT INTO sessions (id, user, host, app, client_version, local_port, term, started_at, hassh, hassh_algorithms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO NOTHING;
+	`
+	return db.MakeWrite(query, s.ID, s.User, s.Host, s.App, s.ClientVersion, s.LocalPort, s.Term, s.StartedAt, s.HASSH, s.HASSHAlgorithms)
+}
+
+// End records the end of the session along with the number of commands typed.
+// Commands is counted as they're typed, since their events may still be
+// waiting to be written.
+func (s *Session) End() error {
+	now := time.Now().UTC()
+	s.EndedAt = &now
+
+	query := `UPDATE sessions SET ended_at = ?, commands = ? WHERE id = ?;`
+	return db.MakeWrite(query, s.EndedAt, s.Commands, s.ID)
+}
+
+// SessionQuery runs a query that selects every column of the sessions table,
+// in table order.
+func SessionQuery(query string, values ...any) ([]*Session, error) {
+	rows, err := db.MakeQuery(query, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := []*Session{}
+	for rows.Next() {
+		s, err := SessionScan(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+// SessionScan reads one session from a row of a SELECT * FROM sessions query.
+func SessionScan(rows *sql.Rows) (*Session, error) {
+	s := &Session{}
+	var ended sql.NullTime
+	err := rows.Scan(&s.ID, &s.User, &s.Host, &s.App, &s.ClientVersion, &s.LocalPort, &s.Term, &s.Commands, &s.StartedAt, &ended, &s.HASSH, &s.HASSHAlgorithms)
+	if err != nil {
+		return nil, err
+	}
+
+	if ended.Valid {
+		s.EndedAt = &ended.Time
+	}
+
+	return s, nil
+}
@@ -0,0 +1,253 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/db"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+)
+
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+
+	DataEvents      = "events"
+	DataSessions    = "sessions"
+	DataCredentials = "credentials"
+	DataCTF         = "ctf"
+)
+
+// Datasets lists everything that can be exported.
+var Datasets = []string{DataEvents, DataSessions, DataCredentials, DataCTF}
+
+// Filter narrows down the exported rows. Types only applies to events, and
+// CTF results can only be filtered by time.
+type Filter = entity.Filter
+
+// Write streams a dataset to w in the given format, one row at a time, and
+// returns the number of rows written.
+func Write(w io.Writer, dataset string, format string, f Filter) (int, error) {
+	var (
+		query  string
+		values []any
+		header []string
+		scan   func(*sql.Rows) (any, []string, error)
+	)
+
+	switch dataset {
+	case DataEvents:
+		where, v := f.Where("timestamp", true)
+		query = "SELECT * FROM events" + where + " ORDER BY id"
+		values = v
+		header = []string{"id", "timestamp", "user", "host", "app", "source", "type", "action", "metadata"}
+		scan = scanEvent
+	case DataSessions:
+		where, v := f.Where("started_at", false)
+		query = "SELECT * FROM sessions" + where + " ORDER BY started_at"
+		values = v
+		header = []string{"id", "started_at", "ended_at", "duration_seconds", "user", "host", "app", "client_version", "local_port", "term", "commands", "hassh"}
+		scan = scanSession
+	case DataCredentials:
+		query, values = entity.CredentialSelect(f)
+		query += " ORDER BY id"
+		header = []string{"id", "timestamp", "username", "host", "password", "accepted", "client_version", "user_agent", "hassh", "app"}
+		scan = scanCredential
+	case DataCTF:
+		where, v := Filter{Since: f.Since, Until: f.Until}.Where("t.created_at", false)
+		query = `
+			SELECT t.username, t.task, t.points, t.created_at, IFNULL(u.points, 0)
+			FROM ctf_user_tasks t
+			LEFT JOIN ctf_users u ON u.username = t.username` + where + " ORDER BY t.created_at"
+		values = v
+		header = []string{"username", "task", "points", "completed_at", "total_points"}
+		scan = scanCTF
+	default:
+		return 0, fmt.Errorf("unknown dataset %q", dataset)
+	}
+
+	if format != FormatJSONL && format != FormatCSV {
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+
+	rows, err := db.MakeQuery(query, values...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var (
+		enc *json.Encoder
+		cw  *csv.Writer
+	)
+	if format == FormatJSONL {
+		enc = json.NewEncoder(w)
+	} else {
+		cw = csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	for rows.Next() {
+		record, fields, err := scan(rows)
+		if err != nil {
+			return count, err
+		}
+
+		if enc != nil {
+			err = enc.Encode(record)
+		} else {
+			err = cw.Write(fields)
+			if count%500 == 0 {
+				cw.Flush()
+			}
+		}
+		if err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return count, err
+		}
+	}
+
+	return count, rows.Err()
+}
+
+// WriteAll exports every dataset into its own file in dir, returning the
+// paths of the files written.
+func WriteAll(dir string, format string, f Filter) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for _, dataset := range Datasets {
+		path := filepath.Join(dir, dataset+"."+format)
+		file, err := os.Create(path)
+		if err != nil {
+			return paths, err
+		}
+
+		_, err = Write(file, dataset, format, f)
+		file.Close()
+		if err != nil {
+			return paths, fmt.Errorf("exporting %s: %w", dataset, err)
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+func scanEvent(rows *sql.Rows) (any, []string, error) {
+	e, err := entity.EventScan(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	md, _ := e.Metadata.Value()
+	return e, []string{
+		strconv.Itoa(e.ID),
+		e.Timestamp.UTC().Format(time.RFC3339),
+		e.User,
+		e.Host,
+		e.App,
+		e.Source,
+		e.Type,
+		e.Action,
+		md.(string),
+	}, nil
+}
+
+type sessionRecord struct {
+	*entity.Session
+	DurationSeconds int `json:"duration_seconds"`
+}
+
+func scanSession(rows *sql.Rows) (any, []string, error) {
+	s, err := entity.SessionScan(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ended := ""
+	if s.EndedAt != nil {
+		ended = s.EndedAt.UTC().Format(time.RFC3339)
+	}
+
+	duration := int(s.Duration().Seconds())
+	return sessionRecord{Session: s, DurationSeconds: duration}, []string{
+		s.ID,
+		s.StartedAt.UTC().Format(time.RFC3339),
+		ended,
+		strconv.Itoa(duration),
+		s.User,
+		s.Host,
+		s.App,
+		s.ClientVersion,
+		strconv.Itoa(s.LocalPort),
+		s.Term,
+		strconv.Itoa(s.Commands),
+		s.HASSH,
+	}, nil
+}
+
+func scanCredential(rows *sql.Rows) (any, []string, error) {
+	c, err := entity.CredentialScan(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, []string{
+		strconv.Itoa(c.ID),
+		c.Timestamp.UTC().Format(time.RFC3339),
+		c.Username,
+		c.Host,
+		c.Password,
+		strconv.FormatBool(c.Accepted),
+		c.ClientVersion,
+		c.UserAgent,
+		c.HASSH,
+		c.App,
+	}, nil
+}
+
+type ctfRecord struct {
+	Username    string    `json:"username"`
+	Task        string    `json:"task"`
+	Points      int       `json:"points"`
+	CompletedAt time.Time `json:"completed_at"`
+	TotalPoints int       `json:"total_points"`
+}
+
+func scanCTF(rows *sql.Rows) (any, []string, error) {
+	c := ctfRecord{}
+	err := rows.Scan(&c.Username, &c.Task, &c.Points, &c.CompletedAt, &c.TotalPoints)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, []string{
+		c.Username,
+		c.Task,
+		strconv.Itoa(c.Points),
+		c.CompletedAt.UTC().Format(time.RFC3339),
+		strconv.Itoa(c.TotalPoints),
+	}, nil
+}
@@ -3,6 +3,8 @@ package gui
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"time"
 
 	fyne "fyne.io/fyne/v2"
@@ -14,7 +16,10 @@ import (
 	"fyne.io/fyne/v2/widget"
 	"github.com/charmbracelet/log"
 	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/export"
 	"github.com/mikeflynn/honeybearhoneypot/internal/gui/keypad"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot"
+	"github.com/mikeflynn/honeybearhoneypot/internal/stats"
 )
 
 const (
@@ -32,10 +37,7 @@ func getAdminButton() *widget.Button {
 		approved := 0
 		approvalBinding := binding.BindInt(&approved)
 
-		adminPIN := entity.OptionGet(entity.KeyAdminPIN)
-		if adminPIN == "" {
-			adminPIN = "1234"
-		}
+		adminPIN := entity.AdminPIN()
 
 		passSuccessFunc := func(val string) {
 			if val == adminPIN {
@@ -119,32 +121,164 @@ func getAdminMenu() *fyne.Container {
 
 func adminPotTab() *fyne.Container {
 	return container.NewVBox(
-		container.NewGridWithRows(2,
+		container.NewGridWithRows(3,
+			container.NewGridWithColumns(2,
+				adminOptionButton("Set Max Users", theme.AccountIcon(), entity.KeyPotMaxUsers),
+				adminOptionButton("Set Max Per IP", theme.AccountIcon(), entity.KeyPotMaxPerIP),
+			),
+			container.NewGridWithColumns(2,
+				adminOptionButton("Set Connections Per Minute", theme.HistoryIcon(), entity.KeyPotIPRate),
+				layout.NewSpacer(),
+			),
 			container.NewGridWithColumns(2,
-				widget.NewButtonWithIcon("Set Max Users", theme.AccountIcon(), func() {
+				widget.NewButtonWithIcon("Sessions", theme.ComputerIcon(), func() {
 					var sp *widget.PopUp
-
-					keypad := keypad.Keypad(
-						func(val string) {
-							log.Debug(entity.KeyPotMaxUsers, "val", val)
-							entity.OptionSet(entity.KeyPotMaxUsers, val)
-							sp.Hide()
-						},
-						func() {
-							sp.Hide()
-						},
-						false,
-					)
-
-					sp = widget.NewModalPopUp(keypad, w.Canvas())
+					sp = adminSessionsModal(func() {
+						sp.Hide()
+					})
+					sp.Resize(fyne.NewSize(700, 400))
+					sp.Show()
+				}),
+				widget.NewButtonWithIcon("Bans", theme.CancelIcon(), func() {
+					var sp *widget.PopUp
+					sp = adminBansModal(func() {
+						sp.Hide()
+					})
+					sp.Resize(fyne.NewSize(700, 400))
 					sp.Show()
 				}),
 			),
-			layout.NewSpacer(),
 		),
 	)
 }
 
+// adminOptionButton opens a keypad that saves a number to an option.
+func adminOptionButton(label string, icon fyne.Resource, key string) *widget.Button {
+	return widget.NewButtonWithIcon(label, icon, func() {
+		var sp *widget.PopUp
+
+		keypad := keypad.Keypad(
+			func(val string) {
+				log.Debug(key, "val", val)
+				if adminOptionSave(key, val) {
+					sp.Hide()
+				}
+			},
+			func() {
+				sp.Hide()
+			},
+			false,
+		)
+
+		sp = widget.NewModalPopUp(keypad, w.Canvas())
+		sp.Show()
+	})
+}
+
+// adminOptionSave saves an option typed on a keypad, showing why if the value
+// isn't allowed so it can be typed again.
+func adminOptionSave(key string, val string) bool {
+	if err := entity.OptionSet(key, val); err != nil {
+		var ep *widget.PopUp
+		ep = adminListModal("Not Saved", []string{err.Error()}, func() {
+			ep.Hide()
+		})
+		ep.Resize(fyne.NewSize(700, 400))
+		ep.Show()
+		return false
+	}
+
+	return true
+}
+
+// adminSessionsModal lists the active sessions. Tapping one offers to kick it
+// or ban its address.
+func adminSessionsModal(closeFn func()) *widget.PopUp {
+	sessions := honeypot.StatActiveSessions()
+
+	data := []string{}
+	for _, s := range sessions {
+		data = append(data, fmt.Sprintf("%s@%s (%s)", s.User, s.Host, s.Duration().Round(time.Second)))
+	}
+
+	return adminSelectableListModal("Active Sessions", data, closeFn, func(i int) {
+		s := sessions[i]
+
+		var ap *widget.PopUp
+		action := func(fn func() error) func() {
+			return func() {
+				if err := fn(); err != nil {
+					log.Error("Error acting on session", "session", s.ID, "error", err)
+				}
+				ap.Hide()
+			}
+		}
+		ban := func(d time.Duration) func() error {
+			return func() error {
+				_, err := honeypot.BanSession(s.ID, d, "Banned from the admin menu")
+				return err
+			}
+		}
+
+		ap = widget.NewModalPopUp(
+			container.NewVBox(
+				widget.NewLabel(fmt.Sprintf("%s@%s", s.User, s.Host)),
+				container.NewGridWithColumns(4,
+					widget.NewButton("Kick", action(func() error { return honeypot.Kick(s.ID) })),
+					widget.NewButton("Ban 1 Day", action(ban(24*time.Hour))),
+					widget.NewButton("Ban Forever", action(ban(0))),
+					widget.NewButtonWithIcon("", theme.WindowCloseIcon(), func() {
+						ap.Hide()
+					}),
+				),
+			),
+			w.Canvas(),
+		)
+		ap.Show()
+	})
+}
+
+// adminBansModal lists the bans in effect. Tapping one offers to lift it.
+func adminBansModal(closeFn func()) *widget.PopUp {
+	bans, err := entity.BansActive()
+	if err != nil {
+		log.Error("Error querying bans", "error", err)
+	}
+
+	data := []string{}
+	for _, b := range bans {
+		expires := "forever"
+		if b.ExpiresAt != nil {
+			expires = "until " + b.ExpiresAt.Local().Format(time.DateTime)
+		}
+		data = append(data, fmt.Sprintf("%s %s (%s)", b.Kind, b.Value, expires))
+	}
+
+	return adminSelectableListModal("Bans", data, closeFn, func(i int) {
+		b := bans[i]
+
+		var ap *widget.PopUp
+		ap = widget.NewModalPopUp(
+			container.NewVBox(
+				widget.NewLabel(fmt.Sprintf("Lift the ban on %s %s?", b.Kind, b.Value)),
+				container.NewGridWithColumns(2,
+					widget.NewButton("Lift Ban", func() {
+						if _, err := honeypot.Unban(b.ID); err != nil {
+							log.Error("Error removing ban", "id", b.ID, "error", err)
+						}
+						ap.Hide()
+					}),
+					widget.NewButtonWithIcon("", theme.WindowCloseIcon(), func() {
+						ap.Hide()
+					}),
+				),
+			),
+			w.Canvas(),
+		)
+		ap.Show()
+	})
+}
+
 func adminSystemTab() *fyne.Container {
 	return container.NewVBox(
 		container.NewGridWithRows(2,
@@ -158,8 +292,9 @@ func adminSystemTab() *fyne.Container {
 					keypad := keypad.Keypad(
 						func(val string) {
 							log.Debug(entity.KeyAdminPIN, "val", val)
-							entity.OptionSet(entity.KeyAdminPIN, val)
-							sp.Hide()
+							if adminOptionSave(entity.KeyAdminPIN, val) {
+								sp.Hide()
+							}
 						},
 						func() {
 							sp.Hide()
@@ -171,31 +306,57 @@ func adminSystemTab() *fyne.Container {
 					sp.Show()
 				}),
 			),
-			widget.NewButtonWithIcon("Toggle Fullscreen", theme.ViewFullScreenIcon(), func() {
-				w.SetFullScreen(!w.FullScreen())
-			}),
+			container.NewGridWithColumns(2,
+				widget.NewButtonWithIcon("Toggle Fullscreen", theme.ViewFullScreenIcon(), func() {
+					w.SetFullScreen(!w.FullScreen())
+				}),
+				widget.NewButtonWithIcon("Export Data", theme.DownloadIcon(), func() {
+					var sp *widget.PopUp
+
+					exportFn := func(format string) func() {
+						return func() {
+							sp.Hide()
+
+							dir := filepath.Join(dataDir, "exports", time.Now().Format("20060102-150405"))
+							paths, err := export.WriteAll(dir, format, export.Filter{})
+
+							rows := paths
+							if err != nil {
+								log.Error("Error exporting data", "error", err)
+								rows = append(rows, fmt.Sprintf("Error: %s", err))
+							}
+
+							var rp *widget.PopUp
+							rp = adminListModal("Exported Files", rows, func() {
+								rp.Hide()
+							})
+							rp.Resize(fyne.NewSize(700, 400))
+							rp.Show()
+						}
+					}
+
+					sp = widget.NewModalPopUp(
+						container.NewVBox(
+							widget.NewLabel("Export events, sessions, credentials and CTF results as:"),
+							container.NewGridWithColumns(3,
+								widget.NewButton("JSONL", exportFn(export.FormatJSONL)),
+								widget.NewButton("CSV", exportFn(export.FormatCSV)),
+								widget.NewButtonWithIcon("", theme.WindowCloseIcon(), func() {
+									sp.Hide()
+								}),
+							),
+						),
+						w.Canvas(),
+					)
+					sp.Show()
+				}),
+			),
 		),
 	)
 }
 
 func adminStatsTab() *fyne.Container {
-	userCounts, err := entity.EventCountQuery(
-		`SELECT
-			"1D" AS duration,
-			COUNT(*) AS total
-		FROM events
-		WHERE
-			events.type = "login"
-			AND events.timestamp >= datetime('now','-1 days')
-		UNION
-		SELECT
-			"7D" AS duration,
-			COUNT(*) AS total
-		FROM events
-		WHERE
-			events.type = "login"
-			AND events.timestamp >= datetime('now','-7 days')`,
-	)
+	userCounts, err := stats.LoginCounts()
 	if err != nil {
 		log.Error("Error querying user counts", err)
 	}
@@ -204,8 +365,8 @@ func adminStatsTab() *fyne.Container {
 		widget.NewLabelWithStyle("Users:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
 	}
 
-	for _, e := range userCounts {
-		userCountsLabels = append(userCountsLabels, widget.NewLabelWithStyle(fmt.Sprintf("%d (%s)", e.Count, e.Value), fyne.TextAlignCenter, fyne.TextStyle{Monospace: true}))
+	for _, c := range userCounts {
+		userCountsLabels = append(userCountsLabels, widget.NewLabelWithStyle(fmt.Sprintf("%d (%s)", c.Count, c.Window), fyne.TextAlignCenter, fyne.TextStyle{Monospace: true}))
 	}
 
 	return container.NewVBox(
@@ -217,25 +378,14 @@ func adminStatsTab() *fyne.Container {
 				widget.NewButtonWithIcon("Rare Commands", theme.ContentPasteIcon(), func() {
 					var sp *widget.PopUp
 
-					topCommands, err := entity.EventCountQuery(
-						`SELECT
-							action,
-							count(*) AS total
-						FROM events
-						WHERE
-							events.type = ?
-						GROUP BY events.action
-						ORDER by count(*) ASC, length(action) DESC
-						LIMIT 25`,
-						"typed",
-					)
+					rareCommands, err := stats.RareCommands(25)
 					if err != nil {
 						log.Error("Error querying rare commands", err)
 						return
 					}
 
 					data := []string{}
-					for _, e := range topCommands {
+					for _, e := range rareCommands {
 						data = append(data, e.Value)
 					}
 
@@ -248,27 +398,13 @@ func adminStatsTab() *fyne.Container {
 				widget.NewButtonWithIcon("Recent", theme.HistoryIcon(), func() {
 					var sp *widget.PopUp
 
-					topCommands, err := entity.EventQuery(
-						`SELECT *
-						 FROM events
-						 WHERE app = "ssh"
-						 ORDER by timestamp DESC
-						 LIMIT 100`,
-						"typed",
-					)
+					recent, err := stats.RecentEvents("ssh", 100)
 					if err != nil {
-						log.Error("Error querying top commands", err)
+						log.Error("Error querying recent events", err)
 						return
 					}
 
-					data := []string{}
-					tz, _ := time.LoadLocation("America/Los_Angeles")
-
-					for _, e := range topCommands {
-						data = append(data, fmt.Sprintf("%s (%s) > %s", e.User, e.Timestamp.In(tz).Format(time.Kitchen), e.Action))
-					}
-
-					sp = adminListModal("Recent Events", data, func() {
+					sp = adminEventListModal("Recent Events", recent, func() {
 						sp.Hide()
 					})
 					sp.Resize(fyne.NewSize(700, 400))
@@ -279,18 +415,7 @@ func adminStatsTab() *fyne.Container {
 				widget.NewButtonWithIcon("Top Commands", theme.ListIcon(), func() {
 					var sp *widget.PopUp
 
-					topCommands, err := entity.EventCountQuery(
-						`SELECT
-							action,
-							count(*) AS total
-						FROM events
-						WHERE
-							events.type = ?
-						GROUP BY events.action
-						ORDER by count(*) DESC
-						LIMIT 25`,
-						"typed",
-					)
+					topCommands, err := stats.TopCommands(25)
 					if err != nil {
 						log.Error("Error querying top commands", err)
 						return
@@ -310,25 +435,14 @@ func adminStatsTab() *fyne.Container {
 				widget.NewButtonWithIcon("Top Users", theme.ListIcon(), func() {
 					var sp *widget.PopUp
 
-					topCommands, err := entity.EventCountQuery(
-						`SELECT
-							events.user,
-							count(*) AS total
-						FROM events
-						WHERE
-							events.type = "login"
-						GROUP BY events.user
-						ORDER by count(*) DESC
-						LIMIT 25`,
-						"typed",
-					)
+					topUsers, err := stats.TopUsers(25)
 					if err != nil {
 						log.Error("Error querying top users", err)
 						return
 					}
 
 					data := []string{}
-					for _, e := range topCommands {
+					for _, e := range topUsers {
 						data = append(data, fmt.Sprintf("%s (%d)", e.Value, e.Count))
 					}
 
@@ -344,6 +458,12 @@ func adminStatsTab() *fyne.Container {
 }
 
 func adminListModal(title string, rows []string, closeFn func()) *widget.PopUp {
+	return adminSelectableListModal(title, rows, closeFn, nil)
+}
+
+// adminSelectableListModal is adminListModal with a callback for when a row is
+// tapped. The callback receives the index into rows.
+func adminSelectableListModal(title string, rows []string, closeFn func(), selectFn func(int)) *widget.PopUp {
 	// Add a blank line to the start of the list to get the #1 item to show below the modal header.
 	rows = append([]string{""}, rows...)
 
@@ -362,6 +482,17 @@ func adminListModal(title string, rows []string, closeFn func()) *widget.PopUp {
 
 	data.Resize(fyne.NewSize(700, 300))
 
+	if selectFn != nil {
+		data.OnSelected = func(id widget.ListItemID) {
+			data.UnselectAll()
+			if id < 1 || id > len(rows)-1 {
+				return // Header spacer row.
+			}
+
+			selectFn(id - 1)
+		}
+	}
+
 	header := container.NewVBox(
 		container.NewStack(
 			canvas.NewRectangle(theme.Color(theme.ColorNameOverlayBackground)),
@@ -381,3 +512,47 @@ func adminListModal(title string, rows []string, closeFn func()) *widget.PopUp {
 		),
 		w.Canvas())
 }
+
+// adminEventListModal lists events and opens a detail view, including the
+// event metadata, when one is tapped.
+func adminEventListModal(title string, events []*entity.Event, closeFn func()) *widget.PopUp {
+	tz, _ := time.LoadLocation("America/Los_Angeles")
+
+	data := []string{}
+	for _, e := range events {
+		data = append(data, fmt.Sprintf("%s (%s) > %s", e.User, e.Timestamp.In(tz).Format(time.Kitchen), e.Action))
+	}
+
+	return adminSelectableListModal(title, data, closeFn, func(i int) {
+		var dp *widget.PopUp
+		dp = adminEventDetailModal(events[i], tz, func() {
+			dp.Hide()
+		})
+		dp.Resize(fyne.NewSize(700, 400))
+		dp.Show()
+	})
+}
+
+func adminEventDetailModal(e *entity.Event, tz *time.Location, closeFn func()) *widget.PopUp {
+	rows := []string{
+		fmt.Sprintf("Time: %s", e.Timestamp.In(tz).Format(time.DateTime)),
+		fmt.Sprintf("User: %s", e.User),
+		fmt.Sprintf("Host: %s", e.Host),
+		fmt.Sprintf("App: %s", e.App),
+		fmt.Sprintf("Source: %s", e.Source),
+		fmt.Sprintf("Type: %s", e.Type),
+		fmt.Sprintf("Action: %s", e.Action),
+	}
+
+	keys := make([]string, 0, len(e.Metadata))
+	for k := range e.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		rows = append(rows, fmt.Sprintf("%s: %v", k, e.Metadata[k]))
+	}
+
+	return adminListModal(fmt.Sprintf("Event #%d", e.ID), rows, closeFn)
+}
@@ -6,12 +6,12 @@ import (
 	"bytes"
 	"fmt"
 	"image/color"
-	rand "math/rand/v2"
 	"net/url"
 	"os"
 	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/bear"
 	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
 	"github.com/mikeflynn/honeybearhoneypot/internal/gui/assets"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot"
@@ -32,15 +32,18 @@ const (
 )
 
 var (
-	currentBear   string
-	overrideBear  string
-	emotionFactor int = 1
-	w             fyne.Window
-	width         float32 = defaultWidth
-	height        float32 = defaultHeight
-	liveImage     *canvas.Image
+	w         fyne.Window
+	width     float32 = defaultWidth
+	height    float32 = defaultHeight
+	liveImage *canvas.Image
+	dataDir   string
 )
 
+// SetDataDir sets the app data directory, used for writing exports.
+func SetDataDir(dir string) {
+	dataDir = dir
+}
+
 func StartGUI(fullscreen bool, overrideWidth, overrideHeight float32) {
 	if overrideWidth != 0 {
 		width = overrideWidth
@@ -55,14 +58,15 @@ func StartGUI(fullscreen bool, overrideWidth, overrideHeight float32) {
 
 	w = a.NewWindow("Honey Bear Honey Pot")
 
-	currentBear := bears.GetBearByCategory("boot", "")
+	mood := bear.NewMood()
+	currentBear := mood.Current()
 	if currentBear == nil {
 		fmt.Println("Error loading boot bear")
 		os.Exit(1)
 	}
 
 	buttonNose := widget.NewButton("", func() {
-		overrideBear = bears.GetBearByCategory("standard", "react").Name
+		mood.React()
 	})
 	buttonNose.Importance = widget.LowImportance
 
@@ -158,64 +162,17 @@ func StartGUI(fullscreen bool, overrideWidth, overrideHeight float32) {
 					"Timestamp", event.Timestamp,
 				)
 
-				emotionFactor += 1
+				mood.Excite()
 			case <-time.After(60 * time.Second):
-				emotionFactor -= 1
+				mood.Calm()
 			}
-
-			log.Debug("Emotion Status:", "factor", emotionFactor)
 		}
 	}()
 
 	// UI update loop
 	go func() {
-		cat := "standard"
-		subcat := []string{"idle", "talk"}
-		skipFrames := 0
-
 		for {
-			loopWait := time.Duration(2 * time.Second) // Default wait in seconds
-
-			var newBear *Bear
-			if overrideBear != "" {
-				newBear = bears.GetBear(overrideBear)
-			} else {
-				if skipFrames > 0 {
-					skipFrames--
-				} else {
-					if shouldShowEmotion() {
-						newBear = bears.GetBearByCategory("emote", "")
-					} else {
-						newBear = bears.GetBearByCategory(cat, subcat...)
-
-						if newBear.SubCategory == "talk" {
-							subcat = []string{"idle"}
-							go func() {
-								<-time.After(30 * time.Second)
-								subcat = []string{"idle", "talk"} // Reset subcategory after 30 seconds
-							}()
-						}
-					}
-
-					skipFrames = newBear.SkipFrames // Get the skip frames for the new bear
-				}
-			}
-
-			if newBear == nil {
-				log.Debug("No bear found. Using current bear.")
-				newBear = currentBear
-			} else {
-				if overrideBear == "" && currentBear.Category != newBear.Category {
-					overrideBear = newBear.Name // Set the new bear to load after the glitch
-					log.Debug("Loading glitch bear")
-					newBear = bears.GetBearByCategory("glitch", "")
-
-					loopWait = time.Duration(600 * time.Millisecond) // Brief wait for the glitch bear
-				} else {
-					currentBear = newBear // Set the current bear to the new bear
-					overrideBear = ""     // Reset the override bear
-				}
-			}
+			newBear, loopWait := mood.Next()
 
 			fyne.Do(func() {
 				// Update the current user count
@@ -280,13 +237,13 @@ func separator() *canvas.Rectangle {
 	return sep
 }
 
-func showBear(bear Bear) *canvas.Image {
-	fileData, err := bear.FileData()
+func showBear(b bear.Bear) *canvas.Image {
+	fileData, err := b.FileData()
 	if err != nil {
 		return nil
 	}
 
-	image := canvas.NewImageFromReader(bytes.NewReader(fileData), bear.Name)
+	image := canvas.NewImageFromReader(bytes.NewReader(fileData), b.Name)
 	image.FillMode = canvas.ImageFillStretch
 	image.SetMinSize(fyne.NewSize(width, height))
 	image.Move(fyne.NewPos(0, 0))
@@ -294,22 +251,6 @@ func showBear(bear Bear) *canvas.Image {
 	return image
 }
 
-func shouldShowEmotion() bool {
-	max := (honeypot.StatActiveUsers() * 3) + (honeypot.StatMaxUsers() * 2)
-	r := rand.IntN(max)
-	log.Debug("Bear update:", "max", max, "r", r, "emotionFactor", emotionFactor)
-
-	resp := r <= emotionFactor
-	if resp {
-		emotionFactor -= 10
-		if emotionFactor < 0 {
-			emotionFactor = 1
-		}
-	}
-
-	return resp
-}
-
 func aboutButton() *widget.Button {
 	var logo *canvas.Image
 
@@ -354,13 +295,18 @@ func aboutButton() *widget.Button {
 	return aboutButton
 }
 
-func tunnelStatus() *canvas.Image {
-	status := honeypot.StatTunnelActive()
-	if status == -1 {
-		return nil
+// tunnelStatus shows the live badge while any tunnel is up, with a count of
+// the ones that are up when some are down.
+func tunnelStatus() fyne.CanvasObject {
+	tunnels := honeypot.StatTunnels()
+	up := 0
+	for _, t := range tunnels {
+		if t.Up {
+			up++
+		}
 	}
 
-	if status == 1 {
+	if up > 0 {
 		if liveImage == nil {
 			liveBytes, err := assets.Images.ReadFile("live.png")
 			if err != nil {
@@ -373,6 +319,10 @@ func tunnelStatus() *canvas.Image {
 			liveImage.SetMinSize(fyne.NewSize(20, 25))
 		}
 
+		if up < len(tunnels) {
+			return container.NewHBox(liveImage, widget.NewLabel(fmt.Sprintf("%d/%d", up, len(tunnels))))
+		}
+
 		return liveImage
 	}
 
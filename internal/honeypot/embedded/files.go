@@ -2,7 +2,33 @@ package embedded
 
 import (
 	"embed"
+	"io/fs"
+	"path"
+	"strings"
 )
 
-//go:embed *.txt *.md
+//go:embed *.txt *.md http
 var Files embed.FS
+
+// HTTPTemplate returns the file in Files holding the built-in HTTP app
+// template called name, or an empty string if there isn't one.
+func HTTPTemplate(name string) string {
+	matches, _ := fs.Glob(Files, "http/"+name+".*")
+	if len(matches) != 1 {
+		return ""
+	}
+
+	return matches[0]
+}
+
+// HTTPTemplates returns the names of the built-in HTTP app templates.
+func HTTPTemplates() []string {
+	entries, _ := fs.ReadDir(Files, "http")
+
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), path.Ext(e.Name())))
+	}
+
+	return names
+}
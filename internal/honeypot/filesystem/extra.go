@@ -2,38 +2,99 @@ package filesystem
 
 import (
 	"errors"
+	"fmt"
 	"path"
 	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
 )
 
-var additionalNodes []Node
+var (
+	additionalNodesMu       sync.Mutex
+	additionalNodes         []Node
+	additionalNodesReported bool // Whether errors adding the current nodes have been logged
+)
 
 // SetAdditionalNodes stores nodes that will be merged into the filesystem
-// during initialization.
+// during initialization. Sessions that start afterwards see the new nodes.
 func SetAdditionalNodes(nodes []Node) {
+	additionalNodesMu.Lock()
 	additionalNodes = nodes
+	additionalNodesReported = false
+	additionalNodesMu.Unlock()
+}
+
+// CheckNodes adds the nodes to a fresh copy of the built-in filesystem and
+// returns the errors for the ones that couldn't be added, by index.
+func CheckNodes(nodes []Node) map[int]error {
+	return CheckOverlay(nil, nodes)
+}
+
+// CheckOverlay is CheckNodes for nodes added on top of base, such as a
+// persona's nodes over the configured ones. Only errors for nodes are returned.
+func CheckOverlay(base []Node, nodes []Node) map[int]error {
+	root, _ := newTree(DefaultProfile)
+	for _, n := range base {
+		addNode(root, n)
+	}
+
+	errs := map[int]error{}
+	for i, n := range nodes {
+		if err := addNode(root, n); err != nil {
+			errs[i] = err
+		}
+	}
+
+	return errs
+}
+
+// lookup finds the node at an absolute path under root.
+func lookup(root *Node, p string) *Node {
+	node := root
+	for _, name := range strings.Split(strings.Trim(p, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if node = node.Child(name); node == nil {
+			return nil
+		}
+	}
+
+	return node
 }
 
 // addNode inserts a node into the filesystem tree under its parent path.
 // Parent directories must already exist.
-func addNode(n Node) error {
-	if SystemRoot == nil {
+func addNode(root *Node, n Node) error {
+	if root == nil {
 		return errors.New("filesystem not initialized")
 	}
 	if n.Path == "" {
 		return errors.New("node path required")
 	}
+	if !strings.HasPrefix(n.Path, "/") {
+		return fmt.Errorf("path %q must be absolute", n.Path)
+	}
+	if n.Mode < 0 || n.Mode > 0777 {
+		return fmt.Errorf("invalid mode %d; modes go up to 0777, and JSON numbers are decimal, so use 420 for 0644 or 493 for 0755", n.Mode)
+	}
 
+	n.Path = path.Clean(n.Path)
 	if n.Name == "" {
 		n.Name = path.Base(n.Path)
 	}
+
 	parentPath := path.Dir(n.Path)
-	if parentPath == "." {
-		parentPath = "/"
+	parent := lookup(root, parentPath)
+	if parent == nil {
+		return fmt.Errorf("parent directory %s doesn't exist", parentPath)
+	}
+	if !parent.IsDirectory() {
+		return fmt.Errorf("parent %s isn't a directory", parentPath)
 	}
-	parent, err := GetNodeByPath(SystemRoot, strings.TrimPrefix(parentPath, "/"))
-	if err != nil {
-		return err
+	if parent.Child(n.Name) != nil {
+		return fmt.Errorf("%s already exists", n.Path)
 	}
 
 	if n.Owner == "" {
@@ -54,8 +115,18 @@ func addNode(n Node) error {
 	return nil
 }
 
-func applyAdditionalNodes() {
-	for _, n := range additionalNodes {
-		_ = addNode(n)
+// applyAdditionalNodes adds the configured nodes to the tree. Every session
+// builds its own tree, so errors are only logged the first time.
+func applyAdditionalNodes(root *Node) {
+	additionalNodesMu.Lock()
+	nodes := additionalNodes
+	report := !additionalNodesReported
+	additionalNodesReported = true
+	additionalNodesMu.Unlock()
+
+	for _, n := range nodes {
+		if err := addNode(root, n); err != nil && report {
+			log.Warn("Could not add filesystem node", "path", n.Path, "error", err)
+		}
 	}
 }
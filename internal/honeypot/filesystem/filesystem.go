@@ -8,6 +8,7 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
 	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/confetti"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/ctf"
@@ -15,11 +16,7 @@ import (
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/matrix"
 )
 
-var (
-	SystemRoot *Node
-	SystemPath []string
-	HomeDir    *Node
-)
+var SystemPath = []string{"/usr/bin/"}
 
 type (
 	FileContentsMsg    []byte
@@ -61,12 +58,31 @@ func newFile(path string, content []byte, mode int) *Node {
 	}
 }
 
-func Initialize() {
-	SystemPath = []string{
-		"/usr/bin/",
+// New builds a filesystem for a machine with the given profile, including the
+// configured additional nodes, and returns its root and the user's home
+// directory. Every session gets its own.
+func New(p Profile) (*Node, *Node) {
+	p = p.withDefaults()
+
+	root, home := newTree(p)
+	if p.Commands != nil {
+		keepCommands(root, p.Commands)
+	}
+	applyAdditionalNodes(root)
+	for _, n := range p.Nodes {
+		if err := addNode(root, n); err != nil {
+			log.Debug("Could not add persona filesystem node", "path", n.Path, "error", err)
+		}
 	}
+	setRoot(root, root)
 
-	HomeDir = &Node{
+	return root, home
+}
+
+// newTree builds the built-in filesystem and returns its root and the user's
+// home directory.
+func newTree(p Profile) (*Node, *Node) {
+	home := &Node{
 		Name:      "you",
 		Path:      "/home/you",
 		Directory: true,
@@ -97,7 +113,7 @@ func Initialize() {
 
 	catHelp := "Usage: cat [FILE]\n Displays the contents of a file."
 
-	SystemRoot = &Node{
+	root := &Node{
 		Name:      "",
 		Path:      "/",
 		Directory: true,
@@ -108,11 +124,8 @@ func Initialize() {
 			newDirectory("/tmp"),
 			newDirectory(
 				"/etc",
-				newFile(
-					"/etc/os-release",
-					[]byte("PRETTY_NAME=\"Hardhat Linux\"\nNAME=\"Hardhat Linux\"\nID=hardhat\nID_LIKE=debian\nVERSION_ID=\"1.0\"\nVERSION=\"1.0\"\nVERSION_CODENAME=\"fozzie\"\n"),
-					0644,
-				),
+				newFile("/etc/os-release", []byte(p.OSRelease), 0644),
+				newFile("/etc/hostname", []byte(p.Hostname+"\n"), 0644),
 			),
 			{
 				Name:      "usr",
@@ -531,12 +544,12 @@ func Initialize() {
 								Mode:      0711,
 								HelpText:  "Usage: uname [OPTION]...\n Print system information.",
 								Exec: func(dir *Node, params []string) *tea.Cmd {
-									s := "Linux"
-									n := "Hardhat"
-									r := "6.22.0-81-generic"
-									v := "#148-HardHat SMP Fri Mar 14 19:05:48 UTC 2025"
-									m := "x86_64"
-									o := "Hardhat Linux"
+									s := p.KernelName
+									n := p.Hostname
+									r := p.KernelRelease
+									v := p.KernelVersion
+									m := p.Machine
+									o := p.OS
 									output := []string{}
 
 									if len(params) == 0 {
@@ -571,6 +584,22 @@ func Initialize() {
 									return &cmd
 								},
 							},
+							{
+								Name:      "hostname",
+								Path:      "/usr/bin/hostname",
+								Directory: false,
+								Owner:     "root",
+								Group:     "root",
+								Mode:      0711,
+								HelpText:  "Usage: hostname\n Show the system's host name.",
+								Exec: func(dir *Node, params []string) *tea.Cmd {
+									cmd := tea.Cmd(func() tea.Msg {
+										return OutputMsg(p.Hostname)
+									})
+
+									return &cmd
+								},
+							},
 							{
 								Name:      "lsb_release",
 								Path:      "/usr/bin/lsb_release",
@@ -585,22 +614,34 @@ func Initialize() {
 											return OutputMsg("No LSB modules are available.")
 										}
 
+										// Like the real one, prefer /etc/lsb-release to /etc/os-release.
+										value := func(lsbKey string, osKey string) string {
+											if v := osReleaseValue(p.LSBRelease, lsbKey); v != "" {
+												return v
+											}
+											return osReleaseValue(p.OSRelease, osKey)
+										}
+										id := strings.Fields(value("DISTRIB_ID", "NAME") + " n/a")[0]
+										description := value("DISTRIB_DESCRIPTION", "PRETTY_NAME")
+										release := value("DISTRIB_RELEASE", "VERSION_ID")
+										codename := value("DISTRIB_CODENAME", "VERSION_CODENAME")
+
 										for _, param := range params {
 											switch param {
 											case "-a":
-												return OutputMsg("Distributor ID: Hardhat\nDescription: Hardhat Linux 1.0\nRelease: 1.0\nCodename: hardhat")
+												return OutputMsg(fmt.Sprintf("Distributor ID: %s\nDescription: %s\nRelease: %s\nCodename: %s", id, description, release, codename))
 											case "-d":
-												return OutputMsg("Description: Hardhat Linux 1.0")
+												return OutputMsg("Description: " + description)
 											case "-r":
-												return OutputMsg("Release: 1.0")
+												return OutputMsg("Release: " + release)
 											case "-c":
-												return OutputMsg("Codename: hardhat")
+												return OutputMsg("Codename: " + codename)
 											case "-i":
-												return OutputMsg("Distributor ID: Hardhat")
+												return OutputMsg("Distributor ID: " + id)
 											case "-s":
-												return OutputMsg("Hardhat")
+												return OutputMsg(id)
 											case "-v":
-												return OutputMsg("Hardhat Linux 1.0")
+												return OutputMsg(description)
 											default:
 												return OutputMsg("lsb_release: invalid option -- '" + param + "'")
 											}
@@ -633,7 +674,7 @@ func Initialize() {
 				Path:      "/home",
 				Directory: true,
 				Children: []*Node{
-					HomeDir,
+					home,
 				},
 				Owner: "root",
 				Group: "root",
@@ -643,5 +684,10 @@ func Initialize() {
 		Group: "root",
 	}
 
-	applyAdditionalNodes()
+	if p.LSBRelease != "" {
+		etc := lookup(root, "/etc")
+		etc.Children = append(etc.Children, newFile("/etc/lsb-release", []byte(p.LSBRelease), 0644))
+	}
+
+	return root, home
 }
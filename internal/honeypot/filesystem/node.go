@@ -36,7 +36,7 @@ func GetNodeByPath(currentNode *Node, path string, flags ...int) (*Node, error)
 		return parent, nil
 	} else if strings.HasPrefix(path, "/") {
 		// If the path starts with a /, look from the root
-		return GetNodeByPath(SystemRoot, path[1:], depth+1)
+		return GetNodeByPath(currentNode.Root(), path[1:], depth+1)
 	} else if strings.HasPrefix(path, "./") {
 		// If the path starts with ./, look from the current directory
 		return GetNodeByPath(currentNode, path[2:], depth+1)
@@ -76,10 +76,6 @@ func GetNodeByPath(currentNode *Node, path string, flags ...int) (*Node, error)
 	}
 }
 
-func GetRoot() *Node {
-	return SystemRoot
-}
-
 func GetContent(currentNode *Node, path string, user string, group string) ([]byte, error) {
 	if node, err := GetNodeByPath(currentNode, path); err == nil {
 		if !node.IsReadable(user, group) {
@@ -117,6 +113,8 @@ type Node struct {
 	Group       string                         `json:"group"`
 	Mode        int                            `json:"mode"`                // File mode (permissions)
 	HelpText    string                         `json:"help_text,omitempty"` // Help text for the node, if applicable
+
+	root *Node // Root of the tree the node is in
 }
 
 func (n *Node) IsDirectory() bool {
@@ -175,7 +173,7 @@ func (n *Node) Parent() *Node {
 	if len(path) < 2 {
 		return nil
 	} else if len(path) == 2 {
-		return SystemRoot
+		return n.Root()
 	}
 
 	res, err := GetNodeByPath(n, strings.Join(path[:len(path)-1], "/"))
@@ -186,6 +184,16 @@ func (n *Node) Parent() *Node {
 	return res
 }
 
+// Root returns the root of the tree the node is in, or the node itself if
+// it isn't in one.
+func (n *Node) Root() *Node {
+	if n.root != nil {
+		return n.root
+	}
+
+	return n
+}
+
 func (n *Node) Child(name string) *Node {
 	if n.IsFile() || n.Children == nil || len(n.Children) == 0 {
 		return nil
@@ -0,0 +1,101 @@
+package filesystem
+
+import (
+	"slices"
+	"strings"
+)
+
+// Profile describes the machine a filesystem belongs to, as shown by uname,
+// hostname, lsb_release and the files in /etc.
+type Profile struct {
+	Hostname      string
+	OSRelease     string   // Contents of /etc/os-release
+	LSBRelease    string   // Contents of /etc/lsb-release, which lsb_release prefers to OSRelease
+	KernelName    string   // uname -s
+	KernelRelease string   // uname -r
+	KernelVersion string   // uname -v
+	Machine       string   // uname -m
+	OS            string   // uname -o
+	Commands      []string // Commands left in /usr/bin, or nil for all of them
+	Nodes         []Node   // Added after the configured filesystem nodes
+}
+
+// DefaultProfile is the machine sessions see unless their persona says
+// otherwise.
+var DefaultProfile = Profile{
+	Hostname:      "Hardhat",
+	OSRelease:     "PRETTY_NAME=\"Hardhat Linux\"\nNAME=\"Hardhat Linux\"\nID=hardhat\nID_LIKE=debian\nVERSION_ID=\"1.0\"\nVERSION=\"1.0\"\nVERSION_CODENAME=\"fozzie\"\n",
+	LSBRelease:    "DISTRIB_ID=Hardhat\nDISTRIB_RELEASE=1.0\nDISTRIB_CODENAME=hardhat\nDISTRIB_DESCRIPTION=\"Hardhat Linux 1.0\"\n",
+	KernelName:    "Linux",
+	KernelRelease: "6.22.0-81-generic",
+	KernelVersion: "#148-HardHat SMP Fri Mar 14 19:05:48 UTC 2025",
+	Machine:       "x86_64",
+	OS:            "Hardhat Linux",
+}
+
+// withDefaults fills in what the profile leaves out from DefaultProfile.
+func (p Profile) withDefaults() Profile {
+	fill := func(s *string, def string) {
+		if *s == "" {
+			*s = def
+		}
+	}
+
+	fill(&p.Hostname, DefaultProfile.Hostname)
+	if p.OSRelease == "" && p.LSBRelease == "" {
+		p.LSBRelease = DefaultProfile.LSBRelease
+	}
+	fill(&p.OSRelease, DefaultProfile.OSRelease)
+	fill(&p.KernelName, DefaultProfile.KernelName)
+	fill(&p.KernelRelease, DefaultProfile.KernelRelease)
+	fill(&p.KernelVersion, DefaultProfile.KernelVersion)
+	fill(&p.Machine, DefaultProfile.Machine)
+	fill(&p.OS, DefaultProfile.OS)
+
+	return p
+}
+
+// Commands returns the names of the built-in commands in /usr/bin.
+func Commands() []string {
+	root, _ := newTree(DefaultProfile)
+
+	var names []string
+	for _, n := range lookup(root, "/usr/bin").Children {
+		names = append(names, n.Name)
+	}
+
+	return names
+}
+
+// keepCommands removes the built-in commands that aren't listed.
+func keepCommands(root *Node, commands []string) {
+	bin := lookup(root, "/usr/bin")
+	if bin == nil {
+		return
+	}
+
+	bin.Children = slices.DeleteFunc(bin.Children, func(n *Node) bool {
+		return !slices.Contains(commands, n.Name)
+	})
+}
+
+// setRoot points every node in the tree at its root, so absolute paths are
+// looked up in the right tree.
+func setRoot(n *Node, root *Node) {
+	n.root = root
+	for _, child := range n.Children {
+		setRoot(child, root)
+	}
+}
+
+// osReleaseValue returns a setting from the contents of an os-release file.
+func osReleaseValue(osRelease string, key string) string {
+	for _, line := range strings.Split(osRelease, "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && k == key {
+			return strings.Trim(v, `"'`)
+		}
+	}
+
+	return ""
+}
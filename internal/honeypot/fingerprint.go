@@ -0,0 +1,177 @@
+package honeypot
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+)
+
+const (
+	msgKexInit = 20 // SSH_MSG_KEXINIT
+
+	// Most of a connection's opening bytes kept while looking for the client's
+	// KEXINIT. OpenSSH's own is under 2KB.
+	maxKexInitBytes = 64 * 1024
+)
+
+var contextKeyKexInit = &struct{ name string }{"kex-init"}
+
+// clientKexInit is what a client offered in its KEXINIT, in its order of
+// preference. Only the client to server directions are kept, as in HASSH.
+type clientKexInit struct {
+	KexAlgorithms     []string
+	HostKeyAlgorithms []string
+	Ciphers           []string
+	MACs              []string
+	Compression       []string
+}
+
+// hasshAlgorithms returns the string the HASSH is the MD5 of.
+func (k *clientKexInit) hasshAlgorithms() string {
+	return strings.Join([]string{
+		strings.Join(k.KexAlgorithms, ","),
+		strings.Join(k.Ciphers, ","),
+		strings.Join(k.MACs, ","),
+		strings.Join(k.Compression, ","),
+	}, ";")
+}
+
+// hassh returns the client's HASSH fingerprint, which is the same for every
+// connection from the same SSH library and settings.
+func (k *clientKexInit) hassh() string {
+	sum := md5.Sum([]byte(k.hasshAlgorithms()))
+	return hex.EncodeToString(sum[:])
+}
+
+// metadata describes the client's KEXINIT for events, or is empty if the
+// client never sent one.
+func (k *clientKexInit) metadata() entity.EventMetadata {
+	if k == nil {
+		return nil
+	}
+
+	return entity.KexInitMetadata(k.hassh(), k.hasshAlgorithms(), k.KexAlgorithms, k.HostKeyAlgorithms, k.Ciphers, k.MACs, k.Compression)
+}
+
+// kexInitConn keeps what the client sends until its KEXINIT has been read.
+// That's sent in the clear before the handshake, which doesn't hand it out.
+type kexInitConn struct {
+	net.Conn
+	mu      sync.Mutex
+	buf     []byte
+	done    bool
+	kexInit *clientKexInit
+}
+
+// sniffKexInit wraps the connection to capture the client's KEXINIT for the
+// connection's context.
+func sniffKexInit(ctx ssh.Context, conn net.Conn) net.Conn {
+	kc := &kexInitConn{Conn: conn}
+	ctx.SetValue(contextKeyKexInit, kc)
+
+	return kc
+}
+
+func (c *kexInitConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+
+	c.mu.Lock()
+	if !c.done && n > 0 {
+		c.buf = append(c.buf, p[:n]...)
+		kexInit, perr := parseKexInit(c.buf)
+		if kexInit != nil || perr != nil || len(c.buf) > maxKexInitBytes {
+			c.kexInit, c.done, c.buf = kexInit, true, nil
+		}
+	}
+	c.mu.Unlock()
+
+	return n, err
+}
+
+// KexInit returns the client's KEXINIT, or nil if it hasn't been read.
+func (c *kexInitConn) KexInit() *clientKexInit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.kexInit
+}
+
+// contextKexInit returns what the connection's client offered in its KEXINIT,
+// or nil if it isn't known.
+func contextKexInit(ctx ssh.Context) *clientKexInit {
+	if kc, ok := ctx.Value(contextKeyKexInit).(*kexInitConn); ok {
+		return kc.KexInit()
+	}
+
+	return nil
+}
+
+var errNotKexInit = errors.New("first packet isn't a KEXINIT")
+
+// parseKexInit reads the KEXINIT from the start of a client's side of a
+// connection. It returns nil and no error until enough has arrived.
+func parseKexInit(data []byte) (*clientKexInit, error) {
+	// Skip the identification string, and any lines before it.
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return nil, nil
+		}
+		line := data[:i]
+		data = data[i+1:]
+		if bytes.HasPrefix(line, []byte("SSH-")) {
+			break
+		}
+	}
+
+	// uint32 packet_length, byte padding_length, payload, padding
+	if len(data) < 5 {
+		return nil, nil
+	}
+	length := binary.BigEndian.Uint32(data)
+	padding := uint32(data[4])
+	if length > maxKexInitBytes || padding+1 > length {
+		return nil, errNotKexInit
+	}
+	if uint32(len(data)) < 4+length {
+		return nil, nil
+	}
+	payload := data[5 : 4+length-padding]
+
+	// byte SSH_MSG_KEXINIT, byte[16] cookie, then the name-lists
+	if len(payload) < 17 || payload[0] != msgKexInit {
+		return nil, errNotKexInit
+	}
+	payload = payload[17:]
+
+	var lists [8][]string
+	for i := range lists {
+		if len(payload) < 4 {
+			return nil, errNotKexInit
+		}
+		n := binary.BigEndian.Uint32(payload)
+		if uint32(len(payload)-4) < n {
+			return nil, errNotKexInit
+		}
+		if n > 0 {
+			lists[i] = strings.Split(string(payload[4:4+n]), ",")
+		}
+		payload = payload[4+n:]
+	}
+
+	return &clientKexInit{
+		KexAlgorithms:     lists[0],
+		HostKeyAlgorithms: lists[1],
+		Ciphers:           lists[2],
+		MACs:              lists[4],
+		Compression:       lists[6],
+	}, nil
+}
@@ -0,0 +1,205 @@
+package honeypot
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHASSH(t *testing.T) {
+	tests := []struct {
+		name       string
+		kexInit    clientKexInit
+		algorithms string
+		hassh      string
+	}{
+		{
+			name: "modern client",
+			kexInit: clientKexInit{
+				KexAlgorithms:     []string{"curve25519-sha256", "ecdh-sha2-nistp256"},
+				HostKeyAlgorithms: []string{"ssh-ed25519", "rsa-sha2-512"},
+				Ciphers:           []string{"aes128-ctr", "aes256-gcm@openssh.com"},
+				MACs:              []string{"hmac-sha2-256"},
+				Compression:       []string{"none"},
+			},
+			algorithms: "curve25519-sha256,ecdh-sha2-nistp256;aes128-ctr,aes256-gcm@openssh.com;hmac-sha2-256;none",
+			hassh:      "afde4c3973668bf8076d0e219dab18c3",
+		},
+		{
+			name: "old bot",
+			kexInit: clientKexInit{
+				KexAlgorithms: []string{"diffie-hellman-group14-sha1"},
+				Ciphers:       []string{"aes128-cbc"},
+				MACs:          []string{"hmac-sha1"},
+				Compression:   []string{"none", "zlib"},
+			},
+			algorithms: "diffie-hellman-group14-sha1;aes128-cbc;hmac-sha1;none,zlib",
+			hassh:      "12fae898c5e60c977f03ad2f80635470",
+		},
+		{
+			name: "host key algorithms aren't part of it",
+			kexInit: clientKexInit{
+				KexAlgorithms:     []string{"diffie-hellman-group14-sha1"},
+				HostKeyAlgorithms: []string{"ssh-rsa", "ssh-dss"},
+				Ciphers:           []string{"aes128-cbc"},
+				MACs:              []string{"hmac-sha1"},
+				Compression:       []string{"none", "zlib"},
+			},
+			algorithms: "diffie-hellman-group14-sha1;aes128-cbc;hmac-sha1;none,zlib",
+			hassh:      "12fae898c5e60c977f03ad2f80635470",
+		},
+		{
+			name: "empty lists",
+			kexInit: clientKexInit{
+				KexAlgorithms: []string{"curve25519-sha256"},
+				Ciphers:       []string{"chacha20-poly1305@openssh.com"},
+				Compression:   []string{"none"},
+			},
+			algorithms: "curve25519-sha256;chacha20-poly1305@openssh.com;;none",
+			hassh:      "4ce9fbe1fd4945ba6d8f575ad05e1c64",
+		},
+		{
+			name:       "nothing offered",
+			algorithms: ";;;",
+			hassh:      "95420f9d932ddd22833f17b96a80bedb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.kexInit.hasshAlgorithms(); got != tt.algorithms {
+				t.Errorf("hasshAlgorithms() = %q, want %q", got, tt.algorithms)
+			}
+			if got := tt.kexInit.hassh(); got != tt.hassh {
+				t.Errorf("hassh() = %q, want %q", got, tt.hassh)
+			}
+		})
+	}
+}
+
+func TestParseKexInit(t *testing.T) {
+	lists := [][]string{
+		{"curve25519-sha256", "ecdh-sha2-nistp256"}, // kex
+		{"ssh-ed25519"},                          // host key
+		{"aes128-ctr", "aes256-gcm@openssh.com"}, // ciphers, client to server
+		{"aes128-ctr"},                           // ciphers, server to client
+		{"hmac-sha2-256"},                        // MACs, client to server
+		{"hmac-sha1"},                            // MACs, server to client
+		{"none"},                                 // compression, client to server
+		{"none", "zlib"},                         // compression, server to client
+	}
+	packet := kexInitPacket(msgKexInit, lists)
+	want := &clientKexInit{
+		KexAlgorithms:     lists[0],
+		HostKeyAlgorithms: lists[1],
+		Ciphers:           lists[2],
+		MACs:              lists[4],
+		Compression:       lists[6],
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *clientKexInit // nil when more is needed or on error
+		wantErr bool
+	}{
+		{
+			name: "whole KEXINIT",
+			data: cat("SSH-2.0-OpenSSH_9.6\r\n", packet),
+			want: want,
+		},
+		{
+			name: "lines before the identification",
+			data: cat("hello\r\nSSH-2.0-Go\r\n", packet),
+			want: want,
+		},
+		{
+			name: "identification not finished",
+			data: []byte("SSH-2.0-Open"),
+		},
+		{
+			name: "packet not finished",
+			data: cat("SSH-2.0-Go\r\n", packet[:len(packet)/2]),
+		},
+		{
+			name: "length not finished",
+			data: cat("SSH-2.0-Go\r\n", packet[:3]),
+		},
+		{
+			name:    "another message first",
+			data:    cat("SSH-2.0-Go\r\n", kexInitPacket(21, lists)),
+			wantErr: true,
+		},
+		{
+			name:    "packet too long",
+			data:    cat("SSH-2.0-Go\r\n", []byte{0x7f, 0xff, 0xff, 0xff, 4}),
+			wantErr: true,
+		},
+		{
+			name:    "padding longer than the packet",
+			data:    cat("SSH-2.0-Go\r\n", []byte{0, 0, 0, 8, 200}),
+			wantErr: true,
+		},
+		{
+			name:    "name-lists cut short",
+			data:    cat("SSH-2.0-Go\r\n", kexInitPacket(msgKexInit, lists[:3])),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseKexInit(tt.data)
+			if tt.wantErr {
+				if !errors.Is(err, errNotKexInit) {
+					t.Fatalf("error = %v, want errNotKexInit", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("parseKexInit() = %+v, want %+v", got, tt.want)
+			}
+			if got == nil {
+				return
+			}
+			if !slices.Equal(got.KexAlgorithms, tt.want.KexAlgorithms) ||
+				!slices.Equal(got.HostKeyAlgorithms, tt.want.HostKeyAlgorithms) ||
+				!slices.Equal(got.Ciphers, tt.want.Ciphers) ||
+				!slices.Equal(got.MACs, tt.want.MACs) ||
+				!slices.Equal(got.Compression, tt.want.Compression) {
+				t.Errorf("parseKexInit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// kexInitPacket builds a binary packet with the message type, a cookie, the
+// name-lists, the first_kex_packet_follows flag and a reserved uint32.
+func kexInitPacket(msg byte, lists [][]string) []byte {
+	payload := append([]byte{msg}, make([]byte, 16)...)
+	for _, l := range lists {
+		name := strings.Join(l, ",")
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(name)))
+		payload = append(payload, name...)
+	}
+	if len(lists) == 8 {
+		payload = append(payload, 0, 0, 0, 0, 0)
+	}
+
+	padding := 4
+	packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)+padding))
+	packet = append(packet, byte(padding))
+	packet = append(packet, payload...)
+
+	return append(packet, make([]byte, padding)...)
+}
+
+func cat(s string, b []byte) []byte {
+	return append([]byte(s), b...)
+}
@@ -0,0 +1,206 @@
+package honeypot
+
+import (
+	"io"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	// Most of what a sinkholed direct-tcpip channel sends that's kept.
+	forwardPreviewBytes = 1024
+	// How long a sinkholed channel is held open waiting for it.
+	forwardPreviewTimeout = 10 * time.Second
+)
+
+// SSH request and channel types the pot records.
+const (
+	requestDirectTCPIP   = "direct-tcpip"
+	requestTCPIPForward  = "tcpip-forward"
+	requestCancelForward = "cancel-tcpip-forward"
+	requestAgent         = "auth-agent-req@openssh.com"
+	requestX11           = "x11-req"
+	requestEnv           = "env"
+)
+
+// forwardSinkhole reports whether forwarding requests should look like they
+// worked.
+func forwardSinkhole() bool {
+	cfg := config.Current()
+	return cfg != nil && cfg.ForwardSinkhole
+}
+
+// recordRequest records a forwarding or environment request as an event.
+func recordRequest(ctx ssh.Context, action string, request string, accepted bool, metadata entity.EventMetadata) {
+	md := entity.RequestMetadata(ctx.SessionID(), request, accepted).Merge(metadata)
+	if err := newContextEvent(ctx, true, entity.EventTypeRequest, action, md); err != nil {
+		log.Error("Error saving request event", "error", err)
+	}
+}
+
+// directTCPIPHandler records clients trying to use the pot as a proxy. With
+// the sinkhole on, the channel is opened and whatever the client sends first
+// is kept, but nothing is ever connected to.
+func directTCPIPHandler(_ *ssh.Server, _ *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+	var d struct {
+		DestAddr   string
+		DestPort   uint32
+		OriginAddr string
+		OriginPort uint32
+	}
+	if err := gossh.Unmarshal(newChan.ExtraData(), &d); err != nil {
+		newChan.Reject(gossh.ConnectionFailed, "error parsing forward data")
+		return
+	}
+
+	dest := net.JoinHostPort(d.DestAddr, strconv.Itoa(int(d.DestPort)))
+	md := entity.EventMetadata{
+		"host":        d.DestAddr,
+		"port":        d.DestPort,
+		"origin_host": d.OriginAddr,
+		"origin_port": d.OriginPort,
+	}
+
+	if !forwardSinkhole() {
+		newChan.Reject(gossh.Prohibited, "administratively prohibited: open failed")
+		recordRequest(ctx, "Refused a connection to "+dest, requestDirectTCPIP, false, md)
+		return
+	}
+
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		return
+	}
+	go gossh.DiscardRequests(reqs)
+
+	// Closing the channel ends the read if the client is waiting on us.
+	timer := time.AfterFunc(forwardPreviewTimeout, func() { ch.Close() })
+	preview, _ := io.ReadAll(io.LimitReader(ch, forwardPreviewBytes))
+	timer.Stop()
+	ch.Close()
+
+	md["preview"] = string(preview)
+	md["preview_bytes"] = len(preview)
+	recordRequest(ctx, "Sinkholed a connection to "+dest, requestDirectTCPIP, true, md)
+}
+
+// tcpipForwardHandler records clients asking the pot to listen for them. With
+// the sinkhole on it says yes, but never listens.
+func tcpipForwardHandler(ctx ssh.Context, _ *ssh.Server, req *gossh.Request) (bool, []byte) {
+	var r struct {
+		BindAddr string
+		BindPort uint32
+	}
+	if err := gossh.Unmarshal(req.Payload, &r); err != nil {
+		return false, nil
+	}
+
+	bind := net.JoinHostPort(r.BindAddr, strconv.Itoa(int(r.BindPort)))
+	md := entity.EventMetadata{"host": r.BindAddr, "port": r.BindPort}
+
+	if req.Type == requestCancelForward {
+		recordRequest(ctx, "Cancelled forwarding from "+bind, req.Type, forwardSinkhole(), md)
+		return forwardSinkhole(), nil
+	}
+
+	if !forwardSinkhole() {
+		recordRequest(ctx, "Refused forwarding from "+bind, req.Type, false, md)
+		return false, nil
+	}
+
+	// Asking for port 0 means any port, which the reply has to name.
+	port := r.BindPort
+	if port == 0 {
+		port = 32768 + rand.Uint32N(28232)
+		md["bound_port"] = port
+	}
+	recordRequest(ctx, "Pretended to forward from "+bind, req.Type, true, md)
+
+	return true, gossh.Marshal(struct{ Port uint32 }{port})
+}
+
+// sessionHandler is the SSH library's session handler, with the session's
+// agent, X11 and environment requests recorded on the way in.
+func sessionHandler(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+	ssh.DefaultSessionHandler(srv, conn, &sessionChannel{NewChannel: newChan, ctx: ctx}, ctx)
+}
+
+// sessionChannel hands the session its requests once they've been recorded.
+type sessionChannel struct {
+	gossh.NewChannel
+	ctx ssh.Context
+}
+
+func (c *sessionChannel) Accept() (gossh.Channel, <-chan *gossh.Request, error) {
+	ch, reqs, err := c.NewChannel.Accept()
+	if err != nil {
+		return ch, reqs, err
+	}
+
+	out := make(chan *gossh.Request)
+	go func() {
+		defer close(out)
+		for req := range reqs {
+			if sessionRequest(c.ctx, req) {
+				out <- req
+			}
+		}
+	}()
+
+	return ch, out, nil
+}
+
+// sessionRequest records agent, X11 and environment requests, answering the
+// forwarding ones itself, and reports whether the session should still get
+// the request.
+func sessionRequest(ctx ssh.Context, req *gossh.Request) bool {
+	switch req.Type {
+	case requestEnv:
+		var kv struct{ Key, Value string }
+		if err := gossh.Unmarshal(req.Payload, &kv); err != nil {
+			return true
+		}
+		md := entity.EventMetadata{"key": kv.Key, "value": kv.Value}
+		recordRequest(ctx, "Set "+kv.Key, req.Type, true, md)
+		return true
+	case requestAgent:
+		sinkhole := forwardSinkhole()
+		action := "Refused agent forwarding"
+		if sinkhole {
+			action = "Pretended to forward the agent"
+		}
+		recordRequest(ctx, action, req.Type, sinkhole, nil)
+		req.Reply(sinkhole, nil)
+		return false
+	case requestX11:
+		var x struct {
+			SingleConnection bool
+			AuthProtocol     string
+			AuthCookie       string
+			Screen           uint32
+		}
+		md := entity.EventMetadata{}
+		if err := gossh.Unmarshal(req.Payload, &x); err == nil {
+			md["auth_protocol"] = x.AuthProtocol
+			md["screen"] = x.Screen
+		}
+		sinkhole := forwardSinkhole()
+		action := "Refused X11 forwarding"
+		if sinkhole {
+			action = "Pretended to forward X11"
+		}
+		recordRequest(ctx, action, req.Type, sinkhole, md)
+		req.Reply(sinkhole, nil)
+		return false
+	}
+
+	return true
+}
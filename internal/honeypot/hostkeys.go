@@ -0,0 +1,197 @@
+package honeypot
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/charmbracelet/keygen"
+	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// hostKeyFiles are the host keys each persona has, made the way ssh-keygen -A
+// would when they're missing.
+var hostKeyFiles = []struct {
+	name string
+	opts []keygen.Option
+}{
+	{"id_rsa", []keygen.Option{keygen.WithKeyType(keygen.RSA), keygen.WithBitSize(3072)}},
+	{"id_ecdsa", []keygen.Option{keygen.WithKeyType(keygen.ECDSA), keygen.WithEllipticCurve(elliptic.P256())}},
+	{"id_ed25519", []keygen.Option{keygen.WithKeyType(keygen.Ed25519)}},
+}
+
+var (
+	hostKeyDir    string // The app's .ssh directory, set when the pot starts
+	hostKeysMu    sync.Mutex
+	hostKeysCache = map[string][]gossh.Signer{} // Loaded keys by directory
+)
+
+// personaKeyDir is where a persona's host keys are kept. Personas get their
+// own so they can't be tied together by fingerprint; the default uses the
+// app's .ssh directory, which has had id_ed25519 all along.
+func personaKeyDir(name string) string {
+	if name == defaultPersona {
+		return hostKeyDir
+	}
+
+	return filepath.Join(hostKeyDir, "personas", name)
+}
+
+// LoadHostKeys loads the default persona's host keys and those of every
+// persona given, making any that are missing. Call it before the personas
+// take effect, so connections never wait on making keys.
+func LoadHostKeys(personas []config.Persona) {
+	if hostKeyDir == "" {
+		return // Not started yet; StartHoneyPot loads them
+	}
+
+	if _, err := loadHostKeys(personaKeyDir(defaultPersona)); err != nil {
+		log.Error("Could not load host keys", "persona", defaultPersona, "error", err)
+	}
+
+	for _, p := range personas {
+		keys, err := loadHostKeys(personaKeyDir(p.Name))
+		if err != nil {
+			log.Error("Could not load host keys", "persona", p.Name, "error", err)
+			continue
+		}
+		if len(offeredHostKeys(keys, p.HostKeyAlgorithms)) == 0 {
+			log.Warn("None of the persona's host keys can sign with its host_key_algorithms, so every key will be offered", "persona", p.Name, "algorithms", p.HostKeyAlgorithms)
+		}
+	}
+}
+
+// loadHostKeys loads the host keys in dir, making any that are missing. Keys
+// are made without holding hostKeysMu, since an RSA key takes a while.
+func loadHostKeys(dir string) ([]gossh.Signer, error) {
+	if signers := cachedHostKeys(dir); signers != nil {
+		return signers, nil
+	}
+
+	var signers []gossh.Signer
+	var errs []error
+	for _, f := range hostKeyFiles {
+		path := filepath.Join(dir, f.name)
+		kp, err := keygen.New(path, append(f.opts, keygen.WithWrite())...)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		signers = append(signers, kp.Signer())
+	}
+	if len(signers) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		log.Warn("Could not load every host key", "dir", dir, "error", errors.Join(errs...))
+	}
+
+	hostKeysMu.Lock()
+	defer hostKeysMu.Unlock()
+
+	if cached, ok := hostKeysCache[dir]; ok {
+		return cached, nil
+	}
+	hostKeysCache[dir] = signers
+	return signers, nil
+}
+
+// cachedHostKeys returns the host keys LoadHostKeys loaded from dir, or nil
+// if it hasn't.
+func cachedHostKeys(dir string) []gossh.Signer {
+	hostKeysMu.Lock()
+	defer hostKeysMu.Unlock()
+
+	return hostKeysCache[dir]
+}
+
+// offeredHostKeys returns the keys restricted to the given host key
+// algorithms, ordered by where their first algorithm is in the list. With no
+// algorithms given every key is offered with all of its algorithms.
+func offeredHostKeys(keys []gossh.Signer, algorithms []string) []gossh.Signer {
+	if len(algorithms) == 0 {
+		return keys
+	}
+
+	type offered struct {
+		signer gossh.Signer
+		first  int
+	}
+	var out []offered
+	for _, k := range keys {
+		var algos []string
+		first := len(algorithms)
+		for i, a := range algorithms {
+			if keyAlgorithm(a) == k.PublicKey().Type() {
+				algos = append(algos, a)
+				first = min(first, i)
+			}
+		}
+		if len(algos) == 0 {
+			continue
+		}
+
+		as, ok := k.(gossh.AlgorithmSigner)
+		if !ok {
+			continue
+		}
+		signer, err := gossh.NewSignerWithAlgorithms(as, algos)
+		if err != nil {
+			log.Warn("Could not restrict host key algorithms", "key", k.PublicKey().Type(), "error", err)
+			continue
+		}
+		out = append(out, offered{signer, first})
+	}
+
+	slices.SortStableFunc(out, func(a, b offered) int { return a.first - b.first })
+
+	signers := make([]gossh.Signer, len(out))
+	for i, o := range out {
+		signers[i] = o.signer
+	}
+	return signers
+}
+
+// keyAlgorithm returns the key type a host key algorithm signs with.
+func keyAlgorithm(algorithm string) string {
+	switch algorithm {
+	case gossh.KeyAlgoRSASHA256, gossh.KeyAlgoRSASHA512:
+		return gossh.KeyAlgoRSA
+	}
+
+	return algorithm
+}
+
+// noHostKey stands in for the server's host keys. The SSH server adds its own
+// keys to every connection after serverConfig has added the persona's, and
+// makes one up if it has none, so it's given this, which offers no
+// algorithms and is never picked.
+type noHostKey struct{}
+
+func (noHostKey) PublicKey() gossh.PublicKey { return noHostKeyPublic{} }
+func (noHostKey) Algorithms() []string       { return nil }
+
+func (noHostKey) Sign(io.Reader, []byte) (*gossh.Signature, error) {
+	return nil, errors.New("no host key")
+}
+
+func (noHostKey) SignWithAlgorithm(io.Reader, []byte, string) (*gossh.Signature, error) {
+	return nil, errors.New("no host key")
+}
+
+type noHostKeyPublic struct{}
+
+func (noHostKeyPublic) Type() string { return "none@honeybear" }
+
+func (noHostKeyPublic) Marshal() []byte {
+	return gossh.Marshal(struct{ Type string }{"none@honeybear"})
+}
+
+func (noHostKeyPublic) Verify([]byte, *gossh.Signature) error {
+	return errors.New("no host key")
+}
@@ -0,0 +1,378 @@
+package honeypot
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/embedded"
+)
+
+// Most of a request body that's read and kept.
+const httpMaxBody = 64 << 10
+
+// Form fields login pages post usernames and passwords in, covering the
+// built-in templates and most real apps.
+var (
+	httpUserFields     = []string{"username", "user", "log", "pma_username", "login", "email", "uname"}
+	httpPasswordFields = []string{"password", "pass", "pwd", "pma_password", "passwd", "pw"}
+)
+
+var (
+	httpPorts     []string                    // Ports the pot answers HTTP on
+	httpListeners = map[string]net.Listener{} // Open HTTP listeners by port, guarded by listenersMu
+
+	httpServer = &http.Server{
+		Handler:           http.HandlerFunc(serveHTTPRequest),
+		ConnContext:       httpConnContext,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       time.Minute,
+		MaxHeaderBytes:    httpMaxBody,
+		ErrorLog:          log.StandardLog(log.StandardLogOptions{ForceLevel: log.DebugLevel}),
+	}
+
+	contextKeyHTTPConn = &struct{ name string }{"http-conn"}
+
+	httpTemplatesMu sync.RWMutex
+	httpTemplates   = map[httpTemplateKey]*httpTemplate{} // Parsed by LoadHTTPTemplates
+)
+
+// httpTemplateKey is what picks an app's parsed template.
+type httpTemplateKey struct {
+	template     string
+	templateFile string
+	contentType  string
+}
+
+// httpTemplate is an app's page, parsed and ready to render.
+type httpTemplate struct {
+	page interface {
+		Execute(io.Writer, any) error
+	}
+	contentType string
+}
+
+// httpConn is what the HTTP honey pot knows about a connection.
+type httpConn struct {
+	id      string // Ties together the events from the connection's requests
+	port    string
+	persona *persona
+}
+
+// SetHTTPPorts sets the ports the pot answers HTTP on. Once the pot is
+// running it starts and stops listening to match, without dropping
+// connections already made.
+func SetHTTPPorts(ports []string) error {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	httpPorts = slices.Clone(ports)
+	if potServer == nil {
+		return nil
+	}
+
+	return syncHTTPListeners()
+}
+
+// syncHTTPListeners opens and closes HTTP listeners to match httpPorts.
+// listenersMu must be held.
+func syncHTTPListeners() error {
+	return syncPortListeners("HTTP", httpPorts, httpListeners, func(port string, l net.Listener) {
+		al := &admittedListener{Listener: l, conns: make(chan net.Conn), done: make(chan struct{})}
+		go func() {
+			acceptPortConns(port, l, al.admit)
+			close(al.done)
+		}()
+		httpServer.Serve(al)
+	})
+}
+
+// admittedListener hands the HTTP server connections once they're past the
+// PROXY header, bans and limits. Reading a header can take a while, so it's
+// done off the server's accept loop.
+type admittedListener struct {
+	net.Listener
+	conns chan net.Conn
+	done  chan struct{} // Closed when the listener is
+}
+
+func (l *admittedListener) admit(pc *portConn) {
+	conn := admitPortConn(pc, false)
+	if conn == nil {
+		pc.Close()
+		return
+	}
+
+	select {
+	case l.conns <- &portConn{Conn: conn, port: pc.port}:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *admittedListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// httpConnContext picks the connection's persona when it's made.
+func httpConnContext(ctx context.Context, conn net.Conn) context.Context {
+	c := &httpConn{id: newSessionID()}
+	if pc, ok := conn.(*portConn); ok {
+		c.port = pc.port
+	}
+	c.persona = personaFor(c.port)
+
+	return context.WithValue(ctx, contextKeyHTTPConn, c)
+}
+
+// serveHTTPRequest answers a request with the persona's app for its path, and
+// records it along with any credentials it posted.
+func serveHTTPRequest(w http.ResponseWriter, r *http.Request) {
+	c, ok := r.Context().Value(contextKeyHTTPConn).(*httpConn)
+	if !ok {
+		c = &httpConn{id: newSessionID(), persona: personaFor("")}
+	}
+	p := c.persona
+	metricHTTPRequests.Inc()
+
+	body, _ := io.ReadAll(io.LimitReader(r.Body, httpMaxBody+1))
+	truncated := len(body) > httpMaxBody
+	if truncated {
+		body = body[:httpMaxBody]
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	user, password, login := httpCredentials(r)
+	status := p.renderHTTPApp(w, config.HTTPPageData{
+		Hostname:   p.profile.Hostname,
+		Server:     p.httpServer,
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		Port:       c.port,
+		RemoteAddr: r.RemoteAddr,
+		User:       user,
+		Failed:     login,
+	})
+
+	// Go takes the Host header out of the rest.
+	headers := map[string]string{"Host": r.Host}
+	for k, v := range r.Header {
+		headers[k] = strings.Join(v, ", ")
+	}
+	md := entity.HTTPMetadata(c.id, r.Method, r.URL.Path, r.URL.RawQuery, headers, string(body), truncated, status)
+	md["local_port"] = addrPort(r.Context().Value(http.LocalAddrContextKey).(net.Addr))
+	err := newAppEvent(appHTTP, user, r.RemoteAddr, p, true, entity.EventTypeHTTP, r.Method+" "+r.URL.RequestURI(), md)
+	if err != nil {
+		log.Error("Error saving HTTP event", "error", err)
+	}
+
+	if !login {
+		return
+	}
+
+	// The fake login pages never let anyone in.
+	md = entity.CredentialMetadata(c.id, password, false, "")
+	md["user_agent"] = r.UserAgent()
+	md["refused"] = refusedHTTPLogin
+	md["path"] = r.URL.Path
+	err = newAppEvent(appHTTP, user, r.RemoteAddr, p, true, entity.EventTypeAuth, "Password rejected", md)
+	if err != nil {
+		log.Error("Error saving auth event", "error", err)
+	}
+	loginDone(user, password, false)
+}
+
+// httpCredentials returns the username and password a request logged in
+// with, by HTTP basic auth or a posted form, and whether it had a password.
+func httpCredentials(r *http.Request) (string, string, bool) {
+	if user, password, ok := r.BasicAuth(); ok {
+		return user, password, true
+	}
+
+	if r.Method != http.MethodPost {
+		return "", "", false
+	}
+	r.ParseMultipartForm(httpMaxBody)
+
+	var user string
+	for _, f := range httpUserFields {
+		if r.PostForm.Has(f) {
+			user = r.PostForm.Get(f)
+			break
+		}
+	}
+	for _, f := range httpPasswordFields {
+		if r.PostForm.Has(f) {
+			return user, r.PostForm.Get(f), true
+		}
+	}
+
+	return user, "", false
+}
+
+// httpApp returns the app the persona serves at path, or nil if there isn't
+// one. Exact paths win over the longest matching path ending in *.
+func (p *persona) httpApp(path string) *config.HTTPApp {
+	var match *config.HTTPApp
+	longest := -1
+	for i, a := range p.httpApps {
+		for _, ap := range a.Paths {
+			if ap == path {
+				return &p.httpApps[i]
+			}
+			if prefix, ok := strings.CutSuffix(ap, "*"); ok && strings.HasPrefix(path, prefix) && len(prefix) > longest {
+				match, longest = &p.httpApps[i], len(prefix)
+			}
+		}
+	}
+
+	return match
+}
+
+// renderHTTPApp writes the page for the request's path, or a not found page,
+// and returns the status sent.
+func (p *persona) renderHTTPApp(w http.ResponseWriter, data config.HTTPPageData) int {
+	app := p.httpApp(data.Path)
+	status := http.StatusNotFound
+	if app == nil {
+		app = &config.HTTPApp{Template: "not-found"}
+	} else {
+		status = cmp.Or(app.Status, http.StatusOK)
+	}
+
+	if p.httpServer != "" {
+		w.Header().Set("Server", p.httpServer)
+	}
+
+	t, err := cachedHTTPTemplate(app)
+
+	var page bytes.Buffer
+	if err == nil {
+		err = t.page.Execute(&page, data)
+	}
+	if err != nil {
+		log.Error("Could not render HTTP app", "template", cmp.Or(app.Template, app.TemplateFile), "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", t.contentType)
+	w.WriteHeader(status)
+	w.Write(page.Bytes())
+
+	return status
+}
+
+// LoadHTTPTemplates reads and parses the templates of every HTTP app in cfg,
+// top level and in personas, so requests don't. Call it before the config
+// takes effect; template files edited since are picked up the same way.
+func LoadHTTPTemplates(cfg *config.Config) {
+	apps := append([]config.HTTPApp{{Template: "not-found"}}, cfg.HTTPApps...)
+	for _, p := range cfg.Personas {
+		apps = append(apps, p.HTTPApps...)
+	}
+
+	templates := map[httpTemplateKey]*httpTemplate{}
+	for _, app := range apps {
+		key := httpTemplateKeyFor(&app)
+		if _, ok := templates[key]; ok {
+			continue
+		}
+
+		t, err := parseHTTPTemplate(&app)
+		if err != nil {
+			log.Error("Could not load HTTP app template", "template", cmp.Or(app.Template, app.TemplateFile), "error", err)
+			continue
+		}
+		templates[key] = t
+	}
+
+	httpTemplatesMu.Lock()
+	httpTemplates = templates
+	httpTemplatesMu.Unlock()
+}
+
+func httpTemplateKeyFor(app *config.HTTPApp) httpTemplateKey {
+	return httpTemplateKey{template: app.Template, templateFile: app.TemplateFile, contentType: app.ContentType}
+}
+
+// cachedHTTPTemplate returns an app's template as LoadHTTPTemplates parsed
+// it, parsing it now if it couldn't then.
+func cachedHTTPTemplate(app *config.HTTPApp) (*httpTemplate, error) {
+	key := httpTemplateKeyFor(app)
+
+	httpTemplatesMu.RLock()
+	t, ok := httpTemplates[key]
+	httpTemplatesMu.RUnlock()
+	if ok {
+		return t, nil
+	}
+
+	t, err := parseHTTPTemplate(app)
+	if err != nil {
+		return nil, err
+	}
+
+	httpTemplatesMu.Lock()
+	httpTemplates[key] = t
+	httpTemplatesMu.Unlock()
+
+	return t, nil
+}
+
+// parseHTTPTemplate reads and parses an app's template. HTML pages get
+// escaping, so a Host header can't put script in them.
+func parseHTTPTemplate(app *config.HTTPApp) (*httpTemplate, error) {
+	source, file, err := loadHTTPTemplate(app)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &httpTemplate{
+		contentType: cmp.Or(app.ContentType, mime.TypeByExtension(filepath.Ext(file)), "text/html; charset=utf-8"),
+	}
+	if strings.HasPrefix(t.contentType, "text/html") {
+		t.page, err = htmltemplate.New("page").Parse(string(source))
+	} else {
+		t.page, err = template.New("page").Parse(string(source))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// loadHTTPTemplate reads an app's template, returning it and the file it came
+// from.
+func loadHTTPTemplate(app *config.HTTPApp) ([]byte, string, error) {
+	if app.TemplateFile != "" {
+		b, err := os.ReadFile(app.TemplateFile)
+		return b, app.TemplateFile, err
+	}
+
+	file := embedded.HTTPTemplate(app.Template)
+	b, err := embedded.Files.ReadFile(file)
+	return b, file, err
+}
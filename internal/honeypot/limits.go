@@ -0,0 +1,291 @@
+package honeypot
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultMaxPerIP = 3
+	defaultIPRate   = 30
+	rateWindow      = time.Minute
+)
+
+// Reasons a connection or login was refused, as used in the metrics and auth
+// events.
+const (
+	refusedBanned      = "banned"
+	refusedPerIP       = "per_ip_limit"
+	refusedRate        = "rate_limit"
+	refusedMaxUsers    = "max_users"
+	refusedPolicy      = "auth_policy"  // The persona's auth policy turned the login down
+	refusedHTTPLogin   = "http_login"   // HTTP apps' login pages never let anyone in
+	refusedProxyHeader = "proxy_header" // A PROXY header was missing, malformed or untrusted
+)
+
+// ErrLoopbackBan is returned when banning a session that came in from
+// localhost, which would ban every connection through the reverse tunnel.
+var ErrLoopbackBan = errors.New("session is from a loopback address; send PROXY headers through the tunnel to ban the real address")
+
+var (
+	limitsMu      sync.Mutex
+	ipConnections = map[string]int{}         // Open connections by address
+	ipRecent      = map[string][]time.Time{} // Connection times by address, within rateWindow
+	lastSweep     time.Time
+)
+
+// limitOption reads a per-IP limit from the options table. Unset uses the
+// default and 0 turns the limit off.
+func limitOption(key string, def int) int {
+	val := entity.OptionCached(key)
+	if val == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Error("Invalid limit option", "name", key, "val", val)
+		return def
+	}
+
+	return n
+}
+
+// remoteIP returns the address without the port.
+func remoteIP(addr net.Addr) net.IP {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+
+	return net.ParseIP(host)
+}
+
+// limitedConn releases its address's connection slot when closed.
+type limitedConn struct {
+	net.Conn
+	ip   string
+	once sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(func() {
+		limitsMu.Lock()
+		ipConnections[c.ip]--
+		if ipConnections[c.ip] <= 0 {
+			delete(ipConnections, c.ip)
+		}
+		limitsMu.Unlock()
+	})
+
+	return c.Conn.Close()
+}
+
+// connCallback refuses connections with bad PROXY headers, from banned
+// addresses and from addresses over their connection limits before the SSH
+// handshake starts, then picks the persona for the rest.
+func connCallback(ctx ssh.Context, conn net.Conn) net.Conn {
+	pc, ok := conn.(*portConn)
+	if !ok {
+		pc = &portConn{Conn: conn}
+	}
+
+	admitted := admitPortConn(pc, true)
+	if admitted == nil {
+		return nil
+	}
+	ctx.SetValue(contextKeyPersona, personaFor(pc.port))
+
+	return sniffKexInit(ctx, admitted)
+}
+
+// admitConn refuses connections from banned addresses and addresses over
+// their connection limits, returning nil, and otherwise returns the
+// connection. When capped, it also counts against pot_max_per_ip and holds a
+// slot for its address until it's closed. HTTP isn't capped, since browsers
+// open several connections at once.
+func admitConn(conn net.Conn, capped bool) net.Conn {
+	ip := remoteIP(conn.RemoteAddr())
+
+	if ban := addrBan(ip); ban != nil {
+		refuseConn(ip, refusedBanned, "ban", ban.Value)
+		return nil
+	}
+
+	// Everything through the reverse tunnel arrives from localhost, so the
+	// per-address limits would lump all of those attackers together.
+	if ip == nil || ip.IsLoopback() {
+		return conn
+	}
+
+	maxPerIP := limitOption(entity.KeyPotMaxPerIP, defaultMaxPerIP)
+	rate := limitOption(entity.KeyPotIPRate, defaultIPRate)
+	key := ip.String()
+	now := time.Now()
+
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+
+	if now.Sub(lastSweep) > rateWindow {
+		for k, times := range ipRecent {
+			if len(times) == 0 || now.Sub(times[len(times)-1]) > rateWindow {
+				delete(ipRecent, k)
+			}
+		}
+		lastSweep = now
+	}
+
+	recent := ipRecent[key]
+	for len(recent) > 0 && now.Sub(recent[0]) > rateWindow {
+		recent = recent[1:]
+	}
+
+	if rate > 0 && len(recent) >= rate {
+		ipRecent[key] = recent
+		refuseConn(ip, refusedRate, "per_minute", rate)
+		return nil
+	}
+	ipRecent[key] = append(recent, now)
+
+	if !capped {
+		return conn
+	}
+	if maxPerIP > 0 && ipConnections[key] >= maxPerIP {
+		refuseConn(ip, refusedPerIP, "max", maxPerIP)
+		return nil
+	}
+	ipConnections[key]++
+
+	return &limitedConn{Conn: conn, ip: key}
+}
+
+func refuseConn(ip net.IP, reason string, keyvals ...any) {
+	metricConnectionsRefused.Inc(reason)
+	log.Debug("Connection refused", append([]any{"ip", ip, "reason", reason}, keyvals...)...)
+}
+
+// addrBan returns the ban covering the address, if any.
+func addrBan(ip net.IP) *entity.Ban {
+	bans, err := entity.BansCached()
+	if err != nil {
+		log.Error("Error loading bans", "error", err)
+		return nil
+	}
+
+	for _, b := range bans {
+		if b.MatchesAddr(ip) {
+			return &b
+		}
+	}
+
+	return nil
+}
+
+// loginBan returns the ban covering the username or client version, if any.
+func loginBan(user string, clientVersion string) *entity.Ban {
+	bans, err := entity.BansCached()
+	if err != nil {
+		log.Error("Error loading bans", "error", err)
+		return nil
+	}
+
+	for _, b := range bans {
+		if b.MatchesLogin(user, clientVersion) {
+			return &b
+		}
+	}
+
+	return nil
+}
+
+// connKicker closes the session's whole SSH connection, which ends the shell.
+func connKicker(ctx ssh.Context) func() error {
+	return func() error {
+		conn, ok := ctx.Value(ssh.ContextKeyConn).(gossh.Conn)
+		if !ok {
+			return fmt.Errorf("no connection for session")
+		}
+
+		return conn.Close()
+	}
+}
+
+// Kick disconnects an active session.
+func Kick(id string) error {
+	activeUsersMu.Lock()
+	kick, ok := sessionKickers[id]
+	activeUsersMu.Unlock()
+
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	logOperatorEvent(id, "Operator kicked the session")
+	return kick()
+}
+
+// Ban saves the ban and disconnects any active sessions it covers.
+func Ban(b *entity.Ban) error {
+	if err := b.Save(); err != nil {
+		return err
+	}
+
+	log.Info("Ban added", "kind", b.Kind, "value", b.Value, "expires", b.ExpiresAt)
+
+	for _, s := range activeSessionsSnapshot() {
+		host, _, _ := net.SplitHostPort(s.Host)
+		if b.MatchesAddr(net.ParseIP(host)) || b.MatchesLogin(s.User, s.ClientVersion) {
+			if err := Kick(s.ID); err != nil {
+				log.Error("Error kicking banned session", "session", s.ID, "error", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// BanSession bans the address an active session is connecting from, which
+// also disconnects it. With PROXY headers that's the address the proxy passed
+// on; sessions from loopback can't be banned.
+func BanSession(id string, d time.Duration, reason string) (*entity.Ban, error) {
+	session := activeSession(id)
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	host, _, err := net.SplitHostPort(session.Host)
+	if err != nil {
+		host = session.Host
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil, ErrLoopbackBan
+	}
+
+	b := entity.NewBan(entity.BanKindIP, host, reason, d)
+	logOperatorEvent(id, "Operator banned "+host)
+
+	return b, Ban(b)
+}
+
+// Unban lifts a ban. It reports false if there was no such ban.
+func Unban(id int) (bool, error) {
+	found, err := entity.BanDelete(id)
+	if found {
+		log.Info("Ban removed", "id", id)
+	}
+
+	return found, err
+}
@@ -0,0 +1,252 @@
+package honeypot
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/proxyproto"
+)
+
+var (
+	listenersMu  sync.Mutex
+	potServer    *ssh.Server                 // Set once the pot is running
+	potPorts     []string                    // Ports the pot answers on; the first is the primary
+	potListeners = map[string]net.Listener{} // Open listeners by port
+
+	proxyMu      sync.Mutex
+	proxyPorts   []string     // Ports whose connections start with a PROXY header
+	proxyTrusted []*net.IPNet // Peers allowed to send PROXY headers
+)
+
+// Peers allowed to send PROXY headers when proxy_protocol_trusted is empty, so
+// a port opened to the internet doesn't let anyone claim any address.
+var proxyTrustedDefault = []*net.IPNet{
+	{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv6loopback, Mask: net.CIDRMask(128, 128)},
+}
+
+// Clients get this long to send their PROXY header.
+const proxyHeaderTimeout = 10 * time.Second
+
+// SetProxyProtocol sets the ports whose connections start with a PROXY
+// header, and the addresses allowed to send one, loopback only when none are
+// given. It applies to connections made afterwards.
+func SetProxyProtocol(ports []string, trusted []string) {
+	var nets []*net.IPNet
+	for _, t := range trusted {
+		n, err := config.ParseTrusted(t)
+		if err != nil {
+			log.Warn("Ignoring invalid proxy_protocol_trusted entry", "entry", t, "error", err)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	if len(nets) == 0 {
+		nets = proxyTrustedDefault
+	}
+
+	proxyMu.Lock()
+	proxyPorts = slices.Clone(ports)
+	proxyTrusted = nets
+	proxyMu.Unlock()
+}
+
+// portListener tags each connection with the port it came in on, which picks
+// its persona, and reads a PROXY header from it when the port is set up for
+// them.
+type portListener struct {
+	net.Listener
+	port string
+}
+
+// portConn is a connection along with the pot port it came in on. With a
+// PROXY header the local address is the proxy's, so it can't say.
+type portConn struct {
+	net.Conn
+	port string
+}
+
+func (l portListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return conn, err
+	}
+
+	proxyMu.Lock()
+	enabled, trusted := slices.Contains(proxyPorts, l.port), proxyTrusted
+	proxyMu.Unlock()
+
+	if !enabled {
+		return &portConn{Conn: conn, port: l.port}, nil
+	}
+
+	allowed := func(addr net.Addr) bool {
+		ip := remoteIP(addr)
+		return ip != nil && slices.ContainsFunc(trusted, func(n *net.IPNet) bool { return n.Contains(ip) })
+	}
+
+	return &portConn{Conn: proxyproto.NewConn(conn, allowed, proxyHeaderTimeout), port: l.port}, nil
+}
+
+// SetPorts sets the ports the honey pot answers on. Once the pot is running it
+// starts listening on new ports and stops listening on ports that are no
+// longer listed, without dropping connections already made on them.
+func SetPorts(ports []string) error {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	potPorts = slices.Clone(ports)
+	if potServer == nil {
+		return nil
+	}
+
+	return syncListeners()
+}
+
+// syncListeners opens and closes listeners to match potPorts. listenersMu
+// must be held.
+func syncListeners() error {
+	for port, l := range potListeners {
+		if !slices.Contains(potPorts, port) {
+			delete(potListeners, port)
+			l.Close()
+			log.Info("Stopped listening", "port", port)
+		}
+	}
+
+	var errs []error
+	for _, port := range potPorts {
+		if _, ok := potListeners[port]; ok {
+			continue
+		}
+
+		l, err := net.Listen("tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("port %s: %w", port, err))
+			continue
+		}
+
+		potListeners[port] = l
+		log.Info("Listening for SSH connections", "host", host, "port", port)
+		go serveListener(potServer, port, l)
+	}
+
+	return errors.Join(errs...)
+}
+
+func serveListener(s *ssh.Server, port string, l net.Listener) {
+	err := s.Serve(portListener{Listener: l, port: port})
+
+	listenersMu.Lock()
+	removed := potListeners[port] != l
+	if !removed {
+		delete(potListeners, port)
+	}
+	listenersMu.Unlock()
+
+	if !removed && !errors.Is(err, ssh.ErrServerClosed) {
+		log.Error("Stopped listening after an error", "port", port, "error", err)
+	}
+}
+
+// primaryListening reports whether the pot is answering on its primary port.
+func primaryListening() bool {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	return len(potPorts) > 0 && potListeners[potPorts[0]] != nil
+}
+
+// potLocalAddr is the local address of the primary port, which is what the
+// reverse tunnel forwards to.
+func potLocalAddr() string {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	if len(potPorts) == 0 {
+		return ""
+	}
+
+	return net.JoinHostPort("localhost", potPorts[0])
+}
+
+// syncPortListeners opens and closes the listeners for one of the pot's
+// other protocols to match ports, handing each new one to serve. listenersMu
+// must be held.
+func syncPortListeners(protocol string, ports []string, listeners map[string]net.Listener, serve func(port string, l net.Listener)) error {
+	for port, l := range listeners {
+		if !slices.Contains(ports, port) {
+			delete(listeners, port)
+			l.Close()
+			log.Info("Stopped listening for "+protocol, "port", port)
+		}
+	}
+
+	var errs []error
+	for _, port := range ports {
+		if _, ok := listeners[port]; ok {
+			continue
+		}
+
+		l, err := net.Listen("tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s port %s: %w", protocol, port, err))
+			continue
+		}
+
+		listeners[port] = l
+		log.Info("Listening for "+protocol+" connections", "host", host, "port", port)
+		go serve(port, l)
+	}
+
+	return errors.Join(errs...)
+}
+
+// closePortListeners closes listeners when the pot stops.
+func closePortListeners(listeners map[string]net.Listener) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	for port, l := range listeners {
+		delete(listeners, port)
+		l.Close()
+	}
+}
+
+// acceptPortConns hands each connection made to l to handle, until l is
+// closed.
+func acceptPortConns(port string, l net.Listener, handle func(pc *portConn)) {
+	pl := portListener{Listener: l, port: port}
+	for {
+		conn, err := pl.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Warn("Error accepting a connection", "port", port, "error", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		go handle(conn.(*portConn))
+	}
+}
+
+// admitPortConn reads the connection's PROXY header if it has one, then
+// checks it against the bans and limits like admitConn.
+func admitPortConn(pc *portConn, capped bool) net.Conn {
+	if c, ok := pc.Conn.(*proxyproto.Conn); ok && c.Err() != nil {
+		metricConnectionsRefused.Inc(refusedProxyHeader)
+		log.Warn("Refused connection with a bad PROXY header", "from", c.ProxyAddr(), "error", c.Err())
+		return nil
+	}
+
+	return admitConn(pc.Conn, capped)
+}
@@ -0,0 +1,56 @@
+package honeypot
+
+import (
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/metrics"
+)
+
+var (
+	metricLogins             = metrics.NewCounter("honeybear_logins_total", "Shell sessions started.")
+	metricAuthFailures       = metrics.NewCounter("honeybear_auth_failures_total", "Authentication attempts that were refused.")
+	metricConnectionsRefused = metrics.NewCounterVec("honeybear_connections_refused_total", "Connections and logins refused by bans, limits and auth policies, by reason.", "reason")
+	metricHTTPRequests       = metrics.NewCounter("honeybear_http_requests_total", "Requests to the HTTP honey pot.")
+	metricCommands           = metrics.NewCounter("honeybear_commands_total", "Commands typed by attackers.")
+	metricCommandsByName     = metrics.NewCounterVec("honeybear_commands_by_name_total", "Commands typed by attackers, by command name.", "command")
+	metricTunnelReconnects   = metrics.NewCounter("honeybear_tunnel_reconnects_total", "Reverse tunnel reconnection attempts.")
+	metricSessionDuration    = metrics.NewHistogram(
+		"honeybear_session_duration_seconds",
+		"How long shell sessions lasted.",
+		[]float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	)
+)
+
+// RegisterMetrics adds the pot's state gauges to the metrics endpoint.
+func RegisterMetrics() {
+	metrics.NewGaugeFunc("honeybear_active_users", "Users connected right now.", func() float64 {
+		return float64(StatActiveUsers())
+	})
+	metrics.NewGaugeFunc("honeybear_users_this_session", "Users since the pot started.", func() float64 {
+		return float64(StatUsersThisSession())
+	})
+	metrics.NewGaugeFunc("honeybear_users_all_time", "Logins recorded in the database.", func() float64 {
+		return float64(StatUsersAllTime())
+	})
+	metrics.NewGaugeFunc("honeybear_max_users", "Maximum concurrent users allowed.", func() float64 {
+		return float64(StatMaxUsers())
+	})
+	metrics.NewGaugeFunc("honeybear_tunnel_active", "Reverse tunnel state: -1 not configured, 0 any down, 1 all up.", func() float64 {
+		return float64(StatTunnelActive())
+	})
+	metrics.NewGaugeVecFunc("honeybear_tunnel_up", "Whether each reverse tunnel is connected, by tunnel name.", "tunnel", func() map[string]float64 {
+		up := map[string]float64{}
+		for _, t := range StatTunnels() {
+			up[t.Name] = 0
+			if t.Up {
+				up[t.Name] = 1
+			}
+		}
+		return up
+	})
+	metrics.NewGaugeFunc("honeybear_event_writer_queue_depth", "Events waiting to be written to the database.", func() float64 {
+		return float64(entity.EventWriterQueueDepth())
+	})
+	metrics.NewCounterFunc("honeybear_events_dropped_total", "Events missed by subscribers whose buffers were full.", func() float64 {
+		return float64(entity.EventsDropped())
+	})
+}
@@ -2,6 +2,7 @@ package honeypot
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
@@ -10,7 +11,7 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
 	"github.com/google/shlex"
-	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/confetti"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/ctf"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/filesystem"
@@ -21,8 +22,14 @@ import (
 // Just a generic tea.Model to demo terminal information of ssh.
 type model struct {
 	// Session
+	sessionID      string
+	app            string // ssh or telnet
 	user           string
 	host           string
+	clientVersion  string
+	kexInit        *clientKexInit // What the client offered in its handshake, if known
+	remotePort     int
+	localPort      int
 	group          string
 	term           string
 	profile        string
@@ -30,6 +37,7 @@ type model struct {
 	height         int
 	runningCommand string
 	currentDir     *filesystem.Node
+	persona        *persona
 	// Styles
 	txtStyle     lipgloss.Style
 	quitStyle    lipgloss.Style
@@ -52,7 +60,9 @@ type model struct {
 }
 
 func (m model) Init() tea.Cmd {
-	NewEvent(&m, true, "login", "Logged in!")
+	NewEvent(&m, true, entity.EventTypeLogin, "Logged in!", entity.LoginMetadata(
+		m.sessionID, m.remotePort, m.localPort, m.clientVersion, m.term, m.width, m.height,
+	), m.kexInit.metadata())
 	return doTick()
 }
 
@@ -152,59 +162,19 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case ctf.QuitMsg:
 		m.viewport.SetContent("")
 		m.runningCommand = ""
-		m.ctf = ctf.InitialModel(convertTasks(config.Active.Tasks))
+		m.ctf = ctf.InitialModel(m.persona.tasks)
+		return m, nil
+	case operatorCommandMsg:
+		if m.runningCommand == "" {
+			m.textInput.SetValue(string(msg))
+			return m.runCommand(false)
+		}
 		return m, nil
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "enter":
 			if m.runningCommand == "" {
-				command := m.textInput.Value()
-				log.Debug(fmt.Sprintf("Command entered by %s:%s: %s", m.user, m.host, command))
-				m.historyIdx = 0
-				m.SetEventTime("enter")
-				m.output += m.historyStyle.Render(fmt.Sprintf("\n❯ %s\n", m.textInput.Value()))
-
-				parts, err := shlex.Split(command)
-				if err != nil {
-					m.output += m.outputStyle.Render(fmt.Sprintf("\nError parsing command: %s\n", err))
-					return m, tea.Batch(cmds...)
-				}
-
-				if len(parts) > 0 {
-					// Add to history
-					historyPush(&m, command)
-					// Save an event log
-					err := NewEvent(&m, true, "typed", command)
-					if err != nil {
-						log.Printf("Error saving event: %s", err)
-					}
-
-					switch parts[0] {
-					case "exit":
-						return m, tea.Quit
-					case "whoami":
-						m.output += m.outputStyle.Render(fmt.Sprintf("\n%s\n", m.user))
-					case "sudo":
-						if len(parts) > 1 {
-							newCmd, err := filesystem.RunNode(m.currentDir, parts[1], parts[2:], "root", "root")
-							if err != nil {
-								m.output += m.outputStyle.Render(fmt.Sprintf("\n%s\n", err))
-							} else if newCmd != nil {
-								cmds = append(cmds, *newCmd)
-							}
-						}
-					default:
-						newCmd, err := filesystem.RunNode(m.currentDir, parts[0], parts[1:], m.user, m.group)
-						if err != nil {
-							m.output += m.outputStyle.Render(fmt.Sprintf("\n%s\n", err))
-						} else if newCmd != nil {
-							cmds = append(cmds, *newCmd)
-						}
-					}
-				}
-
-				m.textInput.Reset()
-				return m, tea.Batch(cmds...)
+				return m.runCommand(true)
 			}
 		case "up":
 			if m.runningCommand == "" {
@@ -266,6 +236,76 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// runCommand runs the command in the text input. Commands an operator typed
+// into the session are recorded as injected system events, and aren't counted
+// as the attacker's or added to their history.
+func (m model) runCommand(userEvent bool) (tea.Model, tea.Cmd) {
+	cmds := []tea.Cmd{}
+
+	command := m.textInput.Value()
+	log.Debug(fmt.Sprintf("Command entered by %s:%s: %s", m.user, m.host, command))
+	m.historyIdx = 0
+	m.SetEventTime("enter")
+	m.output += m.historyStyle.Render(fmt.Sprintf("\n❯ %s\n", m.textInput.Value()))
+
+	parts, err := shlex.Split(command)
+	if err != nil {
+		m.output += m.outputStyle.Render(fmt.Sprintf("\nError parsing command: %s\n", err))
+		return m, tea.Batch(cmds...)
+	}
+
+	if len(parts) > 0 {
+		eventType := entity.EventTypeInjected
+		if userEvent {
+			// Add to history
+			historyPush(&m, command)
+			eventType = entity.EventTypeTyped
+			metricCommands.Inc()
+			metricCommandsByName.Inc(parts[0])
+			countCommand(m.sessionID)
+		}
+		// Save an event log
+		err := NewEvent(&m, userEvent, eventType, command, entity.CommandMetadata(m.sessionID, m.currentDir.Path, parts))
+		if err != nil {
+			log.Printf("Error saving event: %s", err)
+		}
+
+		switch parts[0] {
+		case "exit":
+			exitCode := 0
+			if len(parts) > 1 {
+				exitCode, _ = strconv.Atoi(parts[1])
+			}
+
+			NewEvent(&m, userEvent, entity.EventTypeLogout, "Logged out.", entity.LogoutMetadata(
+				m.sessionID, time.Since(*m.EventTime("session_start")), exitCode,
+			))
+			return m, tea.Quit
+		case "whoami":
+			m.output += m.outputStyle.Render(fmt.Sprintf("\n%s\n", m.user))
+		case "sudo":
+			if len(parts) > 1 {
+				newCmd, err := filesystem.RunNode(m.currentDir, parts[1], parts[2:], "root", "root")
+				if err != nil {
+					m.output += m.outputStyle.Render(fmt.Sprintf("\n%s\n", err))
+				} else if newCmd != nil {
+					cmds = append(cmds, *newCmd)
+				}
+			}
+		default:
+			newCmd, err := filesystem.RunNode(m.currentDir, parts[0], parts[1:], m.user, m.group)
+			if err != nil {
+				m.output += m.outputStyle.Render(fmt.Sprintf("\n%s\n", err))
+			} else if newCmd != nil {
+				cmds = append(cmds, *newCmd)
+			}
+		}
+	}
+
+	m.textInput.Reset()
+	return m, tea.Batch(cmds...)
+}
+
 func (m model) View() string {
 	if !m.viewportReady {
 		return "\nInitializing...\n"
@@ -0,0 +1,212 @@
+package honeypot
+
+import (
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/ctf"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/embedded"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/filesystem"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Name of the persona on ports that aren't given one.
+const defaultPersona = "default"
+
+// Keys for what the pot keeps in a connection's ssh.Context.
+var (
+	contextKeyPersona  = &struct{ name string }{"persona"}
+	contextKeyAttempts = &struct{ name string }{"auth-attempts"}
+)
+
+// persona is how the pot presents itself on a connection, resolved from the
+// current config when the connection is made.
+type persona struct {
+	name       string
+	port       string             // Listener port the connection came in on
+	version    string             // SSH version after "SSH-2.0-", or empty for the default
+	hostKeys   []gossh.Signer     // Host keys to offer, restricted to the persona's algorithms
+	algorithms gossh.Config       // Key exchanges, ciphers and MACs to offer; nil for the defaults
+	banner     *template.Template // Nil shows no banner
+	profile    filesystem.Profile
+	auth       config.AuthPolicy
+	tasks      []ctf.Task
+	httpServer string           // Server header on HTTP ports
+	httpApps   []config.HTTPApp // Fake web apps on HTTP ports
+}
+
+// defaultBanner is the built-in banner, as a template.
+var defaultBanner = sync.OnceValue(func() *template.Template {
+	banner, err := embedded.Files.ReadFile("banner.txt")
+	if err != nil {
+		log.Error("Error reading the banner", "error", err)
+		return nil
+	}
+
+	return template.Must(template.New("banner").Parse(string(banner)))
+})
+
+// personaFor returns the persona for connections on port.
+func personaFor(port string) *persona {
+	cfg := config.Current()
+	p := &persona{
+		name:    defaultPersona,
+		port:    port,
+		banner:  defaultBanner(),
+		profile: filesystem.DefaultProfile,
+		tasks:   convertTasks(cfg.Tasks),
+
+		httpServer: cfg.HTTPServer,
+		httpApps:   cfg.HTTPApps,
+	}
+
+	cp := cfg.PersonaFor(port)
+	if cp != nil {
+		p.name = cp.Name
+		p.version = cp.ServerVersion
+		p.algorithms = gossh.Config{KeyExchanges: cp.KexAlgorithms, Ciphers: cp.Ciphers, MACs: cp.MACs}
+	}
+
+	keys := cachedHostKeys(personaKeyDir(p.name))
+	if keys == nil {
+		log.Error("The persona's host keys aren't loaded, using the default ones", "persona", p.name)
+		keys = cachedHostKeys(personaKeyDir(defaultPersona))
+	}
+	p.hostKeys = keys
+	if cp == nil {
+		return p
+	}
+	if offered := offeredHostKeys(keys, cp.HostKeyAlgorithms); len(offered) > 0 {
+		p.hostKeys = offered
+	}
+
+	if cp.NoBanner {
+		p.banner = nil
+	} else if cp.Banner != "" {
+		t, err := template.New("banner").Parse(cp.Banner)
+		if err != nil {
+			log.Error("Invalid persona banner", "persona", cp.Name, "error", err)
+		}
+		p.banner = t
+	}
+
+	p.profile = filesystem.Profile{
+		Hostname:  cp.Hostname,
+		OSRelease: cp.OSRelease,
+		Commands:  cp.Commands,
+		Nodes:     cp.Filesystem,
+	}
+	if m := cp.Machine; m != nil {
+		p.profile.KernelName = m.KernelName
+		p.profile.KernelRelease = m.KernelRelease
+		p.profile.KernelVersion = m.KernelVersion
+		p.profile.Machine = m.Arch
+		p.profile.OS = m.OS
+	}
+	if p.profile.Hostname == "" {
+		p.profile.Hostname = filesystem.DefaultProfile.Hostname
+	}
+
+	if cp.Auth != nil {
+		p.auth = *cp.Auth
+	}
+	if cp.Tasks != nil {
+		p.tasks = convertTasks(cp.Tasks)
+	}
+	if cp.HTTPServer != "" {
+		p.httpServer = cp.HTTPServer
+	}
+	if cp.HTTPApps != nil {
+		p.httpApps = cp.HTTPApps
+	}
+
+	return p
+}
+
+// contextPersona returns the persona chosen for a connection when it was made.
+func contextPersona(ctx ssh.Context) *persona {
+	if p, ok := ctx.Value(contextKeyPersona).(*persona); ok {
+		return p
+	}
+
+	return personaFor("")
+}
+
+// serverConfig sets the SSH version, algorithms and host keys each
+// connection is offered from its persona.
+func serverConfig(ctx ssh.Context) *gossh.ServerConfig {
+	p := contextPersona(ctx)
+
+	cfg := &gossh.ServerConfig{Config: p.algorithms}
+	if p.version != "" {
+		cfg.ServerVersion = "SSH-2.0-" + p.version
+	}
+	for _, k := range p.hostKeys {
+		cfg.AddHostKey(k)
+	}
+
+	return cfg
+}
+
+// bannerHandler shows the persona's banner before login.
+func bannerHandler(ctx ssh.Context) string {
+	return contextPersona(ctx).renderBanner(ctx.User(), ctx.RemoteAddr().String())
+}
+
+// renderBanner returns the persona's banner for a login, or an empty string
+// if it has none.
+func (p *persona) renderBanner(user string, remoteAddr string) string {
+	if p.banner == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	err := p.banner.Execute(&b, config.BannerData{
+		User:       user,
+		Hostname:   p.profile.Hostname,
+		Port:       p.port,
+		RemoteAddr: remoteAddr,
+	})
+	if err != nil {
+		log.Error("Error rendering the banner", "persona", p.name, "error", err)
+		return ""
+	}
+
+	return b.String()
+}
+
+// authAttempt counts a password attempt on the connection and returns its
+// number, starting at 1.
+func authAttempt(ctx ssh.Context) int {
+	n, _ := ctx.Value(contextKeyAttempts).(int)
+	n++
+	ctx.SetValue(contextKeyAttempts, n)
+
+	return n
+}
+
+// accepts reports whether the persona's auth policy lets the login in.
+func (p *persona) accepts(user string, password string, attempt int) bool {
+	if attempt <= p.auth.FailFirst {
+		return false
+	}
+
+	switch p.auth.Accept {
+	case config.AuthAcceptNone:
+		return false
+	case config.AuthAcceptListed:
+		for _, cred := range p.auth.Credentials {
+			u, pw, _ := strings.Cut(cred, ":")
+			if (u == "*" || u == user) && (pw == "*" || pw == password) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -26,9 +27,9 @@ import (
 	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/confetti"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/ctf"
-	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/embedded"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/filesystem"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/matrix"
+	"github.com/muesli/termenv"
 )
 
 const (
@@ -36,23 +37,24 @@ const (
 	defaultMaxUsers = 10
 )
 
+// Apps the pot records events and sessions under.
+const (
+	appSSH    = "ssh"
+	appTelnet = "telnet"
+	appHTTP   = "http"
+)
+
 var (
 	// State
 	activeUsers      []string
+	activeSessions       = map[string]*entity.Session{}
+	sessionKickers       = map[string]func() error{} // Closes a session's connection
 	usersThisSession int = 0
 	activeUsersMu    sync.Mutex
-	tunnelActive     int = -1 // -1 = not configured, 0 = not connected, 1 = connected
 
 	// Config
-	potPort                 string          // Primary port the honey pot will answer on.
-	potAdditionalListeners  []*net.Listener // Optional additional ports for the honey pot.
-	tunnelUser              string          // Username for remote SSH server
-	tunnelAddr              string          // Hostname or IP of remote SSH server
-	tunnelKey               string          // Path to private SSH key for remote server
-	tunnelPort              = "22"          // Port of remote SSH server
-	tunnelRemoteBind        = "127.0.0.1"   // IP address to bind to on the *remote* server (0.0.0.0 for all)
-	tunnelRemoteForwardPort = "8022"        // Port to open on the *remote* server for forwarding
-	knownHostsPath          = ""            // Path to known hosts file.
+	tunnelAdminForwardPort = "" // Port to open on the *remote* server for the operator console
+	adminServiceAddr       = "" // Local address of the operator console
 )
 
 func addActiveUser(user string) {
@@ -72,6 +74,45 @@ func removeActiveUser(user string) {
 	activeUsersMu.Unlock()
 }
 
+func addActiveSession(session *entity.Session, kick func() error) {
+	activeUsersMu.Lock()
+	activeSessions[session.ID] = session
+	sessionKickers[session.ID] = kick
+	activeUsersMu.Unlock()
+}
+
+func removeActiveSession(id string) {
+	activeUsersMu.Lock()
+	delete(activeSessions, id)
+	delete(sessionKickers, id)
+	activeUsersMu.Unlock()
+}
+
+// countCommand adds a typed command to an active session's count.
+func countCommand(id string) {
+	activeUsersMu.Lock()
+	defer activeUsersMu.Unlock()
+	if s, ok := activeSessions[id]; ok {
+		s.Commands++
+	}
+}
+
+func activeSession(id string) *entity.Session {
+	activeUsersMu.Lock()
+	defer activeUsersMu.Unlock()
+	return activeSessions[id]
+}
+
+func activeSessionsSnapshot() []entity.Session {
+	activeUsersMu.Lock()
+	defer activeUsersMu.Unlock()
+	snapshot := make([]entity.Session, 0, len(activeSessions))
+	for _, s := range activeSessions {
+		snapshot = append(snapshot, *s)
+	}
+	return snapshot
+}
+
 func activeUsersLen() int {
 	activeUsersMu.Lock()
 	defer activeUsersMu.Unlock()
@@ -98,42 +139,66 @@ func usersThisSessionCount() int {
 	return usersThisSession
 }
 
-func SetPort(port string) error {
-	potPort = port
-	return nil
-}
-
-func AddListeners(additionalListeners ...*net.Listener) error {
-	potAdditionalListeners = additionalListeners
-	return nil
-}
-
-func SetTunnel(host *string, keyPath *string) error {
-	if host == nil || *host == "" || keyPath == nil || *keyPath == "" {
-		// Flags not set, tunnel not needed.
-		return nil
-	}
-
-	tunnelActive = 0 // Not connected yet.
+// SetTunnels configures the reverse tunnels from cfg. services holds the
+// local addresses of the web and admin targets, when they're running.
+func SetTunnels(cfg *config.Config, services map[string]string) error {
+	var settings []*tunnelSettings
+	var errs []error
+	for i, t := range cfg.AllTunnels() {
+		user, hostPort, ok := strings.Cut(t.Server, "@")
+		if !ok {
+			errs = append(errs, fmt.Errorf("tunnel %s: invalid remote host", t.Name))
+			continue
+		}
 
-	parts := strings.Split(*host, "@")
-	if len(parts) < 2 {
-		return errors.New("Invalid remote host.")
-	}
+		ts := &tunnelSettings{
+			Name:              t.Name,
+			User:              user,
+			Host:              hostPort,
+			Port:              "22",
+			Key:               t.Key,
+			RemoteBind:        t.RemoteBind,
+			RemotePort:        t.RemotePort,
+			Target:            t.Target,
+			KnownHosts:        t.KnownHosts,
+			StrictHostKey:     t.StrictHostKey,
+			HostKeys:          t.HostKeys,
+			KeepaliveInterval: time.Duration(t.KeepaliveSeconds) * time.Second,
+			KeepaliveMax:      t.KeepaliveMax,
+			ProxyProtocol:     t.ProxyProtocol,
+			forwardAdmin:      i == 0 && cfg.Tunnel != "", // tunnel_admin_port rides along on the tunnel set with -tunnel
+		}
+		if h, p, err := net.SplitHostPort(hostPort); err == nil {
+			ts.Host, ts.Port = h, p
+		}
 
-	tunnelUser = parts[0]
+		switch target, port, _ := strings.Cut(t.Target, ":"); {
+		case t.Target == config.TunnelTargetSSH:
+			// The primary address of the honey pot can change on reload.
+			ts.target = potLocalAddr
+		case target == config.TunnelTargetSSH:
+			addr := net.JoinHostPort("localhost", port)
+			ts.target = func() string { return addr }
+		case services[t.Target] != "":
+			addr := services[t.Target]
+			ts.target = func() string { return addr }
+		default:
+			errs = append(errs, fmt.Errorf("tunnel %s: target %s isn't running", t.Name, t.Target))
+			continue
+		}
 
-	hp := strings.Split(parts[1], ":")
-	if len(hp) == 1 {
-		tunnelAddr = parts[1]
-	} else {
-		tunnelAddr = hp[0]
-		tunnelPort = hp[1]
+		settings = append(settings, ts)
 	}
 
-	tunnelKey = *keyPath
+	setTunnels(settings)
+	return errors.Join(errs...)
+}
 
-	return nil
+// SetTunnelAdmin has the reverse tunnel also forward remotePort to the
+// operator console listening at localAddr.
+func SetTunnelAdmin(remotePort string, localAddr string) {
+	tunnelAdminForwardPort = remotePort
+	adminServiceAddr = localAddr
 }
 
 func StartHoneyPot(appConfigDir string) {
@@ -141,40 +206,66 @@ func StartHoneyPot(appConfigDir string) {
 	activeUsers = []string{}
 	usersThisSession = 0
 	activeUsersMu.Unlock()
-	maxUsers := entity.OptionGetInt(entity.KeyPotMaxUsers)
-	if maxUsers == 0 {
-		maxUsers = defaultMaxUsers
-	}
+
+	// Make any missing host keys now rather than on someone's first connection.
+	hostKeyDir = filepath.Join(appConfigDir, ".ssh")
+	LoadHostKeys(config.Current().Personas)
+	LoadHTTPTemplates(config.Current())
 
 	s, err := wish.NewServer(
-		wish.WithAddress(net.JoinHostPort(host, potPort)),
-		wish.WithHostKeyPath(appConfigDir+"/.ssh/id_ed25519"),
+		ssh.WrapConn(connCallback),
+		func(s *ssh.Server) error {
+			s.HostSigners = []ssh.Signer{noHostKey{}}
+			s.ServerConfigCallback = serverConfig
+			s.ChannelHandlers = map[string]ssh.ChannelHandler{
+				"session":          sessionHandler,
+				requestDirectTCPIP: directTCPIPHandler,
+			}
+			s.RequestHandlers = map[string]ssh.RequestHandler{
+				requestTCPIPForward:  tcpipForwardHandler,
+				requestCancelForward: tcpipForwardHandler,
+			}
+			return nil
+		},
 		wish.WithPasswordAuth(func(ctx ssh.Context, password string) bool {
-			if activeUsersLen()+1 > maxUsers {
-				return false
+			refused := loginRefused(contextPersona(ctx), ctx.User(), ctx.ClientVersion(), password, authAttempt(ctx))
+			accepted := refused == ""
+
+			action := "Password accepted"
+			metadata := entity.CredentialMetadata(ctx.SessionID(), password, accepted, ctx.ClientVersion()).Merge(contextKexInit(ctx).metadata())
+			if !accepted {
+				action = "Password rejected"
+				metadata["refused"] = refused
 			}
-
-			log.Info(fmt.Sprintf("Authorization used: %s, %s", ctx.User(), password))
-			incrementUsersThisSession()
-			return true
-		}),
-		wish.WithBannerHandler(func(ctx ssh.Context) string {
-			banner, err := embedded.Files.ReadFile("banner.txt")
-			if err == nil || banner != nil {
-				return fmt.Sprintf(string(banner), ctx.User())
+			err := newContextEvent(ctx, true, entity.EventTypeAuth, action, metadata)
+			if err != nil {
+				log.Error("Error saving auth event", "error", err)
 			}
 
-			return ""
+			return loginDone(ctx.User(), password, accepted)
 		}),
+		wish.WithBannerHandler(bannerHandler),
 		wish.WithMiddleware(
-			bubbletea.Middleware(teaHandler),
+			bubbletea.MiddlewareWithProgramHandler(programHandler, termenv.Ascii),
 			func(next ssh.Handler) ssh.Handler {
 				return func(s ssh.Session) {
-					addActiveUser(s.User())
-
-					next(s)
-
-					removeActiveUser(s.User())
+					pty, _, _ := s.Pty()
+					kexInit := contextKexInit(s.Context())
+					session := &entity.Session{
+						ID:            s.Context().SessionID(),
+						User:          s.User(),
+						Host:          s.RemoteAddr().String(),
+						App:           appSSH,
+						ClientVersion: s.Context().ClientVersion(),
+						LocalPort:     addrPort(s.LocalAddr()),
+						Term:          pty.Term,
+					}
+					if kexInit != nil {
+						session.HASSH = kexInit.hassh()
+						session.HASSHAlgorithms = kexInit.hasshAlgorithms()
+					}
+
+					trackSession(session, connKicker(s.Context()), func() { next(s) })
 				}
 			},
 			activeterm.Middleware(), // Bubble Tea apps usually require a PTY.
@@ -190,55 +281,137 @@ func StartHoneyPot(appConfigDir string) {
 
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	log.Info("Starting SSH server", "host", host, "port", potPort)
-
-	go func() {
-		if err = s.ListenAndServe(); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
-			log.Error("Could not start server", "error", err)
-			done <- nil
-		}
-	}()
+	log.Info("Starting SSH server", "host", host)
 
-	if len(potAdditionalListeners) > 0 {
-		for _, additionalListener := range potAdditionalListeners {
-			if additionalListener == nil {
-				continue
-			}
-
-			go func() {
-				if err = s.Serve(*additionalListener); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
-					log.Error("Could not start server", "error", err)
-					done <- nil
-				}
-			}()
-		}
+	listenersMu.Lock()
+	potServer = s
+	err = errors.Join(syncListeners(), syncTelnetListeners(), syncHTTPListeners())
+	listenersMu.Unlock()
+	if err != nil {
+		log.Error("Could not listen on every port", "error", err)
 	}
 
-	// SSH Reverse Tunnel
-	if tunnelKey != "" || tunnelAddr != "" || tunnelUser != "" {
-		go setupReverseTunnel(
-			tunnelUser, tunnelAddr, tunnelPort,
-			tunnelKey, knownHostsPath,
-			fmt.Sprintf("localhost:%s", potPort), // The primary address of the honey pot.
-			tunnelRemoteBind, tunnelRemoteForwardPort,
-		)
+	if !primaryListening() {
+		log.Error("Could not start server on the primary port")
+		s.Close()
+		return
 	}
 
+	// SSH Reverse Tunnels
+	startTunnels()
+
 	<-done
-	log.Info("Stopping SSH server")
+	shutdownTunnels()
+	closePortListeners(telnetListeners)
+	closePortListeners(httpListeners)
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer func() { cancel() }()
+	log.Info("Stopping HTTP server")
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Error("Could not stop HTTP server", "error", err)
+	}
+	log.Info("Stopping SSH server")
 	if err := s.Shutdown(ctx); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
 		log.Error("Could not stop server", "error", err)
 	}
 }
 
+// loginRefused checks a login against the bans, the persona's auth policy and
+// the user limit, returning why it was refused or an empty string if it's let
+// in.
+func loginRefused(p *persona, user string, clientVersion string, password string, attempt int) string {
+	refused := ""
+	switch {
+	case loginBan(user, clientVersion) != nil:
+		refused = refusedBanned
+	case !p.accepts(user, password, attempt):
+		refused = refusedPolicy
+	case activeUsersLen()+1 > StatMaxUsers():
+		refused = refusedMaxUsers
+	}
+
+	if refused != "" {
+		metricConnectionsRefused.Inc(refused)
+	}
+	return refused
+}
+
+// loginDone counts a login attempt once its auth event is recorded, and
+// returns whether it was accepted.
+func loginDone(user string, password string, accepted bool) bool {
+	if !accepted {
+		metricAuthFailures.Inc()
+		return false
+	}
+
+	log.Info(fmt.Sprintf("Authorization used: %s, %s", user, password))
+	incrementUsersThisSession()
+	return true
+}
+
+// trackSession records a shell session and lists it as active while run runs
+// the shell. kick closes the session's connection.
+func trackSession(session *entity.Session, kick func() error, run func()) {
+	if err := session.Start(); err != nil {
+		log.Error("Error saving session", "error", err)
+	}
+	metricLogins.Inc()
+
+	addActiveUser(session.User)
+	addActiveSession(session, kick)
+
+	run()
+
+	removeLiveSession(session.ID)
+	removeActiveSession(session.ID)
+	removeActiveUser(session.User)
+
+	if err := session.End(); err != nil {
+		log.Error("Error saving session", "error", err)
+	}
+	metricSessionDuration.Observe(session.Duration().Seconds())
+}
+
+// sessionInfo is what a shell needs to know about the connection it runs on.
+type sessionInfo struct {
+	id            string
+	app           string
+	user          string
+	remoteAddr    net.Addr
+	localAddr     net.Addr
+	clientVersion string
+	kexInit       *clientKexInit
+	term          string
+	width         int
+	height        int
+	persona       *persona
+}
+
 func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
 	// This should never fail, as we are using the activeterm middleware.
 	pty, _, _ := s.Pty()
 
-	renderer := bubbletea.MakeRenderer(s)
+	m := newModel(bubbletea.MakeRenderer(s), sessionInfo{
+		id:            s.Context().SessionID(),
+		app:           appSSH,
+		user:          s.Context().User(),
+		remoteAddr:    s.Context().RemoteAddr(),
+		localAddr:     s.Context().LocalAddr(),
+		clientVersion: s.Context().ClientVersion(),
+		kexInit:       contextKexInit(s.Context()),
+		term:          pty.Term,
+		width:         pty.Window.Width,
+		height:        pty.Window.Height,
+		persona:       contextPersona(s.Context()),
+	})
+
+	return m, []tea.ProgramOption{
+		//tea.WithAltScreen(),
+	}
+}
 
+// newModel builds the shell for a session, styled for its terminal.
+func newModel(renderer *lipgloss.Renderer, info sessionInfo) model {
 	txtStyle := renderer.NewStyle().Foreground(lipgloss.AdaptiveColor{
 		Light: "10", // Light green
 		Dark:  "10", // Light green
@@ -266,17 +439,24 @@ func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
 	textinput.PromptStyle = txtStyle
 	textinput.TextStyle = txtStyle
 
-	filesystem.Initialize()
-
-	m := model{
-		user:          s.Context().User(),
-		host:          s.Context().RemoteAddr().String(),
+	_, home := filesystem.New(info.persona.profile)
+
+	return model{
+		sessionID:     info.id,
+		app:           info.app,
+		user:          info.user,
+		host:          info.remoteAddr.String(),
+		clientVersion: info.clientVersion,
+		kexInit:       info.kexInit,
+		remotePort:    addrPort(info.remoteAddr),
+		localPort:     addrPort(info.localAddr),
 		group:         "default",
-		term:          pty.Term,
-		currentDir:    filesystem.HomeDir,
+		term:          info.term,
+		currentDir:    home,
+		persona:       info.persona,
 		profile:       renderer.ColorProfile().Name(),
-		width:         pty.Window.Width,
-		height:        pty.Window.Height,
+		width:         info.width,
+		height:        info.height,
 		txtStyle:      txtStyle,
 		quitStyle:     quitStyle,
 		outputStyle:   outputStyle,
@@ -287,17 +467,13 @@ func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
 			"session_start": time.Now(),
 		},
 		confetti:   confetti.InitialModel(),
-		matrix:     matrix.InitialModel(pty.Window.Width, pty.Window.Height),
-		ctf:        ctf.InitialModel(convertTasks(config.Active.Tasks)),
+		matrix:     matrix.InitialModel(info.width, info.height),
+		ctf:        ctf.InitialModel(info.persona.tasks),
 		output:     "",
 		helpText:   "Type 'help' to see some commands; Use up/down for history.",
 		historyIdx: 0,
 		history:    []string{},
 	}
-
-	return m, []tea.ProgramOption{
-		//tea.WithAltScreen(),
-	}
 }
 
 func convertTasks(t []config.Task) []ctf.Task {
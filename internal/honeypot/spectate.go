@@ -0,0 +1,251 @@
+package honeypot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/bubbletea"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/filesystem"
+)
+
+const watcherBuffer = 256
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// operatorCommandMsg runs a command in a session on an operator's behalf.
+type operatorCommandMsg string
+
+// liveSession is a running shell that operators can watch and talk to.
+type liveSession struct {
+	program  *tea.Program
+	hostname string // The persona's, which wall messages come from
+	width    int
+	height   int
+	mu       sync.Mutex
+	watchers map[chan []byte]struct{}
+}
+
+var (
+	liveSessionsMu sync.Mutex
+	liveSessions   = map[string]*liveSession{}
+)
+
+// Watcher receives a copy of everything a session's terminal is sent.
+type Watcher struct {
+	C      <-chan []byte // Closed when the session ends or the watcher falls behind
+	Width  int
+	Height int
+
+	c    chan []byte
+	live *liveSession
+}
+
+// Close stops watching.
+func (w *Watcher) Close() {
+	w.live.mu.Lock()
+	if _, ok := w.live.watchers[w.c]; ok {
+		delete(w.live.watchers, w.c)
+		close(w.c)
+	}
+	w.live.mu.Unlock()
+}
+
+// teeWriter passes terminal output through to the session and copies it to
+// the session's watchers.
+type teeWriter struct {
+	io.Writer
+	live *liveSession
+}
+
+func (t teeWriter) Write(p []byte) (int, error) {
+	n, err := t.Writer.Write(p)
+	if n > 0 {
+		t.live.broadcast(p[:n])
+	}
+	return n, err
+}
+
+func (l *liveSession) broadcast(p []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.watchers) == 0 {
+		return
+	}
+
+	data := make([]byte, len(p))
+	copy(data, p)
+
+	for c := range l.watchers {
+		select {
+		case c <- data:
+		default:
+			// A watcher that misses output would show a garbled screen, so
+			// drop it instead and let it reconnect.
+			delete(l.watchers, c)
+			close(c)
+		}
+	}
+}
+
+func (l *liveSession) closeWatchers() {
+	l.mu.Lock()
+	for c := range l.watchers {
+		delete(l.watchers, c)
+		close(c)
+	}
+	l.mu.Unlock()
+}
+
+// programHandler builds the Bubble Tea program for a session with its output
+// teed so the session can be watched.
+func programHandler(s ssh.Session) *tea.Program {
+	m, opts := teaHandler(s)
+	pty, _, _ := s.Pty()
+
+	var out io.Writer = s
+	if !s.EmulatedPty() && pty.Slave != nil {
+		out = pty.Slave
+	}
+
+	opts = append(opts, bubbletea.MakeOptions(s)...)
+
+	return newLiveProgram(s.Context().SessionID(), contextPersona(s.Context()), pty.Window.Width, pty.Window.Height, m, out, opts...)
+}
+
+// newLiveProgram builds a session's Bubble Tea program writing to out, and
+// lists it for operators to watch.
+func newLiveProgram(id string, p *persona, width int, height int, m tea.Model, out io.Writer, opts ...tea.ProgramOption) *tea.Program {
+	live := &liveSession{
+		hostname: p.profile.Hostname,
+		width:    width,
+		height:   height,
+		watchers: map[chan []byte]struct{}{},
+	}
+
+	opts = append(opts, tea.WithOutput(teeWriter{Writer: out, live: live}))
+	live.program = tea.NewProgram(m, opts...)
+
+	liveSessionsMu.Lock()
+	liveSessions[id] = live
+	liveSessionsMu.Unlock()
+
+	return live.program
+}
+
+func removeLiveSession(id string) {
+	liveSessionsMu.Lock()
+	live, ok := liveSessions[id]
+	delete(liveSessions, id)
+	liveSessionsMu.Unlock()
+
+	if ok {
+		live.closeWatchers()
+	}
+}
+
+func getLiveSession(id string) (*liveSession, error) {
+	liveSessionsMu.Lock()
+	defer liveSessionsMu.Unlock()
+
+	live, ok := liveSessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	return live, nil
+}
+
+// Watch starts copying a session's terminal output. The session's screen is
+// redrawn so the watcher starts with a full picture.
+func Watch(id string) (*Watcher, error) {
+	live, err := getLiveSession(id)
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(chan []byte, watcherBuffer)
+	live.mu.Lock()
+	live.watchers[c] = struct{}{}
+	live.mu.Unlock()
+
+	live.program.Send(tea.ClearScreen())
+
+	logOperatorEvent(id, "Operator started watching")
+
+	return &Watcher{C: c, Width: live.width, Height: live.height, c: c, live: live}, nil
+}
+
+// Wall shows a broadcast message in the session, like wall(1) from root.
+func Wall(id string, message string) error {
+	live, err := getLiveSession(id)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf(
+		"Broadcast message from root@%s (pts/0) (%s):\n\n%s",
+		live.hostname, time.Now().Format("Mon Jan _2 15:04:05 2006"), message,
+	)
+
+	return sendOutput(id, "Operator sent wall: "+message, text)
+}
+
+// Say shows text in the session's output as is, e.g. a chat from the "sysadmin".
+func Say(id string, message string) error {
+	return sendOutput(id, "Operator said: "+message, message)
+}
+
+// TypeCommand runs a command in the session as if it had been typed there.
+func TypeCommand(id string, command string) error {
+	live, err := getLiveSession(id)
+	if err != nil {
+		return err
+	}
+
+	live.program.Send(operatorCommandMsg(command))
+	logOperatorEvent(id, "Operator typed: "+command)
+	return nil
+}
+
+func sendOutput(id string, action string, text string) error {
+	live, err := getLiveSession(id)
+	if err != nil {
+		return err
+	}
+
+	live.program.Send(filesystem.OutputMsg(text))
+	logOperatorEvent(id, action)
+	return nil
+}
+
+// logOperatorEvent records operator actions as system events on the session.
+func logOperatorEvent(id string, action string) {
+	session := activeSession(id)
+	if session == nil {
+		return
+	}
+
+	event := &entity.Event{
+		User:      session.User,
+		Host:      session.Host,
+		App:       session.App,
+		Source:    entity.EventSourceSystem,
+		Type:      entity.EventTypeOperator,
+		Action:    action,
+		Timestamp: time.Now(),
+		Metadata:  entity.EventMetadata{"session_id": id},
+	}
+
+	event.Publish()
+	if err := event.Queue(); err != nil {
+		log.Error("Error saving operator event", "error", err)
+	}
+}
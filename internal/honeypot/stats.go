@@ -1,10 +1,12 @@
 package honeypot
 
 import (
+	"sort"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/stats"
 )
 
 var (
@@ -16,6 +18,15 @@ func StatActiveUsers() int {
 	return activeUsersLen()
 }
 
+// StatActiveSessions returns the sessions connected right now, oldest first.
+func StatActiveSessions() []entity.Session {
+	sessions := activeSessionsSnapshot()
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.Before(sessions[j].StartedAt)
+	})
+	return sessions
+}
+
 func StatUsersThisSession() int {
 	return usersThisSessionCount()
 }
@@ -26,25 +37,13 @@ func StatUsersAllTime() int {
 		return usersAllTimeCacheValue
 	}
 
-	data, err := entity.EventCountQuery(`
-		SELECT
-			"logins" AS Value,
-			COUNT(*) AS Count
-		FROM events
-		WHERE
-			events.type = 'login'
-			AND events.source = 'user'
-	`)
+	count, err := stats.LoginsAllTime()
 	if err != nil {
 		log.Error("statUsersAllTime", "error", err)
 		return usersAllTimeCacheValue // fallback to last cached value
 	}
 
-	if len(data) == 0 {
-		usersAllTimeCacheValue = 0
-	} else {
-		usersAllTimeCacheValue = data[0].Count
-	}
+	usersAllTimeCacheValue = count
 	usersAllTimeCacheTTL = now.Add(10 * time.Second)
 	return usersAllTimeCacheValue
 }
@@ -60,7 +59,3 @@ func StatMaxUsers() int {
 
 	return maxUsers
 }
-
-func StatTunnelActive() int {
-	return tunnelActive
-}
@@ -0,0 +1,195 @@
+package honeypot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/telnet"
+	"github.com/muesli/termenv"
+)
+
+const (
+	telnetMaxAttempts  = 3               // Logins tried before the connection is closed, like login(1)
+	telnetLoginTimeout = time.Minute     // Time to log in before the connection is closed
+	telnetFailDelay    = 2 * time.Second // Pause after a wrong password, like login(1)
+)
+
+var (
+	telnetPorts     []string                    // Ports the pot answers telnet on
+	telnetListeners = map[string]net.Listener{} // Open telnet listeners by port, guarded by listenersMu
+)
+
+// SetTelnetPorts sets the ports the pot answers telnet on. Once the pot is
+// running it starts and stops listening to match, without dropping
+// connections already made.
+func SetTelnetPorts(ports []string) error {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	telnetPorts = slices.Clone(ports)
+	if potServer == nil {
+		return nil
+	}
+
+	return syncTelnetListeners()
+}
+
+// syncTelnetListeners opens and closes telnet listeners to match telnetPorts.
+// listenersMu must be held.
+func syncTelnetListeners() error {
+	return syncPortListeners("telnet", telnetPorts, telnetListeners, func(port string, l net.Listener) {
+		acceptPortConns(port, l, handleTelnet)
+	})
+}
+
+// handleTelnet logs a telnet client in with the persona's auth policy, then
+// runs the same shell as SSH sessions get.
+func handleTelnet(pc *portConn) {
+	defer pc.Close()
+
+	conn := admitPortConn(pc, true)
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+
+	p := personaFor(pc.port)
+	tc := telnet.NewConn(conn)
+	out := ssh.NewPtyWriter(tc)
+	id := newSessionID()
+
+	tc.SetDeadline(time.Now().Add(telnetLoginTimeout))
+	if err := tc.Negotiate(); err != nil {
+		return
+	}
+	if banner := p.renderBanner("", tc.RemoteAddr().String()); banner != "" {
+		io.WriteString(out, banner)
+	}
+
+	user, ok := telnetLogin(tc, out, p, id)
+	if !ok {
+		return
+	}
+	tc.SetDeadline(time.Time{})
+
+	session := &entity.Session{
+		ID:        id,
+		User:      user,
+		Host:      tc.RemoteAddr().String(),
+		App:       appTelnet,
+		LocalPort: addrPort(tc.LocalAddr()),
+		Term:      tc.Term(),
+	}
+
+	trackSession(session, tc.Close, func() { runTelnetShell(tc, out, session, p) })
+}
+
+// telnetLogin shows login and password prompts until a login is accepted or
+// the client runs out of attempts, recording each as an auth event.
+func telnetLogin(tc *telnet.Conn, out io.Writer, p *persona, id string) (string, bool) {
+	remote := tc.RemoteAddr().String()
+	for attempt := 1; attempt <= telnetMaxAttempts; attempt++ {
+		fmt.Fprintf(out, "%s login: ", p.profile.Hostname)
+		user, err := tc.ReadLine(true)
+		if err != nil {
+			return "", false
+		}
+		if user == "" {
+			attempt--
+			continue
+		}
+
+		io.WriteString(out, "Password: ")
+		password, err := tc.ReadLine(false)
+		if err != nil {
+			return "", false
+		}
+
+		refused := loginRefused(p, user, "", password, attempt)
+		accepted := refused == ""
+
+		action := "Password accepted"
+		metadata := entity.CredentialMetadata(id, password, accepted, "")
+		if !accepted {
+			action = "Password rejected"
+			metadata["refused"] = refused
+		}
+		err = newAppEvent(appTelnet, user, remote, p, true, entity.EventTypeAuth, action, metadata)
+		if err != nil {
+			log.Error("Error saving auth event", "error", err)
+		}
+
+		if loginDone(user, password, accepted) {
+			return user, true
+		}
+
+		time.Sleep(telnetFailDelay)
+		io.WriteString(out, "\nLogin incorrect\n")
+	}
+
+	return "", false
+}
+
+// runTelnetShell runs the shell over the telnet connection until the client
+// exits or goes away.
+func runTelnetShell(tc *telnet.Conn, out io.Writer, session *entity.Session, p *persona) {
+	width, height := tc.Size()
+	renderer := lipgloss.NewRenderer(out, termenv.WithProfile(termenv.Ascii))
+	m := newModel(renderer, sessionInfo{
+		id:         session.ID,
+		app:        appTelnet,
+		user:       session.User,
+		remoteAddr: tc.RemoteAddr(),
+		localAddr:  tc.LocalAddr(),
+		term:       session.Term,
+		width:      width,
+		height:     height,
+		persona:    p,
+	})
+
+	// Bubble Tea keeps running when its input ends, so end it when the client
+	// hangs up or is kicked.
+	var program *tea.Program
+	in := readerFunc(func(b []byte) (int, error) {
+		n, err := tc.Read(b)
+		if err != nil {
+			program.Quit()
+		}
+		return n, err
+	})
+
+	program = newLiveProgram(session.ID, p, width, height, m, out, tea.WithInput(in))
+	tc.OnResize(func(width, height int) {
+		program.Send(tea.WindowSizeMsg{Width: width, Height: height})
+	})
+	go program.Send(tea.WindowSizeMsg{Width: width, Height: height})
+
+	if _, err := program.Run(); err != nil {
+		log.Error("Telnet shell exited with an error", "error", err)
+	}
+	program.Kill()
+}
+
+// readerFunc is an io.Reader made from a function.
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(b []byte) (int, error) {
+	return f(b)
+}
+
+// newSessionID makes an ID for a telnet session that looks like an SSH one.
+func newSessionID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,13 +1,20 @@
 package honeypot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net"
 	"os"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/proxyproto"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/knownhosts"
 )
@@ -25,100 +32,490 @@ func publicKeyFile(file string) (ssh.AuthMethod, error) {
 	return ssh.PublicKeys(key), nil
 }
 
-// setupReverseTunnel establishes the reverse tunnel and keeps it alive.
-func setupReverseTunnel(
-	tunnelUser, tunnelHost string,
-	tunnelSSHPort string,
-	sshKeyPath, knownHostsPath string,
-	localServiceAddr string, // Address of the local web server (e.g., "localhost:8080")
-	remoteBindAddr string, // Address to bind on remote server (e.g., "0.0.0.0")
-	remoteForwardPort string, // Port to forward on remote server (e.g., 8022)
-) {
-	log.Debug(
-		"Attempting to set up reverse tunnel.",
-		"Remote Host:", fmt.Sprintf("%s@%s:%s", tunnelUser, tunnelHost, tunnelSSHPort),
-		"SSH Key:", sshKeyPath,
-		"Known Hosts:", knownHostsPath,
-		"Forwarding Remote Port:", fmt.Sprintf("%s:%s", remoteBindAddr, remoteForwardPort),
-		"Local Service:", localServiceAddr,
-	)
+// tunnelSettings describe the remote SSH server the reverse tunnel connects
+// to and what it asks that server to forward.
+type tunnelSettings struct {
+	Name              string        // Shown in the tunnel status
+	User              string        // Username for remote SSH server
+	Host              string        // Hostname or IP of remote SSH server
+	Port              string        // Port of remote SSH server
+	Key               string        // Path to private SSH key for remote server
+	RemoteBind        string        // IP address to bind to on the *remote* server (0.0.0.0 for all)
+	RemotePort        string        // Port to open on the *remote* server for forwarding
+	KnownHosts        string        // Path to known hosts file
+	StrictHostKey     bool          // Refuse servers whose key can't be checked
+	HostKeys          []string      // Pinned SHA256 fingerprints of the server's key
+	KeepaliveInterval time.Duration // Time between keepalives, 0 or less for none
+	KeepaliveMax      int           // Missed keepalives before giving up on the connection
+	Target            string        // Name of the local service, like ssh or web
+	ProxyProtocol     string        // PROXY header version to send with each connection, if any
 
-	// Get SSH Auth Method
-	authMethod, err := publicKeyFile(sshKeyPath)
-	if err != nil {
-		log.Error("Failed to load private key: %v", err)
+	target       func() string // Address of the local service, looked up for each connection
+	forwardAdmin bool          // Also forward tunnelAdminForwardPort to the operator console
+}
+
+// Reconnect backoff: the wait doubles after each failure up to the cap, and
+// goes back to the start once a connection stays up for tunnelStableAfter.
+const (
+	tunnelBackoffMin  = time.Second
+	tunnelBackoffMax  = 2 * time.Minute
+	tunnelStableAfter = time.Minute
+	tunnelDialTimeout = 15 * time.Second
+)
+
+// TunnelStatus is the state of one reverse tunnel.
+type TunnelStatus struct {
+	Name      string    `json:"name"`
+	Server    string    `json:"server"` // user@host:port
+	Remote    string    `json:"remote"` // Where the tunnel listens on the server
+	Target    string    `json:"target"`
+	Up        bool      `json:"up"`
+	Since     time.Time `json:"since,omitempty"`      // When it last went up or down
+	Failures  int       `json:"failures"`             // Failed attempts since it was last up
+	LastError string    `json:"last_error,omitempty"` // Why it last went down or failed to connect
+}
+
+// tunnelState is what a running tunnel reports about itself.
+type tunnelState struct {
+	up        bool
+	since     time.Time
+	failures  int
+	lastError string
+}
+
+var (
+	tunnelsMu     sync.Mutex
+	tunnels       []*tunnelSettings
+	tunnelStates  = map[string]*tunnelState{} // By tunnel name
+	tunnelsCancel context.CancelFunc          // Stops the running tunnels; nil when they're not running
+	tunnelsDone   bool                        // Set once the pot is stopping, so a reload can't start them again
+	tunnelsWG     sync.WaitGroup
+)
+
+// setTunnels replaces the configured tunnels. If the old ones are running they
+// are stopped, and the new ones started in their place.
+func setTunnels(ts []*tunnelSettings) {
+	tunnelsMu.Lock()
+	running := tunnelsCancel != nil
+	tunnelsMu.Unlock()
+
+	if running {
+		stopTunnels()
+	}
+
+	tunnelsMu.Lock()
+	tunnels = ts
+	tunnelStates = map[string]*tunnelState{}
+	tunnelsMu.Unlock()
+
+	if running {
+		startTunnels()
+	}
+}
+
+// startTunnels connects every configured tunnel, each in its own goroutine
+// that keeps it connected until stopTunnels. It does nothing once
+// shutdownTunnels has been called.
+func startTunnels() {
+	tunnelsMu.Lock()
+	defer tunnelsMu.Unlock()
+
+	if tunnelsCancel != nil || tunnelsDone {
 		return
 	}
 
-	// Host Key Verification (Recommended)
-	hostKeyCallback := ssh.InsecureIgnoreHostKey()
-	if knownHostsPath != "" {
-		hostKeyCallback, err = knownhosts.New(knownHostsPath)
-		if err != nil {
-			// If known_hosts doesn't exist or is invalid, fallback is less secure.
-			// Consider if you want to *require* known_hosts.
-			log.Warn("Could not load known_hosts file. Using InsecureIgnoreHostKey.", "file", knownHostsPath, "error", err)
+	ctx, cancel := context.WithCancel(context.Background())
+	tunnelsCancel = cancel
+	for _, t := range tunnels {
+		tunnelsWG.Add(1)
+		go func() {
+			defer tunnelsWG.Done()
+			t.run(ctx)
+		}()
+	}
+}
+
+// stopTunnels disconnects the tunnels and waits for them to finish.
+func stopTunnels() {
+	tunnelsMu.Lock()
+	cancel := tunnelsCancel
+	tunnelsCancel = nil
+	tunnelsMu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	tunnelsWG.Wait()
+}
+
+// shutdownTunnels stops the tunnels for good when the pot stops, including
+// any a reload under way would otherwise start again.
+func shutdownTunnels() {
+	tunnelsMu.Lock()
+	tunnelsDone = true
+	tunnelsMu.Unlock()
+
+	stopTunnels()
+}
+
+// state returns the tunnel's state, creating it if needed. tunnelsMu must be
+// held.
+func (t *tunnelSettings) state() *tunnelState {
+	st, ok := tunnelStates[t.Name]
+	if !ok {
+		st = &tunnelState{since: time.Now()}
+		tunnelStates[t.Name] = st
+	}
+
+	return st
+}
+
+// StatTunnels returns the state of every configured tunnel, in the order
+// they're configured.
+func StatTunnels() []TunnelStatus {
+	tunnelsMu.Lock()
+	defer tunnelsMu.Unlock()
+
+	statuses := make([]TunnelStatus, 0, len(tunnels))
+	for _, t := range tunnels {
+		st := t.state()
+		statuses = append(statuses, TunnelStatus{
+			Name:      t.Name,
+			Server:    t.server(),
+			Remote:    t.remote(),
+			Target:    t.Target,
+			Up:        st.up,
+			Since:     st.since,
+			Failures:  st.failures,
+			LastError: st.lastError,
+		})
+	}
+
+	return statuses
+}
+
+// StatTunnelActive sums up the tunnels: -1 when none are configured, 1 when
+// they're all up and 0 otherwise.
+func StatTunnelActive() int {
+	statuses := StatTunnels()
+	if len(statuses) == 0 {
+		return -1
+	}
+
+	for _, t := range statuses {
+		if !t.Up {
+			return 0
 		}
+	}
+
+	return 1
+}
+
+func (t *tunnelSettings) server() string {
+	return fmt.Sprintf("%s@%s", t.User, net.JoinHostPort(t.Host, t.Port))
+}
+
+func (t *tunnelSettings) remote() string {
+	return net.JoinHostPort(t.RemoteBind, t.RemotePort)
+}
+
+// hostKeyCallback checks the remote server's key against the pinned
+// fingerprints, or failing that known_hosts. Without either, any key is
+// accepted unless StrictHostKey is set, and its fingerprint is logged so it
+// can be pinned.
+func (t *tunnelSettings) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if len(t.HostKeys) > 0 {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			fingerprint := ssh.FingerprintSHA256(key)
+			if slices.Contains(t.HostKeys, fingerprint) {
+				return nil
+			}
+			return fmt.Errorf("host key %s for %s isn't one of tunnel_host_keys", fingerprint, hostname)
+		}, nil
+	}
+
+	if t.KnownHosts != "" {
+		callback, err := knownhosts.New(t.KnownHosts)
+		if err == nil {
+			return callback, nil
+		}
+		if t.StrictHostKey {
+			return nil, fmt.Errorf("cannot load known_hosts file %s: %w", t.KnownHosts, err)
+		}
+		log.Warn("Could not load known_hosts file. Accepting any host key.", "file", t.KnownHosts, "error", err)
+	} else if t.StrictHostKey {
+		return nil, errors.New("strict host key checking needs a known_hosts file or pinned host keys")
 	} else {
-		log.Warn("No known host file set. Using InsecureIgnoreHostKey.")
+		log.Warn("No known hosts file or pinned host keys set. Accepting any host key.")
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		log.Info("Accepted tunnel host key without checking it.", "host", hostname, "fingerprint", ssh.FingerprintSHA256(key))
+		return nil
+	}, nil
+}
 
+// keepalive is the tunnel's health check. It sends keepalive requests over
+// client until KeepaliveMax of them in a row go unanswered, then closes the
+// client and says why, or until done is closed.
+func (t *tunnelSettings) keepalive(client *ssh.Client, done <-chan struct{}) error {
+	if t.KeepaliveInterval <= 0 {
+		return nil
 	}
 
-	// Configure SSH Client
-	sshConfig := &ssh.ClientConfig{
-		User: tunnelUser,
-		Auth: []ssh.AuthMethod{
-			authMethod,
-		},
-		HostKeyCallback: hostKeyCallback,
-		Timeout:         15 * time.Second, // Connection timeout
+	ticker := time.NewTicker(t.KeepaliveInterval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		select {
+		case err := <-reply:
+			if err == nil {
+				missed = 0
+				continue
+			}
+			log.Warn("Tunnel keepalive failed.", "tunnel", t.Name, "error", err)
+		case <-time.After(t.KeepaliveInterval):
+			log.Warn("Tunnel keepalive went unanswered.", "tunnel", t.Name, "missed", missed+1)
+		case <-done:
+			return nil
+		}
+
+		missed++
+		if missed >= max(t.KeepaliveMax, 1) {
+			client.Close()
+			return fmt.Errorf("server stopped answering keepalives after %d tries", missed)
+		}
 	}
+}
 
-	// Connect to remote SSH server
-	remoteServerAddr := fmt.Sprintf("%s:%s", tunnelHost, tunnelSSHPort)
-	log.Debug("Connecting to remote SSH server...", "host", remoteServerAddr)
+// run keeps the tunnel connected until ctx is cancelled, reconnecting with
+// capped exponential backoff and jitter.
+func (t *tunnelSettings) run(ctx context.Context) {
+	log.Debug(
+		"Attempting to set up reverse tunnel.",
+		"Tunnel:", t.Name,
+		"Remote Host:", t.server(),
+		"SSH Key:", t.Key,
+		"Known Hosts:", t.KnownHosts,
+		"Forwarding Remote Port:", t.remote(),
+		"Local Service:", t.target(),
+	)
 
-	// Loop for potential reconnection (optional, basic implementation)
-	retryWaitFactor := 1
+	backoff := tunnelBackoffMin
 	for {
-		sshClient, err := ssh.Dial("tcp", remoteServerAddr, sshConfig)
-		if err != nil {
-			log.Warn("Failed to dial remote SSH server. Retrying in 10 seconds...", "error", err)
-			time.Sleep(10 * time.Second)
-			continue // Retry connection
+		// The key and known hosts are read on every attempt, so fixing a
+		// missing or unreadable one doesn't need a restart.
+		started := time.Now()
+		sshConfig, err := t.clientConfig()
+		if err == nil {
+			err = t.connect(ctx, sshConfig)
+		}
+		if ctx.Err() != nil {
+			t.stopped()
+			return
 		}
-		log.Debug("Successfully connected to remote SSH server.")
 
-		// Request the remote side to listen and forward
-		remoteListenAddr := fmt.Sprintf("%s:%s", remoteBindAddr, remoteForwardPort)
-		log.Debug("Requesting remote server to listen on...", "host", remoteListenAddr)
-		listener, err := sshClient.Listen("tcp", remoteListenAddr)
-		if err != nil {
-			log.Warn("Failed to request remote listener: %v. (Check remote sshd_config AllowTcpForwarding). Retrying connection in %d seconds...", err, retryWaitFactor*10)
-			sshClient.Close() // Close the potentially broken client
-			tunnelActive = 0  // Tunnel is not active
+		if time.Since(started) >= tunnelStableAfter {
+			backoff = tunnelBackoffMin
+		}
 
-			time.Sleep(time.Duration(10*retryWaitFactor) * time.Second)
-			retryWaitFactor++ // Increase wait time for next retry
-			continue          // Retry connection
+		// Equal jitter, waiting between half and all of the backoff, keeps
+		// tunnels that dropped together, like ones through the same server,
+		// from reconnecting in lockstep.
+		wait := backoff/2 + rand.N(backoff/2+1)
+		log.Warn("Reverse tunnel down. Reconnecting.", "tunnel", t.Name, "error", err, "retry_in", wait.Round(time.Second))
+		t.failed(err, wait)
+		metricTunnelReconnects.Inc()
+
+		select {
+		case <-ctx.Done():
+			t.stopped()
+			return
+		case <-time.After(wait):
 		}
 
-		log.Info("Remote server is now active!", "listening on", remoteListenAddr, "forwarding to", localServiceAddr)
-		tunnelActive = 1    // Tunnel is active
-		retryWaitFactor = 1 // Reset retry wait factor
+		backoff = min(backoff*2, tunnelBackoffMax)
+	}
+}
 
-		// --- Accept loop: Handle incoming connections from the tunnel ---
-		acceptLoop(listener, localServiceAddr)
+// clientConfig loads the tunnel's key and host key checks for a connection.
+func (t *tunnelSettings) clientConfig() (*ssh.ClientConfig, error) {
+	authMethod, err := publicKeyFile(t.Key)
+	if err != nil {
+		return nil, fmt.Errorf("loading private key: %w", err)
+	}
 
-		// If acceptLoop returns, it means the listener failed (likely SSH connection dropped)
-		log.Warn("Tunnel listener closed. Attempting to reconnect...")
-		sshClient.Close()           // Ensure client is closed before retrying
-		time.Sleep(5 * time.Second) // Wait a bit before reconnecting
+	hostKeyCallback, err := t.hostKeyCallback()
+	if err != nil {
+		return nil, err
 	}
+
+	return &ssh.ClientConfig{
+		User:            t.User,
+		Auth:            []ssh.AuthMethod{authMethod},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         tunnelDialTimeout,
+	}, nil
 }
 
-// acceptLoop handles incoming connections for a listener
-func acceptLoop(listener net.Listener, localServiceAddr string) {
+// connect makes one connection to the server and forwards connections until
+// it drops, returning why.
+func (t *tunnelSettings) connect(ctx context.Context, sshConfig *ssh.ClientConfig) error {
+	// Connect to remote SSH server
+	log.Debug("Connecting to remote SSH server...", "tunnel", t.Name, "host", t.server())
+	dialer := net.Dialer{Timeout: tunnelDialTimeout}
+	addr := net.JoinHostPort(t.Host, t.Port)
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	// The handshake can't be cancelled, so give it a deadline instead.
+	conn.SetDeadline(time.Now().Add(tunnelDialTimeout))
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConfig)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	sshClient := ssh.NewClient(c, chans, reqs)
+	defer sshClient.Close()
+
+	// Closing the client ends the accept loop below.
+	stop := context.AfterFunc(ctx, func() { sshClient.Close() })
+	defer stop()
+
+	// Request the remote side to listen and forward
+	log.Debug("Requesting remote server to listen on...", "tunnel", t.Name, "host", t.remote())
+	listener, err := sshClient.Listen("tcp", t.remote())
+	if err != nil {
+		return fmt.Errorf("remote listen on %s failed, check AllowTcpForwarding in the server's sshd_config: %w", t.remote(), err)
+	}
+
+	log.Info("Remote server is now active!", "tunnel", t.Name, "listening on", t.remote(), "forwarding to", t.target())
+	t.connected()
+
+	// The operator console rides along on the same connection when asked.
+	if t.forwardAdmin && tunnelAdminForwardPort != "" && adminServiceAddr != "" {
+		adminListenAddr := net.JoinHostPort(t.RemoteBind, tunnelAdminForwardPort)
+		adminListener, err := sshClient.Listen("tcp", adminListenAddr)
+		if err != nil {
+			log.Warn("Failed to request remote listener for the operator console.", "host", adminListenAddr, "error", err)
+		} else {
+			log.Info("Operator console forwarded through the tunnel", "listening on", adminListenAddr, "forwarding to", adminServiceAddr)
+			go acceptLoop(adminListener, func() string { return adminServiceAddr }, "")
+		}
+	}
+
+	done := make(chan struct{})
+	health := make(chan error, 1)
+	go func() { health <- t.keepalive(sshClient, done) }()
+
+	// --- Accept loop: Handle incoming connections from the tunnel ---
+	acceptLoop(listener, t.target, t.ProxyProtocol)
+	close(done)
+
+	if err := <-health; err != nil {
+		return err
+	}
+	return errors.New("connection closed")
+}
+
+// connected marks the tunnel up and records the change.
+func (t *tunnelSettings) connected() {
+	tunnelsMu.Lock()
+	st := t.state()
+	st.up, st.since, st.failures, st.lastError = true, time.Now(), 0, ""
+	tunnelsMu.Unlock()
+
+	t.record("Tunnel "+t.Name+" connected", entity.EventMetadata{"state": "up"})
+}
+
+// failed marks the tunnel down after an error. Going down is always recorded,
+// but failed reconnects only when the error changes, so a server that's gone
+// for a day doesn't fill the event log.
+func (t *tunnelSettings) failed(err error, retryIn time.Duration) {
+	tunnelsMu.Lock()
+	st := t.state()
+	wasUp, sameError := st.up, st.lastError == err.Error()
+	if wasUp {
+		st.since = time.Now()
+	}
+	st.up = false
+	st.failures++
+	st.lastError = err.Error()
+	failures := st.failures
+	tunnelsMu.Unlock()
+
+	metadata := entity.EventMetadata{"state": "down", "error": err.Error(), "failures": failures}
+	if retryIn > 0 {
+		metadata["retry_in"] = retryIn.Round(time.Second).String()
+	}
+
+	switch {
+	case wasUp:
+		t.record("Tunnel "+t.Name+" disconnected: "+err.Error(), metadata)
+	case !sameError:
+		metadata["state"] = "error"
+		t.record("Tunnel "+t.Name+" failed to connect: "+err.Error(), metadata)
+	}
+}
+
+// stopped marks the tunnel down because it was shut down on purpose.
+func (t *tunnelSettings) stopped() {
+	tunnelsMu.Lock()
+	st := t.state()
+	wasUp := st.up
+	st.up, st.since = false, time.Now()
+	tunnelsMu.Unlock()
+
+	if wasUp {
+		t.record("Tunnel "+t.Name+" stopped", entity.EventMetadata{"state": "stopped"})
+	}
+}
+
+func (t *tunnelSettings) record(action string, metadata entity.EventMetadata) {
+	event := &entity.Event{
+		App:       "system",
+		Source:    entity.EventSourceSystem,
+		Type:      entity.EventTypeTunnel,
+		Action:    action,
+		Timestamp: time.Now(),
+		Metadata: entity.EventMetadata{
+			"tunnel": t.Name,
+			"server": t.server(),
+			"remote": t.remote(),
+			"target": t.Target,
+		}.Merge(metadata),
+	}
+
+	event.Publish()
+	if err := event.Queue(); err != nil {
+		log.Error("Error saving tunnel event", "error", err)
+	}
+}
+
+// acceptLoop handles incoming connections for a listener, forwarding each to
+// wherever localServiceAddr says at the time. With a proxyProtocol version,
+// each connection starts with a PROXY header carrying the address it came
+// from on the remote side.
+func acceptLoop(listener net.Listener, localServiceAddr func() string, proxyProtocol string) {
 	defer listener.Close() // Ensure listener is closed when this function exits
 	for {
 		remoteConn, err := listener.Accept()
@@ -131,7 +528,7 @@ func acceptLoop(listener net.Listener, localServiceAddr string) {
 		log.Debug("Accepted tunneled connection.", "from", remoteConn.RemoteAddr())
 
 		// Handle the connection in a new goroutine
-		go func(tunneledConn net.Conn) {
+		go func(tunneledConn net.Conn, localServiceAddr string) {
 			defer tunneledConn.Close()
 
 			// Dial the local web service
@@ -141,6 +538,13 @@ func acceptLoop(listener net.Listener, localServiceAddr string) {
 				return // Close the tunneled connection
 			}
 			defer localConn.Close()
+
+			if proxyProtocol != "" {
+				if err := proxyproto.WriteHeader(localConn, proxyProtocol, tunneledConn.RemoteAddr(), tunneledConn.LocalAddr()); err != nil {
+					log.Warn("Failed to send PROXY header.", "error", err)
+					return
+				}
+			}
 			log.Debug("Successfully connected to local web service or tunneled connection", "addr", localServiceAddr)
 
 			// Proxy data
@@ -156,6 +560,6 @@ func acceptLoop(listener net.Listener, localServiceAddr string) {
 			}
 			log.Debug("Finished proxying for tunneled connection.", "tunnel", tunneledConn.RemoteAddr())
 
-		}(remoteConn)
+		}(remoteConn, localServiceAddr())
 	}
 }
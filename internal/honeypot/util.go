@@ -1,8 +1,11 @@
 package honeypot
 
 import (
+	"net"
+	"strconv"
 	"time"
 
+	"github.com/charmbracelet/ssh"
 	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
 )
 
@@ -35,22 +38,50 @@ func historyIdxDec(m *model) {
 	m.historyIdx--
 }
 
-func NewEvent(m *model, userEvent bool, eventType string, eventAction string) error {
+func NewEvent(m *model, userEvent bool, eventType string, eventAction string, metadata ...entity.EventMetadata) error {
+	return newAppEvent(m.app, m.user, m.host, m.persona, userEvent, eventType, eventAction, metadata...)
+}
+
+// newContextEvent records an event for an SSH connection that doesn't have a
+// shell model yet, such as during authentication.
+func newContextEvent(ctx ssh.Context, userEvent bool, eventType string, eventAction string, metadata ...entity.EventMetadata) error {
+	return newAppEvent(appSSH, ctx.User(), ctx.RemoteAddr().String(), contextPersona(ctx), userEvent, eventType, eventAction, metadata...)
+}
+
+// newAppEvent records an event from one of the pot's apps, tagged with the
+// persona it was made under.
+func newAppEvent(app string, user string, host string, p *persona, userEvent bool, eventType string, eventAction string, metadata ...entity.EventMetadata) error {
 	source := entity.EventSourceSystem
 	if userEvent {
 		source = entity.EventSourceUser
 	}
 
 	event := &entity.Event{
-		User:      m.user,
-		Host:      m.host,
-		App:       "ssh",
+		User:      user,
+		Host:      host,
+		App:       app,
 		Source:    source,
 		Type:      eventType,
 		Action:    eventAction,
 		Timestamp: time.Now(),
+		Metadata:  entity.EventMetadata{"persona": p.name}.Merge(metadata...),
 	}
 
 	event.Publish()
-	return event.Save()
+	return event.Queue()
+}
+
+// addrPort returns the numeric port of a network address, or 0 if it has none.
+func addrPort(addr net.Addr) int {
+	if addr == nil {
+		return 0
+	}
+
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return 0
+	}
+
+	p, _ := strconv.Atoi(port)
+	return p
 }
@@ -0,0 +1,87 @@
+package proxyproto
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Conn is a connection that starts with a PROXY header. The header is read
+// the first time the connection is read from or asked for its remote address,
+// so a slow client doesn't hold up the listener's accept loop.
+type Conn struct {
+	net.Conn
+
+	r       *bufio.Reader
+	trusted func(net.Addr) bool
+	timeout time.Duration
+
+	once sync.Once
+	src  net.Addr
+	dst  net.Addr
+	err  error
+}
+
+// NewConn wraps conn, which must send a header within timeout. If trusted is
+// set, only peers it allows are accepted, since anyone else could claim to be
+// any address.
+func NewConn(conn net.Conn, trusted func(net.Addr) bool, timeout time.Duration) *Conn {
+	return &Conn{Conn: conn, r: bufio.NewReader(conn), trusted: trusted, timeout: timeout}
+}
+
+func (c *Conn) init() {
+	c.once.Do(func() {
+		if c.trusted != nil && !c.trusted(c.Conn.RemoteAddr()) {
+			c.err = fmt.Errorf("PROXY header from untrusted address %s", c.Conn.RemoteAddr())
+			return
+		}
+
+		if c.timeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+
+		c.src, c.dst, c.err = ReadHeader(c.r)
+	})
+}
+
+// Err returns why the header couldn't be read, if it couldn't.
+func (c *Conn) Err() error {
+	c.init()
+	return c.err
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the client's address from the header, or the peer's
+// address when the header doesn't carry one.
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.init(); c.src != nil {
+		return c.src
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to according to the
+// header, or the local address when the header doesn't carry one.
+func (c *Conn) LocalAddr() net.Addr {
+	if c.init(); c.dst != nil {
+		return c.dst
+	}
+
+	return c.Conn.LocalAddr()
+}
+
+// ProxyAddr returns the address of the proxy that sent the header.
+func (c *Conn) ProxyAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
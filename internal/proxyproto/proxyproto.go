@@ -0,0 +1,215 @@
+// Package proxyproto reads and writes the PROXY protocol headers that load
+// balancers and proxies put in front of a connection to pass on the client's
+// real address. Both the text (v1) and binary (v2) formats are supported.
+//
+// https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Versions of the header.
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+const v1MaxLength = 107 // Including the CRLF
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrNoHeader is returned when a connection doesn't start with a header.
+var ErrNoHeader = errors.New("no PROXY protocol header")
+
+// ReadHeader reads a v1 or v2 header from r and returns the client and
+// destination addresses it carries. Both are nil for a header that doesn't
+// describe a TCP connection, like a v2 LOCAL health check or v1 UNKNOWN.
+func ReadHeader(r *bufio.Reader) (src net.Addr, dst net.Addr, err error) {
+	peek, err := r.Peek(len(v2Signature))
+	if err != nil && len(peek) < 5 {
+		return nil, nil, fmt.Errorf("reading PROXY header: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(peek, v2Signature):
+		return readV2(r)
+	case bytes.HasPrefix(peek, []byte("PROXY")):
+		return readV1(r)
+	}
+
+	return nil, nil, ErrNoHeader
+}
+
+func readV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading PROXY header: %w", err)
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errors.New("PROXY v1 header too long")
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("malformed PROXY v1 header %q", strings.TrimSpace(string(line)))
+	}
+
+	src, err := tcpAddr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := tcpAddr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return src, dst, nil
+}
+
+func tcpAddr(ip string, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("invalid address %q in PROXY header", ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q in PROXY header", port)
+	}
+
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+func readV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, fmt.Errorf("reading PROXY header: %w", err)
+	}
+
+	version, command := header[12]>>4, header[12]&0x0f
+	family := header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	if version != 2 {
+		return nil, nil, fmt.Errorf("unsupported PROXY header version %d", version)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, fmt.Errorf("reading PROXY header: %w", err)
+	}
+
+	switch command {
+	case 0x0: // LOCAL, the proxy talking for itself
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("unsupported PROXY v2 command %d", command)
+	}
+
+	var ipLen int
+	switch family {
+	case 0x11: // TCP over IPv4
+		ipLen = net.IPv4len
+	case 0x21: // TCP over IPv6
+		ipLen = net.IPv6len
+	default:
+		// UNSPEC, UDP and unix sockets don't describe a TCP client.
+		return nil, nil, nil
+	}
+
+	if len(body) < ipLen*2+4 {
+		return nil, nil, errors.New("PROXY v2 header too short for its addresses")
+	}
+
+	src := &net.TCPAddr{
+		IP:   net.IP(bytes.Clone(body[:ipLen])),
+		Port: int(binary.BigEndian.Uint16(body[ipLen*2:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(bytes.Clone(body[ipLen : ipLen*2])),
+		Port: int(binary.BigEndian.Uint16(body[ipLen*2+2:])),
+	}
+
+	return src, dst, nil
+}
+
+// WriteHeader writes a header of the given version saying src connected to
+// dst. If either isn't a TCP address it writes one that says so (v1 UNKNOWN,
+// v2 LOCAL). An IPv4 address paired with an IPv6 one is mapped to IPv6, so
+// both are in the same family.
+func WriteHeader(w io.Writer, version string, src net.Addr, dst net.Addr) error {
+	s, sok := src.(*net.TCPAddr)
+	d, dok := dst.(*net.TCPAddr)
+	known := sok && dok
+
+	ip4 := known && s.IP.To4() != nil && d.IP.To4() != nil
+
+	switch version {
+	case V1:
+		if !known {
+			_, err := io.WriteString(w, "PROXY UNKNOWN\r\n")
+			return err
+		}
+
+		proto, sip, dip := "TCP6", ip6String(s.IP), ip6String(d.IP)
+		if ip4 {
+			proto, sip, dip = "TCP4", s.IP.To4().String(), d.IP.To4().String()
+		}
+		_, err := fmt.Fprintf(w, "PROXY %s %s %s %d %d\r\n", proto, sip, dip, s.Port, d.Port)
+		return err
+	case V2:
+		header := bytes.NewBuffer(bytes.Clone(v2Signature))
+		if !known {
+			header.Write([]byte{0x20, 0x00, 0x00, 0x00})
+			_, err := w.Write(header.Bytes())
+			return err
+		}
+
+		var family byte = 0x21
+		sip, dip := s.IP.To16(), d.IP.To16()
+		if ip4 {
+			family, sip, dip = 0x11, s.IP.To4(), d.IP.To4()
+		}
+
+		header.Write([]byte{0x21, family})
+		binary.Write(header, binary.BigEndian, uint16(len(sip)*2+4))
+		header.Write(sip)
+		header.Write(dip)
+		binary.Write(header, binary.BigEndian, uint16(s.Port))
+		binary.Write(header, binary.BigEndian, uint16(d.Port))
+
+		_, err := w.Write(header.Bytes())
+		return err
+	}
+
+	return fmt.Errorf("unknown PROXY protocol version %q", version)
+}
+
+// ip6String formats ip as IPv6 text, which TCP6 headers need. Go writes IPv4
+// addresses mapped to IPv6 as dotted quads, so those are spelled out in hex.
+func ip6String(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("::ffff:%x:%x", binary.BigEndian.Uint16(ip4[:2]), binary.BigEndian.Uint16(ip4[2:]))
+	}
+
+	return ip.To16().String()
+}
@@ -0,0 +1,283 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadHeader(t *testing.T) {
+	v2 := string(v2Signature)
+
+	tests := []struct {
+		name    string
+		input   string
+		src     string // Empty when the header carries no addresses
+		dst     string
+		rest    string // What's left to read after the header
+		wantErr string // Part of the error, if one is expected
+	}{
+		{
+			name:  "v1 tcp4",
+			input: "PROXY TCP4 203.0.113.7 192.0.2.1 51234 22\r\nSSH-2.0-x",
+			src:   "203.0.113.7:51234",
+			dst:   "192.0.2.1:22",
+			rest:  "SSH-2.0-x",
+		},
+		{
+			name:  "v1 tcp6",
+			input: "PROXY TCP6 2001:db8::7 2001:db8::1 51234 22\r\n",
+			src:   "[2001:db8::7]:51234",
+			dst:   "[2001:db8::1]:22",
+		},
+		{
+			name:  "v1 tcp6 with a mapped IPv4 address",
+			input: "PROXY TCP6 ::ffff:cb00:7107 2001:db8::1 51234 22\r\n",
+			src:   "203.0.113.7:51234",
+			dst:   "[2001:db8::1]:22",
+		},
+		{
+			name:  "v1 unknown",
+			input: "PROXY UNKNOWN\r\nrest",
+			rest:  "rest",
+		},
+		{
+			name:    "v1 missing fields",
+			input:   "PROXY TCP4 203.0.113.7 192.0.2.1 51234\r\n",
+			wantErr: "malformed PROXY v1 header",
+		},
+		{
+			name:    "v1 unknown protocol",
+			input:   "PROXY UDP4 203.0.113.7 192.0.2.1 51234 22\r\n",
+			wantErr: "malformed PROXY v1 header",
+		},
+		{
+			name:    "v1 bad address",
+			input:   "PROXY TCP4 203.0.113.300 192.0.2.1 51234 22\r\n",
+			wantErr: "invalid address",
+		},
+		{
+			name:    "v1 port out of range",
+			input:   "PROXY TCP4 203.0.113.7 192.0.2.1 65536 22\r\n",
+			wantErr: "invalid port",
+		},
+		{
+			name:    "v1 too long",
+			input:   "PROXY TCP4 " + strings.Repeat("1", v1MaxLength) + "\r\n",
+			wantErr: "too long",
+		},
+		{
+			name:    "v1 cut off",
+			input:   "PROXY TCP4 203.0.113.7",
+			wantErr: "reading PROXY header",
+		},
+		{
+			name: "v2 tcp4",
+			input: v2 + "\x21\x11\x00\x0c" +
+				"\xcb\x00\x71\x07" + "\xc0\x00\x02\x01" + "\xc8\x22" + "\x00\x16" + "SSH",
+			src:  "203.0.113.7:51234",
+			dst:  "192.0.2.1:22",
+			rest: "SSH",
+		},
+		{
+			name: "v2 tcp4 with TLVs after the addresses",
+			input: v2 + "\x21\x11\x00\x10" +
+				"\xcb\x00\x71\x07" + "\xc0\x00\x02\x01" + "\xc8\x22" + "\x00\x16" + "\x04\x00\x01\x00",
+			src: "203.0.113.7:51234",
+			dst: "192.0.2.1:22",
+		},
+		{
+			name:  "v2 local",
+			input: v2 + "\x20\x00\x00\x00" + "rest",
+			rest:  "rest",
+		},
+		{
+			name:  "v2 unix socket",
+			input: v2 + "\x21\x31\x00\x00",
+		},
+		{
+			name:    "v2 wrong version",
+			input:   v2 + "\x11\x11\x00\x00",
+			wantErr: "unsupported PROXY header version 1",
+		},
+		{
+			name:    "v2 unknown command",
+			input:   v2 + "\x22\x11\x00\x00",
+			wantErr: "unsupported PROXY v2 command 2",
+		},
+		{
+			name:    "v2 too short for its addresses",
+			input:   v2 + "\x21\x11\x00\x04" + "\xcb\x00\x71\x07",
+			wantErr: "too short",
+		},
+		{
+			name:    "v2 body cut off",
+			input:   v2 + "\x21\x11\x00\x0c" + "\xcb\x00",
+			wantErr: "reading PROXY header",
+		},
+		{
+			name:    "no header",
+			input:   "SSH-2.0-OpenSSH_9.6\r\n",
+			wantErr: ErrNoHeader.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.input))
+			src, dst, err := ReadHeader(r)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := addrString(src); got != tt.src {
+				t.Errorf("src = %q, want %q", got, tt.src)
+			}
+			if got := addrString(dst); got != tt.dst {
+				t.Errorf("dst = %q, want %q", got, tt.dst)
+			}
+
+			rest, _ := r.Peek(r.Buffered())
+			if string(rest) != tt.rest {
+				t.Errorf("left after the header = %q, want %q", rest, tt.rest)
+			}
+		})
+	}
+}
+
+func TestReadHeaderNoHeaderIsErrNoHeader(t *testing.T) {
+	_, _, err := ReadHeader(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n")))
+	if !errors.Is(err, ErrNoHeader) {
+		t.Fatalf("error = %v, want ErrNoHeader", err)
+	}
+}
+
+func TestWriteHeader(t *testing.T) {
+	ip4 := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}
+	ip4dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 22}
+	ip6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::7"), Port: 51234}
+	ip6dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 22}
+	unix := &net.UnixAddr{Name: "/tmp/sock", Net: "unix"}
+
+	tests := []struct {
+		name     string
+		version  string
+		src, dst net.Addr
+		v1       string // The exact v1 header, checked for v1 only
+		wantSrc  string // After reading the header back; empty for no addresses
+		wantDst  string
+	}{
+		{
+			name:    "v1 tcp4",
+			version: V1,
+			src:     ip4,
+			dst:     ip4dst,
+			v1:      "PROXY TCP4 203.0.113.7 192.0.2.1 51234 22\r\n",
+			wantSrc: "203.0.113.7:51234",
+			wantDst: "192.0.2.1:22",
+		},
+		{
+			name:    "v1 tcp6",
+			version: V1,
+			src:     ip6,
+			dst:     ip6dst,
+			v1:      "PROXY TCP6 2001:db8::7 2001:db8::1 51234 22\r\n",
+			wantSrc: "[2001:db8::7]:51234",
+			wantDst: "[2001:db8::1]:22",
+		},
+		{
+			name:    "v1 mixed families",
+			version: V1,
+			src:     ip4,
+			dst:     ip6dst,
+			v1:      "PROXY TCP6 ::ffff:cb00:7107 2001:db8::1 51234 22\r\n",
+			wantSrc: "203.0.113.7:51234",
+			wantDst: "[2001:db8::1]:22",
+		},
+		{
+			name:    "v1 not tcp",
+			version: V1,
+			src:     unix,
+			dst:     ip4dst,
+			v1:      "PROXY UNKNOWN\r\n",
+		},
+		{
+			name:    "v2 tcp4",
+			version: V2,
+			src:     ip4,
+			dst:     ip4dst,
+			wantSrc: "203.0.113.7:51234",
+			wantDst: "192.0.2.1:22",
+		},
+		{
+			name:    "v2 tcp6",
+			version: V2,
+			src:     ip6,
+			dst:     ip6dst,
+			wantSrc: "[2001:db8::7]:51234",
+			wantDst: "[2001:db8::1]:22",
+		},
+		{
+			name:    "v2 mixed families",
+			version: V2,
+			src:     ip6,
+			dst:     ip4dst,
+			wantSrc: "[2001:db8::7]:51234",
+			wantDst: "192.0.2.1:22",
+		},
+		{
+			name:    "v2 not tcp",
+			version: V2,
+			src:     ip4,
+			dst:     unix,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteHeader(&buf, tt.version, tt.src, tt.dst); err != nil {
+				t.Fatalf("WriteHeader: %v", err)
+			}
+			if tt.version == V1 && buf.String() != tt.v1 {
+				t.Errorf("header = %q, want %q", buf.String(), tt.v1)
+			}
+
+			src, dst, err := ReadHeader(bufio.NewReader(&buf))
+			if err != nil {
+				t.Fatalf("ReadHeader: %v", err)
+			}
+			if got := addrString(src); got != tt.wantSrc {
+				t.Errorf("src = %q, want %q", got, tt.wantSrc)
+			}
+			if got := addrString(dst); got != tt.wantDst {
+				t.Errorf("dst = %q, want %q", got, tt.wantDst)
+			}
+		})
+	}
+}
+
+func TestWriteHeaderUnknownVersion(t *testing.T) {
+	err := WriteHeader(&bytes.Buffer{}, "v3", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown PROXY protocol version") {
+		t.Fatalf("error = %v, want an unknown version error", err)
+	}
+}
+
+func addrString(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+
+	return a.String()
+}
@@ -0,0 +1,156 @@
+package retention
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+)
+
+const defaultInterval = 60 * time.Minute
+
+// Enabled reports whether the policy would delete anything.
+func Enabled(policy *config.Retention) bool {
+	if policy == nil {
+		return false
+	}
+
+	if policy.MaxAgeDays > 0 || policy.MaxRows > 0 {
+		return true
+	}
+
+	for _, r := range policy.Rules {
+		if r.MaxAgeDays > 0 || r.MaxRows > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	jobMu   sync.Mutex
+	stopJob chan struct{} // Closed to stop the running job
+)
+
+// Start runs the pruning job in the background on the policy's interval,
+// replacing any job already running.
+func Start(policy *config.Retention) {
+	jobMu.Lock()
+	defer jobMu.Unlock()
+
+	if stopJob != nil {
+		close(stopJob)
+		stopJob = nil
+	}
+
+	if !Enabled(policy) {
+		return
+	}
+
+	interval := defaultInterval
+	if policy.IntervalMinutes > 0 {
+		interval = time.Duration(policy.IntervalMinutes) * time.Minute
+	}
+
+	log.Info("Starting event retention job", "interval", interval)
+
+	stop := make(chan struct{})
+	stopJob = stop
+
+	go func() {
+		for {
+			if _, err := Prune(policy); err != nil {
+				log.Error("Event pruning failed", "error", err)
+			}
+
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// Prune applies the retention policy once, returning the number of events
+// deleted. Per type rules are applied first, then the global limits.
+func Prune(policy *config.Retention) (int64, error) {
+	if !Enabled(policy) {
+		return 0, nil
+	}
+
+	var total int64
+	ruleTypes := []any{}
+
+	for _, r := range policy.Rules {
+		if r.Type == "" {
+			continue
+		}
+
+		if r.MaxAgeDays > 0 {
+			ruleTypes = append(ruleTypes, r.Type)
+
+			n, err := entity.EventPrune(policy.Rollup,
+				"type = ? AND timestamp < datetime('now', ?)",
+				r.Type, daysAgo(r.MaxAgeDays),
+			)
+			if err != nil {
+				return total, fmt.Errorf("pruning %s events by age: %w", r.Type, err)
+			}
+			total += n
+		}
+
+		if r.MaxRows > 0 {
+			n, err := entity.EventPrune(policy.Rollup,
+				"type = ? AND id <= (SELECT id FROM events WHERE type = ? ORDER BY id DESC LIMIT 1 OFFSET ?)",
+				r.Type, r.Type, r.MaxRows,
+			)
+			if err != nil {
+				return total, fmt.Errorf("pruning %s events by count: %w", r.Type, err)
+			}
+			total += n
+		}
+	}
+
+	if policy.MaxAgeDays > 0 {
+		// Types with their own age rule are left to that rule.
+		where := "timestamp < datetime('now', ?)"
+		values := []any{daysAgo(policy.MaxAgeDays)}
+		if len(ruleTypes) > 0 {
+			where += " AND type NOT IN (" + strings.TrimSuffix(strings.Repeat("?,", len(ruleTypes)), ",") + ")"
+			values = append(values, ruleTypes...)
+		}
+
+		n, err := entity.EventPrune(policy.Rollup, where, values...)
+		if err != nil {
+			return total, fmt.Errorf("pruning events by age: %w", err)
+		}
+		total += n
+	}
+
+	if policy.MaxRows > 0 {
+		n, err := entity.EventPrune(policy.Rollup,
+			"id <= (SELECT id FROM events ORDER BY id DESC LIMIT 1 OFFSET ?)",
+			policy.MaxRows,
+		)
+		if err != nil {
+			return total, fmt.Errorf("pruning events by count: %w", err)
+		}
+		total += n
+	}
+
+	if total > 0 {
+		log.Info("Pruned events", "deleted", total, "rollup", policy.Rollup)
+	}
+
+	return total, nil
+}
+
+func daysAgo(days int) string {
+	return fmt.Sprintf("-%d days", days)
+}
@@ -0,0 +1,174 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCEF  = "cef"
+	FormatLEEF = "leef"
+
+	vendor  = "HoneyBear"
+	product = "HoneyBearHoneyPot"
+	version = "1.0.1"
+)
+
+// Formatter renders an event as a single line message.
+type Formatter func(e *entity.Event) (string, error)
+
+// NewFormatter returns the formatter for a format name, defaulting to JSON.
+func NewFormatter(format string) (Formatter, error) {
+	switch strings.ToLower(format) {
+	case "", FormatJSON:
+		return FormatEventJSON, nil
+	case FormatCEF:
+		return FormatEventCEF, nil
+	case FormatLEEF:
+		return FormatEventLEEF, nil
+	default:
+		return nil, fmt.Errorf("unknown event format %q", format)
+	}
+}
+
+// FormatEventJSON renders the event as a JSON object.
+func FormatEventJSON(e *entity.Event) (string, error) {
+	data, err := json.Marshal(e)
+	return string(data), err
+}
+
+// FormatEventCEF renders the event in ArcSight Common Event Format.
+func FormatEventCEF(e *entity.Event) (string, error) {
+	ip, port := splitHost(e.Host)
+
+	ext := [][2]string{
+		{"rt", strconv.FormatInt(e.Timestamp.UnixMilli(), 10)},
+		{"src", ip},
+		{"spt", port},
+		{"suser", e.User},
+		{"app", e.App},
+		{"act", e.Action},
+		{"cat", e.Source},
+	}
+	if e.ID != 0 {
+		ext = append(ext, [2]string{"externalId", strconv.Itoa(e.ID)})
+	}
+	if len(e.Metadata) > 0 {
+		md, err := json.Marshal(e.Metadata)
+		if err != nil {
+			return "", err
+		}
+		ext = append(ext, [2]string{"cs1Label", "metadata"}, [2]string{"cs1", string(md)})
+	}
+
+	parts := []string{}
+	for _, kv := range ext {
+		if kv[1] == "" {
+			continue
+		}
+		parts = append(parts, kv[0]+"="+cefExtEscape(kv[1]))
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeaderEscape(vendor),
+		cefHeaderEscape(product),
+		cefHeaderEscape(version),
+		cefHeaderEscape(e.Type),
+		cefHeaderEscape(eventName(e)),
+		cefSeverity(e),
+		strings.Join(parts, " "),
+	), nil
+}
+
+// FormatEventLEEF renders the event in IBM QRadar Log Event Extended Format.
+func FormatEventLEEF(e *entity.Event) (string, error) {
+	ip, port := splitHost(e.Host)
+
+	attrs := map[string]string{
+		"devTime":       e.Timestamp.UTC().Format("Jan 02 2006 15:04:05"),
+		"devTimeFormat": "MMM dd yyyy HH:mm:ss",
+		"src":           ip,
+		"srcPort":       port,
+		"usrName":       e.User,
+		"cat":           e.Source,
+		"sev":           strconv.Itoa(cefSeverity(e)),
+		"action":        e.Action,
+		"app":           e.App,
+	}
+	for k, v := range e.Metadata {
+		attrs["md_"+k] = fmt.Sprint(v)
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, k := range keys {
+		if attrs[k] == "" {
+			continue
+		}
+		parts = append(parts, k+"="+leefEscape(attrs[k]))
+	}
+
+	return fmt.Sprintf("LEEF:1.0|%s|%s|%s|%s|%s",
+		vendor, product, version, cefHeaderEscape(e.Type), strings.Join(parts, "\t"),
+	), nil
+}
+
+func eventName(e *entity.Event) string {
+	switch e.Type {
+	case entity.EventTypeAuth:
+		return "Authentication attempt"
+	case entity.EventTypeLogin:
+		return "Honey pot login"
+	case entity.EventTypeLogout:
+		return "Honey pot logout"
+	case entity.EventTypeTyped:
+		return "Command typed"
+	default:
+		return e.Type
+	}
+}
+
+// cefSeverity maps event types onto the 0-10 CEF severity scale.
+func cefSeverity(e *entity.Event) int {
+	switch e.Type {
+	case entity.EventTypeLogin:
+		return 6
+	case entity.EventTypeTyped, entity.EventTypeAuth:
+		return 5
+	default:
+		return 3
+	}
+}
+
+func splitHost(host string) (string, string) {
+	ip, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host, ""
+	}
+
+	return ip, port
+}
+
+func cefHeaderEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+func cefExtEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func leefEscape(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
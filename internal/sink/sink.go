@@ -0,0 +1,139 @@
+package sink
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+)
+
+// Each sink gets its own subscription, buffered so a slow collector doesn't
+// lose events during short stalls.
+const subscriptionSize = 1000
+
+// Longest StopAll waits for sinks to deliver what they have queued.
+const stopTimeout = 30 * time.Second
+
+// Sink receives every published event and ships it somewhere else.
+type Sink interface {
+	Name() string
+	Send(e *entity.Event) error
+	Close() error
+}
+
+// starter is a sink with work of its own, like resending a spool, that waits
+// until the sink is started.
+type starter interface {
+	start()
+}
+
+var (
+	runningMu sync.Mutex
+	running   = map[string]chan struct{}{} // Closed when the sink has closed
+)
+
+// FromConfig builds the sinks described in the config. dataDir is the app
+// data directory, used for anything a sink keeps on disk. If one can't be
+// built, the ones already built are closed and none are returned.
+func FromConfig(cfg *config.Sinks, dataDir string) (sinks []Sink, err error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	defer func() {
+		if err != nil {
+			for _, s := range sinks {
+				s.Close()
+			}
+			sinks = nil
+		}
+	}()
+
+	for i, c := range cfg.Syslog {
+		s, err := NewSyslog(i, c)
+		if err != nil {
+			return sinks, err
+		}
+		sinks = append(sinks, s)
+	}
+
+	for i, c := range cfg.Webhooks {
+		s, err := NewWebhook(i, c, dataDir)
+		if err != nil {
+			return sinks, err
+		}
+		sinks = append(sinks, s)
+	}
+
+	return sinks, nil
+}
+
+// Start subscribes each sink to the event bus.
+func Start(sinks ...Sink) {
+	for _, s := range sinks {
+		subName := "sink:" + s.Name()
+		events := entity.EventSubscribeSize(subName, subscriptionSize)
+
+		done := make(chan struct{})
+		runningMu.Lock()
+		running[s.Name()] = done
+		runningMu.Unlock()
+
+		log.Info("Starting event sink", "name", s.Name())
+		if st, ok := s.(starter); ok {
+			st.start()
+		}
+
+		go func(s Sink) {
+			defer close(done)
+
+			for e := range events {
+				if err := s.Send(e); err != nil {
+					log.Warn("Event sink failed to send", "name", s.Name(), "error", err)
+				}
+			}
+
+			if err := s.Close(); err != nil {
+				log.Warn("Event sink failed to close", "name", s.Name(), "error", err)
+			}
+		}(s)
+	}
+}
+
+// StopAll unsubscribes and closes every running sink, waiting up to
+// stopTimeout for them to deliver what they have queued. Sinks replacing them
+// should be started after.
+func StopAll() {
+	runningMu.Lock()
+	stopping := running
+	running = map[string]chan struct{}{}
+	runningMu.Unlock()
+
+	for name := range stopping {
+		entity.EventUnsubscribe("sink:" + name)
+	}
+
+	deadline := time.After(stopTimeout)
+	for _, done := range stopping {
+		select {
+		case <-done:
+		case <-deadline:
+			for name, done := range stopping {
+				select {
+				case <-done:
+				default:
+					log.Warn("Event sink didn't finish delivering in time", "name", name)
+				}
+			}
+			return
+		}
+	}
+}
+
+// wants reports whether an event passes a sink's type filter.
+func wants(types []string, e *entity.Event) bool {
+	return len(types) == 0 || slices.Contains(types, e.Type)
+}
@@ -0,0 +1,241 @@
+package sink
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+)
+
+const (
+	syslogDialTimeout  = 10 * time.Second
+	syslogWriteTimeout = 10 * time.Second
+	syslogMaxUDPSize   = 2048
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Syslog sends events to a collector as RFC 5424 messages. TCP and TLS use
+// octet counted framing (RFC 6587 / RFC 5425).
+type Syslog struct {
+	name      string
+	network   string
+	address   string
+	facility  int
+	appName   string
+	hostname  string
+	types     []string
+	format    Formatter
+	tlsConfig *tls.Config
+
+	conn net.Conn
+}
+
+// NewSyslog creates a syslog sink from its config. The index distinguishes
+// multiple syslog sinks.
+func NewSyslog(index int, c config.SyslogSink) (*Syslog, error) {
+	if c.Address == "" {
+		return nil, errors.New("syslog sink address required")
+	}
+
+	s := &Syslog{
+		name:     fmt.Sprintf("syslog-%d", index),
+		network:  strings.ToLower(c.Network),
+		address:  c.Address,
+		facility: syslogFacilities["local0"],
+		appName:  c.AppName,
+		hostname: c.Hostname,
+		types:    c.Types,
+	}
+
+	switch s.network {
+	case "":
+		s.network = "udp"
+	case "udp", "tcp":
+	case "tls":
+		s.tlsConfig = &tls.Config{InsecureSkipVerify: c.TLSSkipVerify}
+		if c.TLSCAFile != "" {
+			pem, err := os.ReadFile(c.TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading syslog CA file: %w", err)
+			}
+
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", c.TLSCAFile)
+			}
+			s.tlsConfig.RootCAs = pool
+		}
+	default:
+		return nil, fmt.Errorf("unknown syslog network %q", c.Network)
+	}
+
+	if c.Facility != "" {
+		f, ok := syslogFacilities[strings.ToLower(c.Facility)]
+		if !ok {
+			return nil, fmt.Errorf("unknown syslog facility %q", c.Facility)
+		}
+		s.facility = f
+	}
+
+	if s.appName == "" {
+		s.appName = "honeybear"
+	}
+
+	if s.hostname == "" {
+		s.hostname, _ = os.Hostname()
+		if s.hostname == "" {
+			s.hostname = "-"
+		}
+	}
+
+	var err error
+	s.format, err = NewFormatter(c.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Syslog) Name() string {
+	return s.name
+}
+
+func (s *Syslog) Send(e *entity.Event) error {
+	if !wants(s.types, e) {
+		return nil
+	}
+
+	msg, err := s.format(e)
+	if err != nil {
+		return err
+	}
+
+	line := s.message(e, msg)
+
+	// One reconnect attempt per message; a dead collector shouldn't stall the
+	// sink for longer than that.
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if err = s.connect(); err != nil {
+				continue
+			}
+		}
+
+		if err = s.write(line); err == nil {
+			return nil
+		}
+
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	return err
+}
+
+func (s *Syslog) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// message builds the RFC 5424 message for an event.
+func (s *Syslog) message(e *entity.Event, msg string) string {
+	ts := e.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	pri := s.facility*8 + severity(e)
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		pri,
+		ts.UTC().Format(time.RFC3339Nano),
+		header(s.hostname, 255),
+		header(s.appName, 48),
+		os.Getpid(),
+		header(e.Type, 32),
+		msg,
+	)
+}
+
+func (s *Syslog) connect() error {
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	if s.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(s.network, s.address)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+	return nil
+}
+
+func (s *Syslog) write(line string) error {
+	s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+
+	if s.network == "udp" {
+		if len(line) > syslogMaxUDPSize {
+			line = line[:syslogMaxUDPSize]
+		}
+		_, err := s.conn.Write([]byte(line))
+		return err
+	}
+
+	_, err := fmt.Fprintf(s.conn, "%d %s", len(line), line)
+	return err
+}
+
+// severity maps event types onto syslog severities.
+func severity(e *entity.Event) int {
+	switch e.Type {
+	case entity.EventTypeLogin, entity.EventTypeAuth:
+		return 5 // notice
+	default:
+		return 6 // informational
+	}
+}
+
+// header makes a value safe for an RFC 5424 header field: printable ASCII, no
+// spaces, and not empty.
+func header(s string, max int) string {
+	out := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+
+	if out == "" {
+		return "-"
+	}
+	if len(out) > max {
+		out = out[:max]
+	}
+
+	return out
+}
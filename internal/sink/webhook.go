@@ -0,0 +1,380 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+)
+
+const (
+	defaultWebhookBatchSize  = 100
+	defaultWebhookRetries    = 5
+	defaultWebhookTimeout    = 10 * time.Second
+	defaultWebhookHMACHeader = "X-HoneyBear-Signature"
+	webhookQueueSize         = 1000
+	webhookMaxBackoff        = time.Minute
+	webhookSpoolInterval     = time.Minute
+
+	// The default body is the batch of events as JSON.
+	defaultWebhookTemplate = `{"sensor": {{json .Sensor}}, "count": {{.Count}}, "events": {{json .Events}}}`
+)
+
+// WebhookPayload is the data available to webhook body templates.
+type WebhookPayload struct {
+	Sensor string          // Hostname of the pot
+	Count  int             // Number of events in the batch
+	Event  *entity.Event   // First event of the batch, handy when batching is off
+	Events []*entity.Event // Every event in the batch
+}
+
+// Webhook sends events to an HTTP endpoint, optionally in batches. Requests
+// that still fail after retrying are spooled to disk and retried later.
+// Requests the endpoint rejects outright aren't retried, but moved to the
+// spool's dead directory for a look.
+type Webhook struct {
+	name     string
+	cfg      config.WebhookSink
+	tmpl     *template.Template
+	client   *http.Client
+	spoolDir string
+	sensor   string
+
+	queue chan *entity.Event
+	done  chan struct{}
+	once  sync.Once // Starts the delivery loop, or stands in for it on Close
+}
+
+// NewWebhook creates a webhook sink from its config. Its delivery loop, which
+// also resends the spool, waits for Start, so a sink replacing one with the
+// same spool can be built while the old one is still running. The index
+// distinguishes multiple webhook sinks.
+func NewWebhook(index int, c config.WebhookSink, dataDir string) (*Webhook, error) {
+	if c.URL == "" {
+		return nil, errors.New("webhook sink url required")
+	}
+
+	w := &Webhook{
+		name:     fmt.Sprintf("webhook-%d", index),
+		cfg:      c,
+		spoolDir: c.SpoolDir,
+		queue:    make(chan *entity.Event, webhookQueueSize),
+		done:     make(chan struct{}),
+	}
+
+	if w.cfg.Method == "" {
+		w.cfg.Method = http.MethodPost
+	}
+	if w.cfg.ContentType == "" {
+		w.cfg.ContentType = "application/json"
+	}
+	if w.cfg.HMACHeader == "" {
+		w.cfg.HMACHeader = defaultWebhookHMACHeader
+	}
+	if w.cfg.BatchSize <= 0 {
+		w.cfg.BatchSize = defaultWebhookBatchSize
+	}
+	if w.cfg.MaxRetries <= 0 {
+		w.cfg.MaxRetries = defaultWebhookRetries
+	}
+
+	timeout := defaultWebhookTimeout
+	if c.TimeoutSeconds > 0 {
+		timeout = time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	w.client = &http.Client{Timeout: timeout}
+
+	body := c.Template
+	if c.TemplateFile != "" {
+		data, err := os.ReadFile(c.TemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading webhook template: %w", err)
+		}
+		body = string(data)
+	}
+	if body == "" {
+		body = defaultWebhookTemplate
+	}
+
+	tmpl, err := template.New(w.name).Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"join":  strings.Join,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing webhook template: %w", err)
+	}
+	w.tmpl = tmpl
+
+	if w.spoolDir == "" {
+		w.spoolDir = filepath.Join(dataDir, "spool", w.name)
+	}
+	if err := os.MkdirAll(w.spoolDir, 0700); err != nil {
+		return nil, fmt.Errorf("creating webhook spool: %w", err)
+	}
+
+	w.sensor, _ = os.Hostname()
+
+	return w, nil
+}
+
+func (w *Webhook) start() {
+	w.once.Do(func() {
+		go w.loop()
+	})
+}
+
+func (w *Webhook) Name() string {
+	return w.name
+}
+
+func (w *Webhook) Send(e *entity.Event) error {
+	if !wants(w.cfg.Types, e) {
+		return nil
+	}
+
+	select {
+	case w.queue <- e:
+		return nil
+	default:
+		return errors.New("webhook queue full, event dropped")
+	}
+}
+
+// Close delivers anything still queued and stops the delivery loop.
+func (w *Webhook) Close() error {
+	w.once.Do(func() {
+		close(w.done) // Never started
+	})
+	close(w.queue)
+	<-w.done
+	return nil
+}
+
+func (w *Webhook) loop() {
+	defer close(w.done)
+
+	window := time.Duration(w.cfg.BatchSeconds) * time.Second
+	spoolTicker := time.NewTicker(webhookSpoolInterval)
+	defer spoolTicker.Stop()
+
+	var (
+		batch []*entity.Event
+		timer <-chan time.Time
+	)
+
+	flush := func() {
+		timer = nil
+		if len(batch) == 0 {
+			return
+		}
+
+		body, err := w.render(batch)
+		batch = nil
+		if err != nil {
+			log.Error("Webhook template failed", "name", w.name, "error", err)
+			return
+		}
+
+		w.deliver(body)
+	}
+
+	w.retrySpool()
+
+	for {
+		select {
+		case e, ok := <-w.queue:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch = append(batch, e)
+			if window == 0 || len(batch) >= w.cfg.BatchSize {
+				flush()
+			} else if timer == nil {
+				timer = time.After(window)
+			}
+		case <-timer:
+			flush()
+		case <-spoolTicker.C:
+			w.retrySpool()
+		}
+	}
+}
+
+func (w *Webhook) render(events []*entity.Event) ([]byte, error) {
+	var buf bytes.Buffer
+	err := w.tmpl.Execute(&buf, WebhookPayload{
+		Sensor: w.sensor,
+		Count:  len(events),
+		Event:  events[0],
+		Events: events,
+	})
+
+	return buf.Bytes(), err
+}
+
+// errWebhookRejected marks a 4xx response that sending again won't fix.
+var errWebhookRejected = errors.New("rejected")
+
+// deliver posts a body, retrying with exponential backoff, and spools it if
+// every attempt fails.
+func (w *Webhook) deliver(body []byte) {
+	var err error
+	for attempt := 0; attempt < w.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff(attempt))
+		}
+
+		if err = w.post(body); err == nil {
+			return
+		}
+		if errors.Is(err, errWebhookRejected) {
+			w.deadLetter(body, "", err)
+			return
+		}
+
+		log.Debug("Webhook delivery failed", "name", w.name, "attempt", attempt+1, "error", err)
+	}
+
+	log.Warn("Webhook delivery failed, spooling", "name", w.name, "error", err)
+	w.spool(body)
+}
+
+func (w *Webhook) post(body []byte) error {
+	req, err := http.NewRequest(w.cfg.Method, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", w.cfg.ContentType)
+	req.Header.Set("User-Agent", product+"/"+version)
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if w.cfg.HMACSecret != "" {
+		mac := hmac.New(sha256.New, []byte(w.cfg.HMACSecret))
+		mac.Write(body)
+		req.Header.Set(w.cfg.HMACHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	case resp.StatusCode >= 400 && resp.StatusCode <= 499:
+		return fmt.Errorf("%w with status %s", errWebhookRejected, resp.Status)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (w *Webhook) spool(body []byte) {
+	path := filepath.Join(w.spoolDir, fmt.Sprintf("%d.body", time.Now().UnixNano()))
+	if err := os.WriteFile(path, body, 0600); err != nil {
+		log.Error("Webhook spool write failed", "name", w.name, "error", err)
+	}
+}
+
+// deadLetter keeps a request the endpoint rejected, moving it out of the
+// spool if it came from there.
+func (w *Webhook) deadLetter(body []byte, spooled string, err error) {
+	log.Error("Webhook request rejected, not retrying", "name", w.name, "error", err)
+
+	dir := filepath.Join(w.spoolDir, "dead")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Error("Webhook dead letter write failed", "name", w.name, "error", err)
+		return
+	}
+
+	if spooled != "" {
+		if err := os.Rename(spooled, filepath.Join(dir, filepath.Base(spooled))); err != nil {
+			log.Error("Webhook dead letter write failed", "name", w.name, "error", err)
+		}
+		return
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%d.body", time.Now().UnixNano()))
+	if err := os.WriteFile(path, body, 0600); err != nil {
+		log.Error("Webhook dead letter write failed", "name", w.name, "error", err)
+	}
+}
+
+// retrySpool resends spooled requests, oldest first, stopping at the first
+// failure so the endpoint isn't hammered while it's down. Rejected requests
+// are set aside and don't stop the rest.
+func (w *Webhook) retrySpool() {
+	entries, err := os.ReadDir(w.spoolDir)
+	if err != nil {
+		return
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".body") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(w.spoolDir, name)
+		body, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		if err := w.post(body); errors.Is(err, errWebhookRejected) {
+			w.deadLetter(body, path, err)
+			continue
+		} else if err != nil {
+			return
+		}
+
+		os.Remove(path)
+	}
+
+	if len(names) > 0 {
+		log.Info("Webhook spool flushed", "name", w.name, "requests", len(names))
+	}
+}
+
+// backoff returns the wait before a retry: doubling from a second, capped,
+// with jitter so a fleet of sensors doesn't retry in lockstep.
+func backoff(attempt int) time.Duration {
+	d := time.Second << (attempt - 1)
+	if d > webhookMaxBackoff || d <= 0 {
+		d = webhookMaxBackoff
+	}
+
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,316 @@
+package stats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikeflynn/honeybearhoneypot/internal/db"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 1000
+)
+
+// Page selects a slice of a result set.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// normalize applies the default and maximum page sizes.
+func (p Page) normalize() Page {
+	if p.Limit <= 0 {
+		p.Limit = DefaultLimit
+	}
+	if p.Limit > MaxLimit {
+		p.Limit = MaxLimit
+	}
+	if p.Offset < 0 {
+		p.Offset = 0
+	}
+	return p
+}
+
+// Filter narrows down events, sessions and credentials.
+type Filter = entity.Filter
+
+// Result is one page of rows along with the total number of matching rows.
+type Result[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// Credential is a username and password pair offered during authentication.
+type Credential = entity.Credential
+
+// LeaderboardEntry is one row of the CTF leaderboard.
+type LeaderboardEntry struct {
+	Rank     int    `json:"rank"`
+	Username string `json:"username"`
+	Points   int    `json:"points"`
+	Tasks    int    `json:"tasks"`
+}
+
+// LoginCount is the number of logins over a trailing window.
+type LoginCount struct {
+	Window string `json:"window"`
+	Count  int    `json:"count"`
+}
+
+// Events returns a page of events, newest first.
+func Events(f Filter, p Page) (*Result[*entity.Event], error) {
+	p = p.normalize()
+	where, values := f.Where("timestamp", true)
+
+	total, err := count("SELECT COUNT(*) FROM events"+where, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := entity.EventQuery(
+		"SELECT * FROM events"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(values, p.Limit, p.Offset)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result[*entity.Event]{Items: events, Total: total, Limit: p.Limit, Offset: p.Offset}, nil
+}
+
+// EventsAfter returns up to limit events with IDs greater than afterID, oldest
+// first, for following new events as they're written.
+func EventsAfter(f Filter, afterID int, limit int) ([]*entity.Event, error) {
+	where, values := f.Where("timestamp", true)
+	if where == "" {
+		where = " WHERE id > ?"
+	} else {
+		where += " AND id > ?"
+	}
+
+	return entity.EventQuery(
+		"SELECT * FROM events"+where+" ORDER BY id LIMIT ?",
+		append(values, afterID, Page{Limit: limit}.normalize().Limit)...,
+	)
+}
+
+// RecentEvents returns the latest events from an app.
+func RecentEvents(app string, limit int) ([]*entity.Event, error) {
+	res, err := Events(Filter{App: app}, Page{Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Items, nil
+}
+
+// Sessions returns a page of sessions, newest first.
+func Sessions(f Filter, p Page) (*Result[*entity.Session], error) {
+	p = p.normalize()
+	where, values := f.Where("started_at", false)
+
+	total, err := count("SELECT COUNT(*) FROM sessions"+where, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := entity.SessionQuery(
+		"SELECT * FROM sessions"+where+" ORDER BY started_at DESC LIMIT ? OFFSET ?",
+		append(values, p.Limit, p.Offset)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result[*entity.Session]{Items: sessions, Total: total, Limit: p.Limit, Offset: p.Offset}, nil
+}
+
+// Session returns a single session by ID, or nil if there isn't one.
+func Session(id string) (*entity.Session, error) {
+	sessions, err := entity.SessionQuery("SELECT * FROM sessions WHERE id = ?", id)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+
+	return sessions[0], nil
+}
+
+// SessionByPrefix returns the session whose ID starts with prefix, or nil if
+// there isn't one. It's an error for the prefix to match more than one.
+func SessionByPrefix(prefix string) (*entity.Session, error) {
+	sessions, err := entity.SessionQuery("SELECT * FROM sessions WHERE substr(id, 1, ?) = ? LIMIT 2", len(prefix), prefix)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	if len(sessions) > 1 {
+		return nil, fmt.Errorf("session ID %q is ambiguous", prefix)
+	}
+
+	return sessions[0], nil
+}
+
+// Credentials returns a page of the credentials tried against the pot, newest
+// first.
+func Credentials(f Filter, p Page) (*Result[Credential], error) {
+	p = p.normalize()
+	query, values := entity.CredentialSelect(f)
+
+	total, err := count("SELECT COUNT(*) FROM ("+query+")", values...)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := entity.CredentialQuery(query+" ORDER BY id DESC LIMIT ? OFFSET ?", append(values, p.Limit, p.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result[Credential]{Items: creds, Total: total, Limit: p.Limit, Offset: p.Offset}, nil
+}
+
+// TopCommands returns the most typed commands, including pruned events that
+// were rolled up.
+func TopCommands(limit int) ([]*entity.EventCount, error) {
+	return valueCounts(entity.EventTypeTyped, "SUM(count) DESC", limit)
+}
+
+// RareCommands returns the least typed commands, longest first.
+func RareCommands(limit int) ([]*entity.EventCount, error) {
+	return valueCounts(entity.EventTypeTyped, "SUM(count) ASC, length(value) DESC", limit)
+}
+
+// TopUsers returns the usernames that logged in most often.
+func TopUsers(limit int) ([]*entity.EventCount, error) {
+	return valueCounts(entity.EventTypeLogin, "SUM(count) DESC", limit)
+}
+
+func valueCounts(eventType string, order string, limit int) ([]*entity.EventCount, error) {
+	return entity.EventCountQuery(
+		`SELECT
+			value,
+			SUM(count) AS total
+		FROM event_value_counts
+		WHERE
+			type = ?
+		GROUP BY value
+		ORDER BY `+order+`
+		LIMIT ?`,
+		eventType,
+		Page{Limit: limit}.normalize().Limit,
+	)
+}
+
+// LoginCounts returns the number of logins over the last day and week.
+func LoginCounts() ([]LoginCount, error) {
+	counts := []LoginCount{}
+	for _, days := range []int{1, 7} {
+		n, err := count(
+			"SELECT COUNT(*) FROM events WHERE type = ? AND timestamp >= datetime('now', ?)",
+			entity.EventTypeLogin,
+			fmt.Sprintf("-%d days", days),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, LoginCount{Window: strconv.Itoa(days) + "D", Count: n})
+	}
+
+	return counts, nil
+}
+
+// LoginsAllTime returns the number of user logins ever recorded, including
+// logins that have been pruned into the daily rollups.
+func LoginsAllTime() (int, error) {
+	n, err := count(
+		"SELECT COUNT(*) FROM events WHERE type = ? AND source = ?",
+		entity.EventTypeLogin,
+		entity.EventSourceUser,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	rolledUp, err := entity.EventRollupCount(entity.EventTypeLogin, entity.EventSourceUser)
+	if err != nil {
+		return 0, err
+	}
+
+	return n + rolledUp, nil
+}
+
+// Leaderboard returns the CTF players with points, highest first.
+func Leaderboard(limit int) ([]LeaderboardEntry, error) {
+	rows, err := db.MakeQuery(`
+		SELECT
+			u.username,
+			u.points,
+			(SELECT COUNT(*) FROM ctf_user_tasks t WHERE t.username = u.username)
+		FROM ctf_users u
+		WHERE u.points > 0
+		ORDER BY u.points DESC, u.username
+		LIMIT ?`,
+		Page{Limit: limit}.normalize().Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	board := []LeaderboardEntry{}
+	for rows.Next() {
+		e := LeaderboardEntry{Rank: len(board) + 1}
+		if err := rows.Scan(&e.Username, &e.Points, &e.Tasks); err != nil {
+			return nil, err
+		}
+		board = append(board, e)
+	}
+
+	return board, rows.Err()
+}
+
+// ParseTime accepts an absolute time (RFC3339 or YYYY-MM-DD) or an age
+// relative to now (7d, 12h). An empty string is the zero time.
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized time %q", s)
+}
+
+func count(query string, values ...any) (int, error) {
+	rows, err := db.MakeQuery(query, values...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	if rows.Next() {
+		err = rows.Scan(&n)
+	}
+
+	return n, err
+}
@@ -0,0 +1,342 @@
+package telnet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Conn is a telnet connection. Reads return what the client typed with the
+// protocol taken out, and writes escape anything that would be read as a
+// command.
+type Conn struct {
+	net.Conn
+
+	r      *bufio.Reader
+	sawCR  bool            // The last byte read was a carriage return
+	offers map[[2]byte]int // Options the pot has asked for, so answers aren't answered again
+
+	wmu sync.Mutex // Negotiation replies are written while reading
+
+	mu       sync.Mutex
+	width    int
+	height   int
+	term     string
+	onResize func(width, height int)
+}
+
+// NewConn wraps conn. Call Negotiate to ask the client for the options the
+// pot wants.
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{
+		Conn:   conn,
+		r:      bufio.NewReader(conn),
+		offers: map[[2]byte]int{},
+		width:  DefaultWidth,
+		height: DefaultHeight,
+	}
+}
+
+// Negotiate asks the client to send keys as they're typed without echoing
+// them, and to say its window size and terminal type. The answers are read
+// along with what's typed, so they arrive whenever the client gets to them;
+// plenty of bots never send any.
+func (c *Conn) Negotiate() error {
+	return c.command(
+		[]byte{cmdIAC, cmdWILL, optEcho},
+		[]byte{cmdIAC, cmdWILL, optSGA},
+		[]byte{cmdIAC, cmdDO, optNAWS},
+		[]byte{cmdIAC, cmdDO, optTType},
+	)
+}
+
+// Size returns the client's window size, or the default size if it hasn't
+// said.
+func (c *Conn) Size() (width int, height int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.width, c.height
+}
+
+// Term returns the client's terminal type in lower case, or an empty string
+// if it hasn't said.
+func (c *Conn) Term() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.term
+}
+
+// OnResize calls f whenever the client's window changes size.
+func (c *Conn) OnResize(f func(width, height int)) {
+	c.mu.Lock()
+	c.onResize = f
+	c.mu.Unlock()
+}
+
+// Read reads what the client typed. Telnet sends Enter as CR LF or CR NUL,
+// which come out as a lone CR like a terminal sends, and an interrupt comes
+// out as Ctrl+C.
+func (c *Conn) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		// Block for the first byte only, and return what's there after.
+		if n > 0 && c.r.Buffered() == 0 {
+			break
+		}
+
+		ch, err := c.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		if c.sawCR {
+			c.sawCR = false
+			if ch == '\n' || ch == 0 {
+				continue
+			}
+		}
+
+		if ch == cmdIAC {
+			data, ok, err := c.readCommand()
+			if err != nil {
+				if n > 0 {
+					return n, nil
+				}
+				return 0, err
+			}
+			if !ok {
+				continue
+			}
+			ch = data
+		}
+
+		c.sawCR = ch == '\r'
+		b[n] = ch
+		n++
+	}
+
+	return n, nil
+}
+
+// ReadLine reads a line typed at a prompt, echoing it back if echo is set,
+// which it isn't for passwords.
+func (c *Conn) ReadLine(echo bool) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := c.Read(b); err != nil {
+			return string(line), err
+		}
+
+		switch b[0] {
+		case '\r', '\n':
+			_, err := c.Write([]byte("\r\n"))
+			return string(line), err
+		case 0x7f, '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				if echo {
+					c.Write([]byte("\b \b"))
+				}
+			}
+		case 0x03, 0x04: // Ctrl+C and Ctrl+D
+			return string(line), io.EOF
+		default:
+			if b[0] < ' ' || len(line) >= maxLine {
+				continue
+			}
+			line = append(line, b[0])
+			if echo {
+				c.Write(b)
+			}
+		}
+	}
+}
+
+// Write writes to the client, doubling any 255 bytes so they aren't taken
+// for commands.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if bytes.IndexByte(b, cmdIAC) < 0 {
+		return c.Conn.Write(b)
+	}
+
+	escaped := bytes.ReplaceAll(b, []byte{cmdIAC}, []byte{cmdIAC, cmdIAC})
+	if _, err := c.Conn.Write(escaped); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// command writes telnet commands, remembering the options asked for.
+func (c *Conn) command(cmds ...[]byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	var buf []byte
+	for _, cmd := range cmds {
+		if len(cmd) == 3 {
+			c.offers[[2]byte{cmd[1], cmd[2]}]++
+		}
+		buf = append(buf, cmd...)
+	}
+
+	_, err := c.Conn.Write(buf)
+	return err
+}
+
+// readCommand reads what follows an IAC. It returns a byte of data when the
+// command stands for one.
+func (c *Conn) readCommand() (byte, bool, error) {
+	cmd, err := c.r.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch cmd {
+	case cmdIAC:
+		return cmdIAC, true, nil
+	case cmdIP:
+		return 0x03, true, nil
+	case cmdWILL, cmdWONT, cmdDO, cmdDONT:
+		opt, err := c.r.ReadByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return 0, false, c.answer(cmd, opt)
+	case cmdSB:
+		return 0, false, c.readSubnegotiation()
+	}
+
+	// Go aheads, no-ops and the like.
+	return 0, false, nil
+}
+
+// answer replies to the client offering or asking for an option. Only the
+// options the pot wants are agreed to, and answers to the pot's own requests
+// aren't replied to, so the two sides don't go back and forth.
+func (c *Conn) answer(cmd byte, opt byte) error {
+	switch cmd {
+	case cmdWILL:
+		if opt != optNAWS && opt != optTType {
+			if c.offered(cmdDONT, opt) {
+				return nil
+			}
+			return c.command([]byte{cmdIAC, cmdDONT, opt})
+		}
+
+		var cmds [][]byte
+		if !c.offered(cmdDO, opt) {
+			cmds = append(cmds, []byte{cmdIAC, cmdDO, opt})
+		}
+		// The terminal type has to be asked for once the client agrees.
+		if opt == optTType {
+			cmds = append(cmds, []byte{cmdIAC, cmdSB, optTType, ttypeSEND, cmdIAC, cmdSE})
+		}
+		if len(cmds) == 0 {
+			return nil
+		}
+		return c.command(cmds...)
+	case cmdDO:
+		if c.offered(cmdWILL, opt) || c.offered(cmdWONT, opt) {
+			return nil
+		}
+		if opt == optEcho || opt == optSGA {
+			return c.command([]byte{cmdIAC, cmdWILL, opt})
+		}
+		return c.command([]byte{cmdIAC, cmdWONT, opt})
+	}
+
+	// WONT and DONT just turn options off, which needs no answer from a side
+	// that never turned them on.
+	return nil
+}
+
+// offered reports whether the pot has sent the command for the option, and
+// forgets it so a later change of mind from the client gets an answer.
+func (c *Conn) offered(cmd byte, opt byte) bool {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	key := [2]byte{cmd, opt}
+	if c.offers[key] == 0 {
+		return false
+	}
+	c.offers[key]--
+
+	return true
+}
+
+// readSubnegotiation reads up to IAC SE, picking up the window size and
+// terminal type.
+func (c *Conn) readSubnegotiation() error {
+	var data []byte
+	for {
+		ch, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if ch == cmdIAC {
+			next, err := c.r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if next == cmdSE {
+				break
+			}
+			ch = next
+		}
+
+		if len(data) < maxSubnegotiation {
+			data = append(data, ch)
+		}
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	switch data[0] {
+	case optNAWS:
+		if len(data) < 5 {
+			return nil
+		}
+		width := int(binary.BigEndian.Uint16(data[1:3]))
+		height := int(binary.BigEndian.Uint16(data[3:5]))
+		if width == 0 || height == 0 {
+			return nil
+		}
+
+		c.mu.Lock()
+		c.width, c.height = width, height
+		onResize := c.onResize
+		c.mu.Unlock()
+
+		if onResize != nil {
+			onResize(width, height)
+		}
+	case optTType:
+		if len(data) < 2 || data[1] != ttypeIS {
+			return nil
+		}
+
+		c.mu.Lock()
+		c.term = strings.ToLower(string(data[2:]))
+		c.mu.Unlock()
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+// Package telnet speaks just enough of the telnet protocol (RFC 854) to put a
+// terminal application on the other end: it negotiates character at a time
+// mode with the server echoing, and reads the client's window size (RFC 1073)
+// and terminal type (RFC 1091).
+package telnet
+
+// Commands, which follow an IAC byte.
+const (
+	cmdSE   = 240 // End of subnegotiation
+	cmdIP   = 244 // Interrupt process
+	cmdSB   = 250 // Start of subnegotiation
+	cmdWILL = 251
+	cmdWONT = 252
+	cmdDO   = 253
+	cmdDONT = 254
+	cmdIAC  = 255 // Interpret as command, or a literal 255 when doubled
+)
+
+// Options the pot negotiates.
+const (
+	optEcho  = 1  // The server echoes what's typed
+	optSGA   = 3  // Suppress go ahead, for character at a time input
+	optTType = 24 // Terminal type
+	optNAWS  = 31 // Negotiate about window size
+)
+
+// Terminal type subnegotiation commands.
+const (
+	ttypeIS   = 0
+	ttypeSEND = 1
+)
+
+// Sizes used until the client says otherwise.
+const (
+	DefaultWidth  = 80
+	DefaultHeight = 24
+)
+
+const (
+	// Most of a subnegotiation that's kept. Window sizes and terminal types
+	// are far shorter.
+	maxSubnegotiation = 256
+	// Longest line ReadLine takes; anything typed after is dropped.
+	maxLine = 256
+)
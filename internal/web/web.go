@@ -0,0 +1,41 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/metrics"
+)
+
+var mux = http.NewServeMux()
+
+// Handle adds a handler to the admin web server. Must be called before Start.
+func Handle(pattern string, handler http.Handler) {
+	mux.Handle(pattern, handler)
+}
+
+// Start runs the admin web server on addr in the background. It serves the
+// Prometheus metrics at /metrics along with anything added with Handle.
+func Start(addr string) {
+	if addr == "" {
+		return
+	}
+
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Info("Starting web server", "addr", addr)
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("Could not start web server", "error", err)
+		}
+	}()
+}
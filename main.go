@@ -3,25 +3,44 @@ package main
 // https://github.com/charmbracelet/wish
 
 import (
+	"flag"
 	"net"
 	"os"
 	"path/filepath"
 
 	"github.com/charmbracelet/log"
+	"github.com/mikeflynn/honeybearhoneypot/internal/api"
+	"github.com/mikeflynn/honeybearhoneypot/internal/cli"
 	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/console"
+	"github.com/mikeflynn/honeybearhoneypot/internal/dashboard"
 	"github.com/mikeflynn/honeybearhoneypot/internal/db"
 	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
 	"github.com/mikeflynn/honeybearhoneypot/internal/gui"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot"
 	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/filesystem"
+	"github.com/mikeflynn/honeybearhoneypot/internal/retention"
+	"github.com/mikeflynn/honeybearhoneypot/internal/sink"
+	"github.com/mikeflynn/honeybearhoneypot/internal/web"
 )
 
 const (
 	appName = "HoneyBearHoneyPot"
 )
 
+// tunnelServices are the local addresses tunnels can target besides the pot,
+// which are only set at startup.
+var tunnelServices = map[string]string{}
+
 func main() {
 	cfg, _, err := config.Parse()
+
+	// Checking the config has to work when it's broken, and doesn't need the
+	// database.
+	if args := flag.Args(); len(args) > 0 && args[0] == "config" {
+		os.Exit(cli.Run(args))
+	}
+
 	if err != nil {
 		log.Fatal("Failed to parse configuration", "error", err)
 	}
@@ -29,43 +48,73 @@ func main() {
 	filesystem.SetAdditionalNodes(cfg.Filesystem)
 
 	log.SetLevel(translateLogLevel(cfg.LogLevel))
-	log.Info("Starting Honey Bear Honey Pot...")
 
 	appConfigDir := setup()
+
+	// Maintenance subcommands run against the database and exit.
+	if args := flag.Args(); len(args) > 0 {
+		code := cli.Run(args)
+		cleanup()
+		os.Exit(code)
+	}
+
 	defer cleanup()
 
-	var primaryPort string
-	var additionalListeners []*net.Listener
-	ports := cfg.SSHPorts
-	for x, port := range ports {
-		log.Debug("Adding listener", "port", port)
-		if x == 0 {
-			primaryPort = port
-			continue
-		}
+	log.Info("Starting Honey Bear Honey Pot...")
+	retention.Start(cfg.Retention)
 
-		if listener, err := net.Listen("tcp", ":"+port); err == nil {
-			additionalListeners = append(additionalListeners, &listener)
+	sinks, err := sink.FromConfig(cfg.Sinks, appConfigDir)
+	if err != nil {
+		log.Fatal("Failed to configure event sinks", "error", err)
+	}
+	sink.Start(sinks...)
+	defer sink.StopAll()
+
+	honeypot.RegisterMetrics()
+	api.Register(cfg.APIToken, cfg.APIControlToken)
+	if cfg.Dashboard {
+		if cfg.WebAddr == "" {
+			log.Warn("The dashboard needs -web-addr to be set")
 		} else {
-			log.Error("Failed to add listener", "port", port, "err", err)
+			dashboard.Register()
+		}
+	}
+	web.Start(cfg.WebAddr)
+
+	honeypot.SetProxyProtocol(cfg.ProxyProtocolPorts, cfg.ProxyProtocolTrusted)
+	honeypot.SetPorts(cfg.SSHPorts)
+	honeypot.SetTelnetPorts(cfg.TelnetPorts)
+	honeypot.SetHTTPPorts(cfg.HTTPPorts)
+
+	if cfg.WebAddr != "" {
+		tunnelServices[config.TunnelTargetWeb] = localAddr(cfg.WebAddr)
+	}
+	if cfg.AdminSSHAddr != "" {
+		go console.Start(cfg.AdminSSHAddr, cfg.AdminAuthorizedKeys, appConfigDir)
+		tunnelServices[config.TunnelTargetAdmin] = localAddr(cfg.AdminSSHAddr)
+		if cfg.TunnelAdminPort != "" {
+			honeypot.SetTunnelAdmin(cfg.TunnelAdminPort, localAddr(cfg.AdminSSHAddr))
 		}
+	} else if cfg.TunnelAdminPort != "" {
+		log.Warn("tunnel_admin_port needs the operator console, set with -admin-ssh-addr")
+	}
+
+	if err := honeypot.SetTunnels(cfg, tunnelServices); err != nil {
+		log.Error("Invalid tunnel configuration", "error", err)
 	}
 
-	honeypot.SetPort(primaryPort)
-	host := cfg.Tunnel
-	key := cfg.TunnelKey
-	honeypot.SetTunnel(&host, &key)
-	honeypot.AddListeners(additionalListeners...)
+	watchConfig(cfg, appConfigDir)
+
+	if cfg.PinReset != "" {
+		entity.OptionSet(entity.KeyAdminPIN, cfg.PinReset)
+	}
 
 	if !cfg.NoGUI {
 		go func() {
 			honeypot.StartHoneyPot(appConfigDir)
 		}()
 
-		if cfg.PinReset != "" {
-			entity.OptionSet("gui_pin", cfg.PinReset)
-		}
-
+		gui.SetDataDir(appConfigDir)
 		gui.StartGUI(cfg.FullScreen, float32(cfg.Width), float32(cfg.Height))
 	} else {
 		honeypot.StartHoneyPot(appConfigDir)
@@ -98,16 +147,37 @@ func setup() string {
 		entity.OptionInitialization(),
 		entity.CTFUserInit,
 		entity.CTFUserTaskInit,
+		entity.EventRollupInit,
+		entity.SessionInit,
+		entity.BanInit,
 	)
 
+	if err := entity.EventMigrate(); err != nil {
+		log.Fatal("Failed to migrate events table", "error", err)
+	}
+	if err := entity.SessionMigrate(); err != nil {
+		log.Fatal("Failed to migrate sessions table", "error", err)
+	}
+
 	return appConfigDir
 }
 
 func cleanup() {
-	// Close the database connection
+	// Write any queued events, then close the database connection
+	entity.EventFlush()
 	db.Close()
 }
 
+// localAddr turns a listen address into one that can be dialed locally.
+func localAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
 func translateLogLevel(logLevel string) log.Level {
 	switch logLevel {
 	case "debug":
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/fsnotify/fsnotify"
+	"github.com/mikeflynn/honeybearhoneypot/internal/config"
+	"github.com/mikeflynn/honeybearhoneypot/internal/entity"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot"
+	"github.com/mikeflynn/honeybearhoneypot/internal/honeypot/filesystem"
+	"github.com/mikeflynn/honeybearhoneypot/internal/retention"
+	"github.com/mikeflynn/honeybearhoneypot/internal/sink"
+)
+
+// Editors save in bursts of writes and renames, so wait for the file to
+// settle before reloading.
+const watchSettle = 500 * time.Millisecond
+
+// reloadMu keeps a SIGHUP and a file change from reloading at the same time.
+var reloadMu sync.Mutex
+
+// watchConfig reloads the configuration on SIGHUP, and when the config file
+// changes if watch_config is set.
+func watchConfig(cfg *config.Config, appConfigDir string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadConfig(appConfigDir, "SIGHUP")
+		}
+	}()
+
+	if !cfg.WatchConfig {
+		return
+	}
+
+	path := config.Path()
+	if path == "" {
+		log.Warn("watch_config needs a config file, set with -config")
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Error("Could not watch the config file", "error", err)
+		return
+	}
+
+	// Watch the directory rather than the file, since saving often replaces
+	// the file and a watch on the old one would go quiet.
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		log.Error("Could not watch the config file", "path", path, "error", err)
+		watcher.Close()
+		return
+	}
+
+	log.Info("Watching the config file for changes", "path", path)
+
+	go func() {
+		var settle <-chan time.Time
+		for {
+			select {
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(e.Name) == filepath.Clean(path) && e.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+					settle = time.After(watchSettle)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn("Config file watch error", "error", err)
+			case <-settle:
+				settle = nil
+				reloadConfig(appConfigDir, "file change")
+			}
+		}
+	}()
+}
+
+// reloadConfig reads the config again and applies what can change while the
+// pot runs: ports, tunnels, the filesystem additions, CTF tasks, personas,
+// the log level, retention and sinks. Sessions already connected keep what they
+// started with. Other settings are only noted as needing a restart.
+func reloadConfig(appConfigDir string, trigger string) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	cfg, err := config.Reload()
+	if err != nil {
+		log.Error("Config reload failed, keeping the current config", "trigger", trigger, "error", err)
+		recordReload("Configuration reload failed", entity.EventMetadata{"trigger": trigger, "error": err.Error()})
+		return
+	}
+
+	changes := config.Diff(config.Current(), cfg)
+
+	// Build new sinks before switching over, so a bad sink config leaves
+	// everything as it was.
+	var sinks []sink.Sink
+	for _, c := range changes {
+		if c.Setting != "sinks" {
+			continue
+		}
+
+		sinks, err = sink.FromConfig(cfg.Sinks, appConfigDir)
+		if err != nil {
+			log.Error("Config reload failed, keeping the current config", "trigger", trigger, "error", err)
+			recordReload("Configuration reload failed", entity.EventMetadata{"trigger": trigger, "error": err.Error()})
+			return
+		}
+	}
+
+	// Make host keys for new personas before they take effect, so their first
+	// connections don't wait on them.
+	for _, c := range changes {
+		if c.Setting == "personas" {
+			honeypot.LoadHostKeys(cfg.Personas)
+		}
+	}
+
+	// Template files may have changed even when the config didn't.
+	honeypot.LoadHTTPTemplates(cfg)
+
+	config.Activate(cfg)
+
+	summary := []string{}
+	restart := []string{}
+	errs := []string{}
+	tunnelsChanged := false
+	for _, c := range changes {
+		switch c.Setting {
+		case "tunnel", "tunnel_key", "tunnels", "tunnel_remote_bind", "tunnel_remote_port", "tunnel_known_hosts",
+			"tunnel_strict_host_key", "tunnel_host_keys", "tunnel_keepalive_seconds", "tunnel_keepalive_max", "tunnel_proxy_protocol":
+			tunnelsChanged = true
+		case "ssh_ports":
+			if err := honeypot.SetPorts(cfg.SSHPorts); err != nil {
+				log.Error("Could not listen on every port", "error", err)
+				errs = append(errs, err.Error())
+			}
+		case "telnet_ports":
+			if err := honeypot.SetTelnetPorts(cfg.TelnetPorts); err != nil {
+				log.Error("Could not listen on every telnet port", "error", err)
+				errs = append(errs, err.Error())
+			}
+		case "http_ports":
+			if err := honeypot.SetHTTPPorts(cfg.HTTPPorts); err != nil {
+				log.Error("Could not listen on every HTTP port", "error", err)
+				errs = append(errs, err.Error())
+			}
+		case "proxy_protocol_ports", "proxy_protocol_trusted":
+			honeypot.SetProxyProtocol(cfg.ProxyProtocolPorts, cfg.ProxyProtocolTrusted)
+		case "log_level":
+			log.SetLevel(translateLogLevel(cfg.LogLevel))
+		case "filesystem":
+			filesystem.SetAdditionalNodes(cfg.Filesystem)
+		case "tasks", "personas", "forward_sinkhole", "http_server", "http_apps":
+			// New connections read these from the current config, and the
+			// HTTP app templates were loaded above.
+		case "retention":
+			retention.Start(cfg.Retention)
+		case "sinks":
+			// The old sinks finish delivering first, since a new webhook
+			// resends the same spool once it's started.
+			sink.StopAll()
+			sink.Start(sinks...)
+		default:
+			restart = append(restart, c.Setting)
+		}
+		summary = append(summary, c.String())
+	}
+
+	// Every tunnel reconnects, since most of their settings are shared.
+	if tunnelsChanged {
+		if err := honeypot.SetTunnels(cfg, tunnelServices); err != nil {
+			log.Error("Could not set up every tunnel", "error", err)
+			errs = append(errs, err.Error())
+		}
+	}
+
+	log.Info("Config reloaded", "trigger", trigger, "changes", strings.Join(summary, "; "))
+	if len(restart) > 0 {
+		log.Warn("Some config changes need a restart", "settings", strings.Join(restart, ", "))
+	}
+
+	metadata := entity.EventMetadata{"trigger": trigger, "changes": changes}
+	if len(restart) > 0 {
+		metadata["restart_required"] = restart
+	}
+	if len(errs) > 0 {
+		metadata["errors"] = errs
+	}
+
+	action := "Configuration reloaded with no changes"
+	if len(summary) > 0 {
+		action = "Configuration reloaded: " + strings.Join(summary, "; ")
+	}
+	recordReload(action, metadata)
+}
+
+func recordReload(action string, metadata entity.EventMetadata) {
+	event := &entity.Event{
+		App:       "system",
+		Source:    entity.EventSourceSystem,
+		Type:      entity.EventTypeConfig,
+		Action:    action,
+		Timestamp: time.Now(),
+		Metadata:  metadata,
+	}
+
+	event.Publish()
+	if err := event.Queue(); err != nil {
+		log.Error("Error saving config event", "error", err)
+	}
+}